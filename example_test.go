@@ -0,0 +1,84 @@
+package yatisql_test
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	yatisql "github.com/yatisql/yatisql-go"
+)
+
+func Example() {
+	session, err := yatisql.Open("")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer session.Close()
+
+	result, err := session.Import("testdata/sample.csv", "people")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("imported %d rows into %s\n", result.Rows, result.Table)
+
+	rows, err := session.Query("SELECT name FROM people WHERE CAST(age AS INTEGER) > ? ORDER BY name", 40)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(name)
+	}
+
+	// Output:
+	// imported 10 rows into people
+	// Frank
+	// Jack
+}
+
+func ExampleSession_Export() {
+	session, err := yatisql.Open("")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer session.Close()
+
+	if _, err := session.ImportFiles(
+		yatisql.Input{Path: "testdata/multi_file/users.csv", Table: "users"},
+		yatisql.Input{Path: "testdata/multi_file/orders.csv", Table: "orders"},
+	); err != nil {
+		log.Fatal(err)
+	}
+
+	dir, err := os.MkdirTemp("", "yatisql-example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	result, err := session.Export(
+		"SELECT users.name, COUNT(*) AS orders FROM users JOIN orders ON orders.user_id = users.id GROUP BY users.name ORDER BY users.name LIMIT 1",
+		filepath.Join(dir, "orders.json"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("exported %d row\n", result.Rows)
+
+	content, err := os.ReadFile(filepath.Join(dir, "orders.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(content))
+
+	// Output:
+	// exported 1 row
+	// [
+	//   {"name": "Alice", "orders": 2}
+	// ]
+}
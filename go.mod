@@ -3,9 +3,13 @@ module github.com/yatisql/yatisql-go
 go 1.23
 
 require (
+	github.com/dsnet/compress v0.0.1
 	github.com/fatih/color v1.16.0
 	github.com/mattn/go-sqlite3 v1.14.18
+	github.com/pierrec/lz4/v4 v4.1.21
 	github.com/spf13/cobra v1.8.0
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -4,10 +4,13 @@ package cli
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime/trace"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -16,6 +19,7 @@ import (
 	"github.com/yatisql/yatisql-go/internal/database"
 	"github.com/yatisql/yatisql-go/internal/exporter"
 	"github.com/yatisql/yatisql-go/internal/importer"
+	"github.com/yatisql/yatisql-go/internal/query"
 )
 
 var (
@@ -23,6 +27,9 @@ var (
 	successColor = color.New(color.FgGreen, color.Bold)
 	infoColor    = color.New(color.FgCyan)
 	warnColor    = color.New(color.FgYellow)
+
+	// Queries given with -q and --query-file, in command-line order
+	querySources []querySource
 )
 
 // getHelpWithASCII returns help text with ASCII art.
@@ -89,17 +96,94 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Flags().StringSliceP("input", "i", []string{}, "Input CSV/TSV file(s), comma-separated for multiple files (use '-' or omit for stdin)")
+	rootCmd.Flags().StringSliceP("input", "i", []string{}, "Input CSV/TSV file(s) or http(s) URLs, comma-separated for multiple files (use '-' or omit for stdin)")
+	rootCmd.Flags().StringArray("cmd", []string{}, "Shell command whose stdout is imported like an input file, e.g. 'curl -s https://example.com/data.csv' (repeatable)")
 	rootCmd.Flags().StringSliceP("table", "t", []string{}, "Table name(s) for imported data, comma-separated (default: 'data', 'data2', etc.)")
-	rootCmd.Flags().StringSliceP("output", "o", []string{}, "Output CSV/TSV file path(s), comma-separated (default: stdout). Must match number of queries.")
-	rootCmd.Flags().StringSliceP("query", "q", []string{}, "SQL query(ies) to execute (can specify multiple -q flags)")
-	rootCmd.Flags().StringP("db", "d", "", "SQLite database path (default: temporary file, deleted after execution)")
+	rootCmd.Flags().String("stdin-table", "", "Table name for data read from stdin, instead of its position's -t name or default")
+	rootCmd.Flags().StringSliceP("output", "o", []string{}, "Output CSV/TSV/JSON file path(s), comma-separated (default: stdout). Must match number of queries, or list several for a single query.")
+	rootCmd.Flags().VarP(&queryFlag{sources: &querySources}, "query", "q", "SQL query(ies) to execute (can specify multiple -q flags)")
+	rootCmd.Flags().VarP(&queryFlag{sources: &querySources, file: true}, "query-file", "f", "File(s) holding a SQL query to execute, run in order with -q queries; '-' reads the query from stdin when it is not an input (comma-separated or repeatable)")
+	rootCmd.Flags().StringArray("query-env", []string{}, "Name of an environment variable holding a SQL query to run after any -q queries, keeping it out of shell history and the process list (repeatable)")
+	rootCmd.Flags().StringSlice("select", []string{}, "Output these columns of the first table, e.g. 'id,name', instead of writing a -q query")
+	rootCmd.Flags().String("where", "", "Output the rows of the first table matching a SQL condition, e.g. 'age > 30', instead of writing a -q query (combines with --select)")
+	rootCmd.Flags().String("order-by", "", "Sort the rows of the first table by columns, e.g. 'city,age:desc', instead of writing a -q query (combines with --select and --where)")
+	rootCmd.Flags().Bool("append-output", false, "Append results to existing CSV/TSV output files instead of replacing them (the header is only written to new files)")
+	rootCmd.Flags().Bool("no-header-out", false, "Omit the header row from CSV/TSV query results")
+	rootCmd.Flags().String("rotate-bytes", "", "Split each output file into parts of about this size, e.g. '100MB', written as they stream to out.0.csv, out.1.csv, ... (each with the header)")
+	rootCmd.Flags().String("format", "", "Format of results written to stdout: 'table' draws an aligned box-drawing table when stdout is a terminal, and writes CSV otherwise (default: CSV)")
+	rootCmd.Flags().Int("max-rows", 0, "Stop writing each query's results after N rows and report that they were truncated, without adding a LIMIT to the query (default: all rows)")
+	rootCmd.Flags().String("json-key", "", "Write JSON results as one object keyed by this column's values instead of an array (duplicate keys are an error)")
+	rootCmd.Flags().Bool("binary-safe", false, "Import values as BLOBs and write BLOB results with --binary-encoding, so bytes that are not valid UTF-8 round-trip exactly")
+	rootCmd.Flags().String("binary-encoding", exporter.BinaryBase64, "Encoding of BLOB values in results with --binary-safe: 'base64' or 'hex'")
+	rootCmd.Flags().Int("preview", 0, "Print the first N rows of each imported table to stderr before running queries (--preview alone shows 5)")
+	rootCmd.Flags().Lookup("preview").NoOptDefVal = "5"
+	rootCmd.Flags().Int("estimate", 0, "Before running queries, warn about each table of at least N rows they scan without an index (--estimate alone warns from 100000 rows)")
+	rootCmd.Flags().Lookup("estimate").NoOptDefVal = "100000"
+	rootCmd.Flags().Bool("timing", false, "After the run, print how long parsing, writing, indexing and each query took, with rows per second, to stderr")
+	rootCmd.Flags().String("float-format", "", "printf verb for float results, e.g. '%.2f', '%e' or '%g' (default: shortest exact decimal, without an exponent)")
+	rootCmd.Flags().String("replace-nan", "", "Write NaN and infinite float results as this value instead of NaN, +Inf or -Inf (e.g. '' or 'NA')")
+	rootCmd.Flags().StringArray("null-string", []string{}, "Import this input value as NULL instead of text, e.g. 'NULL', '\\N' or 'NA' (repeatable)")
+	rootCmd.Flags().String("null-output", "", "Write NULL values in CSV/TSV results as this text, e.g. 'NULL' or '\\N' (default: empty; JSON always writes null)")
+	rootCmd.Flags().Bool("count-only", false, "Only report the number of rows each query returns, without writing any output")
+	rootCmd.Flags().Bool("fail-if-empty", false, "Fail if a query writes no rows to an output file (by default this only prints a warning)")
+	rootCmd.Flags().Bool("scalar", false, "Print the query's single value to stdout with no header or quoting; fails unless the result is one row and one column")
+	rootCmd.Flags().String("manifest", "", "Write a JSON manifest of the produced output files (path, format, rows, bytes, query index)")
+	rootCmd.Flags().Bool("emit-metadata", false, "Write a <output>.meta.json sidecar next to each output file (columns and types, rows, delimiter, compression, query)")
+	rootCmd.Flags().String("with-file", "", "SQL file of shared CTE definitions ('name AS (...)', comma-separated) prepended as a WITH clause to every query")
+	rootCmd.Flags().StringP("db", "d", "", "SQLite database path, or a DSN such as 'file:data.db?_busy_timeout=5000' (default: temporary file, deleted after execution)")
+	rootCmd.Flags().Bool("replace-db", false, "Delete the existing database at --db before importing, starting from an empty database")
+	rootCmd.Flags().Bool("no-temp-cleanup-message", false, "Do not report creating and cleaning up the temporary database (import and query messages are still printed)")
 	rootCmd.Flags().BoolP("header", "H", true, "Input file has header row")
-	rootCmd.Flags().String("delimiter", "auto", "Field delimiter: 'comma', 'tab', or 'auto' (default: auto)")
+	rootCmd.Flags().StringSlice("columns", []string{}, "Column names for every input, comma-separated, used instead of the header row (which --header still consumes) or col1, col2, ...; the first row must have one field per name")
+	rootCmd.Flags().Bool("header-only", false, "Only create tables from the input headers, importing zero rows")
+	rootCmd.Flags().String("delimiter", "auto", "Field delimiter: 'comma', 'tab', 'semicolon', 'pipe', 'char:X' for another character, or 'auto' to detect from the extension or content (default: auto)")
+	rootCmd.Flags().String("delimiter-out", "", "Output field delimiter for query results: 'comma', 'tab', 'semicolon', 'pipe', 'char:X', or 'auto' (default: same as --delimiter)")
+	rootCmd.Flags().Int("explain-delimiter", 0, "Report how the first N lines of each input split on comma, tab, semicolon and pipe, then exit without importing (--explain-delimiter alone samples 100)")
+	rootCmd.Flags().Lookup("explain-delimiter").NoOptDefVal = "100"
+	rootCmd.Flags().Bool("check-schema", false, "Compare each input's headers with the columns of the existing table in --db it would be imported into, report added, removed and reordered columns, then exit without importing")
+	rootCmd.Flags().String("try-delimiters", "", "Candidate delimiters to sample each input file with, as characters with escapes, e.g. ',;|\\t'; the one giving the most consistent field count is used and reported (overrides auto-detection)")
+	rootCmd.Flags().String("multi-delimiter", "", "Literal multi-character field separator, e.g. '::' (no quoting support; overrides --delimiter)")
+	rootCmd.Flags().String("record-sep", "", "Literal record separator used instead of newlines, with escapes, e.g. '\\x1e'; fields are split on --field-sep, --multi-delimiter or --delimiter (no quoting support)")
+	rootCmd.Flags().Int("skip-lines", 0, "Skip the first N lines of each input, such as a title or export metadata, before reading the header")
+	rootCmd.Flags().String("comment-char", "", "Skip lines whose first non-space character is this one, e.g. '#', before and after the header (not within quoted fields)")
+	rootCmd.Flags().String("field-sep", "", "Literal field separator with escapes, e.g. '\\x1f' (like --multi-delimiter, for control characters)")
 	rootCmd.Flags().String("trace", "", "Write execution trace to file (use 'go tool trace <file>' to view)")
+	rootCmd.Flags().String("cpuprofile", "", "Write a CPU profile to file (use 'go tool pprof <file>' to view)")
+	rootCmd.Flags().String("memprofile", "", "Write a heap profile to file when the run ends (use 'go tool pprof <file>' to view)")
 	rootCmd.Flags().Bool("trace-debug", false, "Enable debug logging for concurrent execution")
 	rootCmd.Flags().BoolP("progress", "p", false, "Show progress bars for file import operations")
-	rootCmd.Flags().StringSliceP("index", "x", []string{}, "Column(s) to create indexes on, comma-separated")
+	rootCmd.Flags().StringArray("unique-index", []string{}, "Column(s) to create UNIQUE indexes on, given like -x; the import fails, naming a duplicated value, if two rows share one (repeatable)")
+	rootCmd.Flags().StringArrayP("index", "x", []string{}, "Column(s) to create indexes on, comma-separated; join columns with '+' for one composite index, e.g. -x user_id+created_at; prefix with 'table:' to index only that table, e.g. -x users:id,email -x orders:user_id (repeatable)")
+	rootCmd.Flags().StringArray("attach", []string{}, "Attach another SQLite database file as 'name=path.db' so queries can join its tables as name.table (repeatable; the file must exist)")
+	rootCmd.Flags().StringArray("json-index", []string{}, "Index a value inside a JSON column, e.g. 'payload:$.user.id' (repeatable; used by queries with the same json_extract expression)")
+	rootCmd.Flags().StringArray("map", []string{}, "Replace values of a column on import, e.g. 'country:U.S.A.=USA;United States=USA' (repeatable)")
+	rootCmd.Flags().StringSlice("map-file", []string{}, "CSV file(s) of 'column,from,to' value replacements applied on import")
+	rootCmd.Flags().Bool("resume", false, "Make imports resumable: record progress in --db with every batch, and continue tables that an earlier run left unfinished instead of starting over")
+	rootCmd.Flags().String("on-conflict", "", "How to insert rows that violate a unique index or primary key of the table --append inserts into: 'abort' (default; fail the import), 'ignore' (keep the existing row) or 'replace' (replace it)")
+	rootCmd.Flags().Bool("append", false, "Insert imported rows into an existing table in --db with the same columns instead of replacing it (tables that do not exist are created)")
+	rootCmd.Flags().Bool("version-tables", false, "Rename an existing table to <table>_<timestamp> instead of dropping it when importing over it")
+	rootCmd.Flags().Bool("preserve-original-headers", false, "Record each column's original (unsanitized) header in the _yatisql_columns table")
+	rootCmd.Flags().Bool("drop-empty-columns", false, "After importing, drop columns in which every value is empty or NULL (e.g. from trailing delimiters); index columns are kept")
+	rootCmd.Flags().Int("infer-types", 0, "Infer INTEGER, REAL or TEXT column types from the first N rows instead of importing every column as TEXT (--infer-types alone samples 1000)")
+	rootCmd.Flags().Lookup("infer-types").NoOptDefVal = "1000"
+	rootCmd.Flags().Bool("fail-on-type-mismatch", false, "Fail on the first value that does not fit its column's inferred type (or that of the table --append inserts into), naming the column, value and line, instead of importing the column as TEXT")
+	rootCmd.Flags().Bool("squeeze-spaces", false, "Collapse runs of whitespace within imported values to a single space")
+	rootCmd.Flags().String("line-range", "", "Only import rows on these file lines, counting the first line (usually the header) as line 1, e.g. '1000:2000', '1000:' or ':2000'")
+	rootCmd.Flags().Bool("strict-columns", false, "Fail on rows with fewer fields than the header instead of padding them with empty values, and on rows with more unless --extra-columns is given")
+	rootCmd.Flags().String("extra-columns", "", "Rows with more fields than the header: 'error', 'ignore' (drop the extra fields) or 'capture' (store them as JSON in an _extra column) (default: ignore and count them, or error with --strict or --strict-columns)")
+	rootCmd.Flags().String("case-columns", "", "Convert imported column names to 'lower' or 'upper' case")
+	rootCmd.Flags().String("compat", "", "Accept common functions from another SQL dialect: 'mysql' or 'postgres' (e.g. NOW(), LEFT())")
+	rootCmd.Flags().String("sort-output", "", "Sort each query's results by result columns, e.g. 'city,age:desc', without editing the SQL")
+	rootCmd.Flags().String("nulls", "", "Sort NULLs 'first' or 'last' in every ORDER BY term that does not say (default: SQLite's, first for ASC and last for DESC)")
+	rootCmd.Flags().Bool("read-only-query", false, "Run queries in read-only mode so they cannot modify the database")
+	rootCmd.Flags().Bool("strict", false, "Treat data-quality warnings (duplicate table names, failed imports, ...) as errors")
+	rootCmd.Flags().Int("import-concurrency", 0, "Maximum number of files imported at the same time (default: number of CPUs)")
+	rootCmd.Flags().Int("batch-size", 0, "Rows inserted per transaction, reduced automatically for tables with hundreds of columns (default: 10000)")
+	rootCmd.Flags().String("journal-mode", "", "SQLite journal mode: 'wal' (default; lets files import concurrently), 'delete', 'truncate', 'memory' or 'off'")
+	rootCmd.Flags().String("synchronous", "", "How often SQLite waits for writes to reach the disk: 'off', 'normal' (default), 'full' or 'extra'")
+	rootCmd.Flags().String("temp-store", "", "Where SQLite keeps temporary data for large sorts and groupings: 'memory' or 'file' (default: SQLite's, usually files in the temp directory)")
+	rootCmd.Flags().Duration("busy-timeout", 0, "How long to wait for a locked database before failing, e.g. '30s' (default: 5s)")
+	rootCmd.Flags().StringSlice("encoding", []string{}, "Input character encoding(s), e.g. 'latin1'; one for all files or comma-separated per file (default: utf-8, or UTF-16 when the file starts with its byte order mark)")
 }
 
 // Execute runs the root command.
@@ -112,16 +196,87 @@ func runCommand(cmd *cobra.Command, args []string) error {
 
 	// Get flags
 	inputFiles, _ := cmd.Flags().GetStringSlice("input")
+	commands, _ := cmd.Flags().GetStringArray("cmd")
 	tableNames, _ := cmd.Flags().GetStringSlice("table")
 	outputFilesRaw, _ := cmd.Flags().GetStringSlice("output")
-	queries, _ := cmd.Flags().GetStringSlice("query")
+	queryEnvs, _ := cmd.Flags().GetStringArray("query-env")
+	selectColumns, _ := cmd.Flags().GetStringSlice("select")
+	where, _ := cmd.Flags().GetString("where")
+	orderBy, _ := cmd.Flags().GetString("order-by")
 	dbPath, _ := cmd.Flags().GetString("db")
+	replaceDB, _ := cmd.Flags().GetBool("replace-db")
+	quietTempDB, _ := cmd.Flags().GetBool("no-temp-cleanup-message")
 	hasHeader, _ := cmd.Flags().GetBool("header")
+	columnNames, _ := cmd.Flags().GetStringSlice("columns")
+	headerOnly, _ := cmd.Flags().GetBool("header-only")
 	delimiterStr, _ := cmd.Flags().GetString("delimiter")
+	multiDelimiter, _ := cmd.Flags().GetString("multi-delimiter")
+	tryDelimiters, _ := cmd.Flags().GetString("try-delimiters")
+	explainDelimiter, _ := cmd.Flags().GetInt("explain-delimiter")
+	checkSchemaOnly, _ := cmd.Flags().GetBool("check-schema")
+	recordSep, _ := cmd.Flags().GetString("record-sep")
+	skipLines, _ := cmd.Flags().GetInt("skip-lines")
+	commentChar, _ := cmd.Flags().GetString("comment-char")
+	fieldSep, _ := cmd.Flags().GetString("field-sep")
+	outputDelimiter, _ := cmd.Flags().GetString("delimiter-out")
 	traceFile, _ := cmd.Flags().GetString("trace")
 	traceDebug, _ := cmd.Flags().GetBool("trace-debug")
+	cpuProfile, _ := cmd.Flags().GetString("cpuprofile")
+	memProfile, _ := cmd.Flags().GetString("memprofile")
 	showProgress, _ := cmd.Flags().GetBool("progress")
-	indexColumns, _ := cmd.Flags().GetStringSlice("index")
+	indexSpecs, _ := cmd.Flags().GetStringArray("index")
+	uniqueIndexSpecs, _ := cmd.Flags().GetStringArray("unique-index")
+	jsonIndexSpecs, _ := cmd.Flags().GetStringArray("json-index")
+	attachSpecs, _ := cmd.Flags().GetStringArray("attach")
+	encodings, _ := cmd.Flags().GetStringSlice("encoding")
+	strict, _ := cmd.Flags().GetBool("strict")
+	columnCase, _ := cmd.Flags().GetString("case-columns")
+	extraColumns, _ := cmd.Flags().GetString("extra-columns")
+	strictColumns, _ := cmd.Flags().GetBool("strict-columns")
+	lineRange, _ := cmd.Flags().GetString("line-range")
+	squeezeSpaces, _ := cmd.Flags().GetBool("squeeze-spaces")
+	dropEmptyColumns, _ := cmd.Flags().GetBool("drop-empty-columns")
+	inferTypes, _ := cmd.Flags().GetInt("infer-types")
+	failOnTypeMismatch, _ := cmd.Flags().GetBool("fail-on-type-mismatch")
+	onConflict, _ := cmd.Flags().GetString("on-conflict")
+	preserveHeaders, _ := cmd.Flags().GetBool("preserve-original-headers")
+	versionTables, _ := cmd.Flags().GetBool("version-tables")
+	resume, _ := cmd.Flags().GetBool("resume")
+	appendRows, _ := cmd.Flags().GetBool("append")
+	readOnlyQuery, _ := cmd.Flags().GetBool("read-only-query")
+	busyTimeout, _ := cmd.Flags().GetDuration("busy-timeout")
+	tempStore, _ := cmd.Flags().GetString("temp-store")
+	journalMode, _ := cmd.Flags().GetString("journal-mode")
+	synchronous, _ := cmd.Flags().GetString("synchronous")
+	stdinTable, _ := cmd.Flags().GetString("stdin-table")
+	importConcurrency, _ := cmd.Flags().GetInt("import-concurrency")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	compat, _ := cmd.Flags().GetString("compat")
+	nullsOrder, _ := cmd.Flags().GetString("nulls")
+	sortOutput, _ := cmd.Flags().GetString("sort-output")
+	manifestPath, _ := cmd.Flags().GetString("manifest")
+	emitMetadata, _ := cmd.Flags().GetBool("emit-metadata")
+	preview, _ := cmd.Flags().GetInt("preview")
+	estimate, _ := cmd.Flags().GetInt("estimate")
+	timing, _ := cmd.Flags().GetBool("timing")
+	countOnly, _ := cmd.Flags().GetBool("count-only")
+	scalar, _ := cmd.Flags().GetBool("scalar")
+	failIfEmpty, _ := cmd.Flags().GetBool("fail-if-empty")
+	appendOutput, _ := cmd.Flags().GetBool("append-output")
+	noHeaderOut, _ := cmd.Flags().GetBool("no-header-out")
+	rotateBytes, _ := cmd.Flags().GetString("rotate-bytes")
+	jsonKey, _ := cmd.Flags().GetString("json-key")
+	outputFormat, _ := cmd.Flags().GetString("format")
+	maxRows, _ := cmd.Flags().GetInt("max-rows")
+	binarySafe, _ := cmd.Flags().GetBool("binary-safe")
+	binaryEncoding, _ := cmd.Flags().GetString("binary-encoding")
+	nanToken, _ := cmd.Flags().GetString("replace-nan")
+	floatFormat, _ := cmd.Flags().GetString("float-format")
+	nullStrings, _ := cmd.Flags().GetStringArray("null-string")
+	nullOutput, _ := cmd.Flags().GetString("null-output")
+	valueMapSpecs, _ := cmd.Flags().GetStringArray("map")
+	valueMapFiles, _ := cmd.Flags().GetStringSlice("map-file")
+	withFile, _ := cmd.Flags().GetString("with-file")
 
 	// Parse comma-separated output files
 	var outputFiles []string
@@ -136,19 +291,135 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Handle stdin: if -i is omitted but queries are provided, treat as stdin input
-	if len(inputFiles) == 0 && len(queries) > 0 {
-		inputFiles = []string{"-"}
+	// A query read from stdin leaves no stdin to import
+	stdinQuery := readsStdin(querySources)
+	for _, inputFile := range inputFiles {
+		if stdinQuery && (inputFile == "-" || inputFile == "") {
+			return fmt.Errorf("--query-file - cannot be used when stdin is read as an input")
+		}
+	}
+	queries, err := resolveQueries(querySources)
+	if err != nil {
+		return err
+	}
+	envQueries, err := queriesFromEnv(queryEnvs)
+	if err != nil {
+		return err
+	}
+	queries = append(queries, envQueries...)
+
+	// --select, --where and --order-by stand in for a query when deciding
+	// whether to read stdin
+	shortcuts := selectColumns
+	for _, shortcut := range []string{where, orderBy} {
+		if shortcut != "" {
+			shortcuts = append(shortcuts, shortcut)
+		}
+	}
+	if !stdinQuery {
+		inputFiles, err = defaultInputs(inputFiles, commands, append(queries, shortcuts...), dbPath)
+		if err != nil {
+			return err
+		}
+	} else if len(inputFiles) == 0 && len(commands) == 0 && dbPath == "" {
+		return fmt.Errorf("no input provided; pass -i (or -d to query an existing database), as --query-file - reads the query from stdin")
 	}
 
 	cfg.InputFiles = inputFiles
+	cfg.Commands = commands
 	cfg.TableNames = tableNames
+	cfg.StdinTable = stdinTable
 	cfg.OutputFiles = outputFiles
 	cfg.SQLQueries = queries
+	for _, column := range selectColumns {
+		if column = strings.TrimSpace(column); column != "" {
+			cfg.Select = append(cfg.Select, column)
+		}
+	}
+	cfg.Where = strings.TrimSpace(where)
+	if orderBy != "" {
+		if cfg.OrderBy, err = query.ParseSortKeys(orderBy); err != nil {
+			return err
+		}
+	}
 	cfg.DBPath = dbPath
 	cfg.HasHeader = hasHeader
+	if len(columnNames) > 0 {
+		cfg.ColumnNames = columnNames
+	}
+	cfg.HeaderOnly = headerOnly
 	cfg.KeepDB = cmd.Flags().Changed("db")
-	cfg.IndexColumns = indexColumns
+	cfg.ReplaceDB = replaceDB
+	cfg.QuietTempDB = quietTempDB
+	for _, spec := range attachSpecs {
+		attachment, err := database.ParseAttachment(spec)
+		if err != nil {
+			return err
+		}
+		cfg.Attachments = append(cfg.Attachments, attachment)
+	}
+	for _, spec := range jsonIndexSpecs {
+		index, err := database.ParseJSONIndex(spec)
+		if err != nil {
+			return err
+		}
+		cfg.JSONIndexes = append(cfg.JSONIndexes, index)
+	}
+	if lineRange != "" {
+		if cfg.LineRange, err = importer.ParseLineRange(lineRange); err != nil {
+			return err
+		}
+	}
+	cfg.Encodings = encodings
+	cfg.Strict = strict
+	cfg.ColumnCase = strings.ToLower(columnCase)
+	cfg.ExtraColumns = strings.ToLower(extraColumns)
+	cfg.StrictColumns = strictColumns
+	cfg.SqueezeSpaces = squeezeSpaces
+	cfg.DropEmptyCols = dropEmptyColumns
+	cfg.InferTypes = inferTypes
+	cfg.FailOnTypeMismatch = failOnTypeMismatch
+	cfg.OnConflict = strings.ToLower(onConflict)
+	cfg.PreserveHeaders = preserveHeaders
+	cfg.VersionTables = versionTables
+	cfg.Resume = resume
+	cfg.Append = appendRows
+	cfg.ReadOnlyQuery = readOnlyQuery
+	cfg.BusyTimeout = busyTimeout
+	cfg.TempStore = strings.ToLower(tempStore)
+	cfg.JournalMode = strings.ToLower(journalMode)
+	cfg.Synchronous = strings.ToLower(synchronous)
+	cfg.ImportJobs = importConcurrency
+	cfg.BatchSize = batchSize
+	cfg.Compat = strings.ToLower(compat)
+	cfg.NullsOrder = strings.ToLower(nullsOrder)
+	cfg.ManifestPath = manifestPath
+	cfg.EmitMetadata = emitMetadata
+	cfg.Preview = preview
+	cfg.Estimate = estimate
+	cfg.Timing = timing
+	cfg.ExplainDelim = explainDelimiter
+	cfg.CheckSchema = checkSchemaOnly
+	cfg.CountOnly = countOnly
+	cfg.Scalar = scalar
+	cfg.FailIfEmpty = failIfEmpty
+	cfg.AppendOutput = appendOutput
+	cfg.NoHeaderOut = noHeaderOut
+	if rotateBytes != "" {
+		if cfg.RotateBytes, err = config.ParseByteSize(rotateBytes); err != nil {
+			return fmt.Errorf("--rotate-bytes: %w", err)
+		}
+	}
+	cfg.JSONKey = jsonKey
+	cfg.OutputFormat = strings.ToLower(outputFormat)
+	cfg.MaxRows = maxRows
+	cfg.BinarySafe = binarySafe
+	cfg.BinaryEncoding = strings.ToLower(binaryEncoding)
+	cfg.ReplaceNaN = cmd.Flags().Changed("replace-nan")
+	cfg.FloatFormat = floatFormat
+	cfg.NaNToken = nanToken
+	cfg.NullStrings = nullStrings
+	cfg.NullOutput = nullOutput
 
 	// Parse delimiter
 	delimiter, err := config.ParseDelimiter(delimiterStr)
@@ -156,10 +427,77 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	cfg.Delimiter = delimiter
+	cfg.MultiDelimiter = multiDelimiter
+	if tryDelimiters != "" {
+		if delimiter != 0 || multiDelimiter != "" || fieldSep != "" {
+			return fmt.Errorf("--try-delimiters cannot be combined with --delimiter, --multi-delimiter or --field-sep")
+		}
+		if cfg.TryDelimiters, err = config.ParseDelimiterList(tryDelimiters); err != nil {
+			return err
+		}
+	}
+	if fieldSep != "" {
+		if multiDelimiter != "" {
+			return fmt.Errorf("--field-sep and --multi-delimiter cannot be used together")
+		}
+		if cfg.MultiDelimiter, err = config.ParseSeparator(fieldSep); err != nil {
+			return err
+		}
+	}
+	if recordSep != "" {
+		if cfg.RecordSep, err = config.ParseSeparator(recordSep); err != nil {
+			return err
+		}
+	}
+	cfg.SkipLines = skipLines
+	if commentChar != "" {
+		if utf8.RuneCountInString(commentChar) != 1 {
+			return fmt.Errorf("--comment-char must be a single character, got %q", commentChar)
+		}
+		cfg.CommentChar, _ = utf8.DecodeRuneInString(commentChar)
+	}
+	cfg.OutputDelimiter = outputDelimiter
+
+	if sortOutput != "" {
+		if cfg.SortKeys, err = query.ParseSortKeys(sortOutput); err != nil {
+			return err
+		}
+	}
+
+	if withFile != "" {
+		content, err := os.ReadFile(withFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CTE file: %w", err)
+		}
+		cfg.CTEs, err = query.ParseCTEs(string(content))
+		if err != nil {
+			return fmt.Errorf("invalid CTE file %s: %w", withFile, err)
+		}
+	}
+
+	// Parse index columns, global and per table
+	cfg.IndexColumns, cfg.TableIndexes, err = config.ParseIndexSpecs(indexSpecs)
+	if err != nil {
+		return err
+	}
+	cfg.UniqueIndexes, cfg.TableUniques, err = config.ParseIndexSpecs(uniqueIndexSpecs)
+	if err != nil {
+		return fmt.Errorf("--unique-index: %w", err)
+	}
 
-	// If stdin is used and delimiter is auto, default to comma
-	if len(inputFiles) > 0 && (inputFiles[0] == "-" || inputFiles[0] == "") && delimiter == 0 {
-		cfg.Delimiter = ','
+	// Parse value mappings; files are applied first so --map can override them
+	if len(valueMapSpecs) > 0 || len(valueMapFiles) > 0 {
+		cfg.ValueMaps = make(map[string]map[string]string)
+		for _, path := range valueMapFiles {
+			if err := config.ReadValueMapFile(path, cfg.ValueMaps); err != nil {
+				return err
+			}
+		}
+		for _, spec := range valueMapSpecs {
+			if err := config.ParseValueMap(spec, cfg.ValueMaps); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Validate inputs
@@ -167,6 +505,13 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Keep stdout for the value itself so it can be captured by the shell
+	if cfg.Scalar {
+		origOutput := color.Output
+		color.Output = color.Error
+		defer func() { color.Output = origOutput }()
+	}
+
 	// Setup trace if requested
 	if traceFile != "" {
 		f, err := os.Create(traceFile)
@@ -182,260 +527,187 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		infoColor.Printf("Tracing execution to %s (use 'go tool trace %s' to view)\n", traceFile, traceFile)
 	}
 
-	return run(cfg, traceDebug, showProgress)
+	// Setup profiles if requested
+	stopProfiles, err := startProfiles(cpuProfile, memProfile)
+	if err != nil {
+		return err
+	}
+	if cpuProfile != "" {
+		infoColor.Printf("Writing CPU profile to %s (use 'go tool pprof %s' to view)\n", cpuProfile, cpuProfile)
+	}
+
+	runErr := run(cfg, traceDebug, showProgress)
+	if err := stopProfiles(); err != nil && runErr == nil {
+		return err
+	}
+	return runErr
 }
 
 func run(cfg *config.Config, traceDebug, showProgress bool) error {
+	start := time.Now()
+
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		return err
 	}
 
+	warn := &warner{strict: cfg.Strict}
+	if err := checkOutputDelimiter(cfg, warn); err != nil {
+		return err
+	}
+
+	// Diagnose the inputs' delimiters instead of importing them
+	if cfg.ExplainDelim > 0 {
+		return explainDelimiters(cfg, os.Stdout)
+	}
+
+	// Compare the inputs' headers with the existing tables instead of importing them
+	if cfg.CheckSchema {
+		db, err := openDatabase(cfg)
+		if err != nil {
+			return err
+		}
+		defer closeDatabase(db, cfg)
+		return checkSchema(db, cfg, warn, os.Stdout)
+	}
+
 	// Show ASCII art at the start if we have input files
 	if len(cfg.InputFiles) > 0 && isTerminal() {
 		PrintASCIIArt()
 	}
 
-	// Open database
-	db, err := database.Open(cfg.DBPath)
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		db.DB.Close()
-		if db.ShouldCleanup {
-			if err := db.Cleanup(); err != nil {
-				warnColor.Fprintf(os.Stderr, "Warning: %v\n", err)
-			} else {
-				infoColor.Printf("Cleaned up temporary database\n")
-			}
-		}
-	}()
-
-	if db.IsTemp {
-		infoColor.Printf("Using temporary database: %s\n", db.Path)
-	} else {
-		infoColor.Printf("Opening database: %s\n", db.Path)
-	}
+	defer closeDatabase(db, cfg)
 
 	// Import CSV/TSV files into SQLite (concurrently)
-	if len(cfg.InputFiles) > 0 {
-		// Check if any input is stdin
-		hasStdin := false
-		for _, inputFile := range cfg.InputFiles {
-			if inputFile == "-" || inputFile == "" {
-				hasStdin = true
-				break
-			}
-		}
-
-		// Build file inputs for concurrent import
-		inputs := make([]importer.FileInput, len(cfg.InputFiles))
-		for i, inputFile := range cfg.InputFiles {
-			// Determine delimiter for this file if auto
-			delimiter := cfg.Delimiter
-			if delimiter == 0 {
-				delimiter = importer.DetectDelimiter(inputFile)
-			}
+	imported, err := importInputs(db, cfg, warn, traceDebug, showProgress)
+	if err != nil {
+		return err
+	}
 
-			// Determine table name
-			tableName := "data"
-			if i < len(cfg.TableNames) {
-				tableName = cfg.TableNames[i]
-			} else if i > 0 {
-				tableName = fmt.Sprintf("data%d", i+1)
-			}
+	// --attach files only join the queries, so that an import can never
+	// replace one of their tables
+	if err := db.AttachDatabases(); err != nil {
+		return err
+	}
 
-			inputs[i] = importer.FileInput{
-				FilePath:     inputFile,
-				TableName:    tableName,
-				Delimiter:    delimiter,
-				HasHeader:    cfg.HasHeader,
-				IndexColumns: cfg.IndexColumns,
+	if cfg.Preview > 0 {
+		for _, result := range imported {
+			if err := previewTable(os.Stderr, db.DB, result.TableName, cfg.Preview); err != nil {
+				return err
 			}
 		}
+	}
 
-		// Import all files concurrently with progress reporting
-		// Disable progress bars for stdin (no file path to track)
-		var tracker *ProgressTracker
-		if showProgress && isTerminal() && !hasStdin {
-			tracker = NewProgressTracker(true)
-		} else {
-			tracker = NewProgressTracker(false)
+	// Build the --select/--where/--order-by query now that the table's
+	// columns are known
+	if cfg.ShortcutQuery() {
+		sqlQuery, err := selectQuery(db, cfg, imported)
+		if err != nil {
+			return err
 		}
+		// Copy so that the caller's config still validates if run again
+		shortcut := *cfg
+		shortcut.SQLQueries = []string{sqlQuery}
+		cfg = &shortcut
+	}
 
-		var mu sync.Mutex
-		isStdin := func(path string) bool {
-			return path == "-" || path == ""
+	// Execute SQL queries and export results
+	results := make([]*exporter.Result, len(cfg.SQLQueries))
+	queryTimings := make([]phaseTiming, len(cfg.SQLQueries))
+	if len(cfg.SQLQueries) > 0 {
+		if len(cfg.OutputFiles) > 0 && len(cfg.SQLQueries) > 1 && len(cfg.OutputFiles) != len(cfg.SQLQueries) {
+			// This should be caught by Validate(), but check here for safety
+			return fmt.Errorf("number of output files (%d) must match number of queries (%d)", len(cfg.OutputFiles), len(cfg.SQLQueries))
 		}
-		progressCallback := func(event string, filePath, tableName string, details ...interface{}) {
-			mu.Lock()
-			defer mu.Unlock()
 
-			switch event {
-			case "parse_start":
-				// Skip progress output for stdin
-				if isStdin(filePath) {
-					// Silent for stdin
-					break
-				}
-				switch {
-				case !showProgress || !isTerminal():
-					infoColor.Printf("  [→] Parsing & writing %s → table '%s' (streaming)...\n", filePath, tableName)
-				default:
-					tracker.StartParse(filePath, tableName)
-				}
-			case "parse_complete":
-				rowCount := details[0].(int)
-				duration := details[1].(time.Duration)
-				// Skip progress output for stdin
-				if isStdin(filePath) {
-					// Silent for stdin
-					break
-				}
-				switch {
-				case !showProgress || !isTerminal():
-					infoColor.Printf("  [✓] Completed streaming %s (%d rows parsed & written) in %v\n", filePath, rowCount, duration.Round(time.Millisecond))
-				default:
-					tracker.FinishParse(filePath, int64(rowCount), duration)
-				}
-			case "parse_error":
-				err := details[0].(error)
-				if !showProgress || !isTerminal() {
-					warnColor.Printf("  [✗] Parse failed: %s - %v\n", filePath, err)
-				} else {
-					tracker.Error(filePath, err, "Parse")
-				}
-			case "write_start":
-				rowCount := int64(0)
-				if len(details) > 0 {
-					switch rc := details[0].(type) {
-					case int:
-						rowCount = int64(rc)
-					case int64:
-						rowCount = rc
-					}
-				}
-				// Skip progress output for stdin
-				if isStdin(filePath) {
-					// Silent for stdin
-					break
-				}
-				switch {
-				case !showProgress || !isTerminal():
-					infoColor.Printf("  [→] Writing %s to database...\n", filePath)
-				default:
-					tracker.StartWrite(filePath, tableName, rowCount)
-				}
-			case "write_complete":
-				rowCount := details[0].(int)
-				// Skip progress output for stdin
-				if isStdin(filePath) {
-					// Silent for stdin
-					break
-				}
-				switch {
-				case !showProgress || !isTerminal():
-					infoColor.Printf("  [✓] Imported %d rows into '%s'\n", rowCount, tableName)
-					successColor.Printf("✓ Successfully imported table '%s'\n", tableName)
-				default:
-					tracker.FinishWrite(filePath, tableName, int64(rowCount))
-				}
-			case "write_error":
-				err := details[0].(error)
-				if !showProgress || !isTerminal() {
-					warnColor.Printf("  [✗] Write failed: %s - %v\n", filePath, err)
-				} else {
-					tracker.Error(filePath, err, "Write")
-				}
-			case "index_start":
-				indexCols := details[0].([]string)
-				if !showProgress || !isTerminal() {
-					infoColor.Printf("  [→] Creating %d index(es) on '%s'...\n", len(indexCols), tableName)
-				} else {
-					tracker.StartIndex(filePath, tableName, len(indexCols))
-				}
-			case "index_complete":
-				indexCount := details[0].(int)
-				duration := details[1].(time.Duration)
-				if !showProgress || !isTerminal() {
-					successColor.Printf("  [✓] Created %d index(es) on '%s' in %v\n", indexCount, tableName, duration.Round(time.Millisecond))
-				} else {
-					tracker.FinishIndex(filePath, tableName, indexCount, duration)
-				}
-			case "index_error":
-				err := details[0].(error)
-				if !showProgress || !isTerminal() {
-					warnColor.Printf("  [✗] Index creation failed on '%s': %v\n", tableName, err)
-				} else {
-					tracker.Error(filePath, err, "index")
-				}
+		// Check if any queries write to stdout (can't be concurrent)
+		hasStdout := len(cfg.OutputFiles) == 0
+		for _, outputFile := range cfg.OutputFiles {
+			if outputFile == "" {
+				hasStdout = true
+				break
 			}
 		}
 
-		parseProgressCallback := func(filePath string, rowsRead int64) {
-			// Skip progress updates for stdin
-			if (filePath != "-" && filePath != "") && showProgress && isTerminal() {
-				tracker.UpdateParse(filePath, rowsRead)
+		// Check sort columns before running any query, so none writes partial output
+		if len(cfg.SortKeys) > 0 {
+			for i, sqlQuery := range cfg.SQLQueries {
+				if err := checkSortColumns(db, cfg, sqlQuery); err != nil {
+					return fmt.Errorf("query %d: %w", i+1, err)
+				}
 			}
 		}
 
-		writeProgressCallback := func(filePath string, rowsWritten int64) {
-			// Skip progress updates for stdin
-			if (filePath != "-" && filePath != "") && showProgress && isTerminal() {
-				tracker.UpdateWrite(filePath, rowsWritten)
+		if cfg.Estimate > 0 {
+			for i, sqlQuery := range cfg.SQLQueries {
+				estimateQuery(os.Stderr, db.DB, fmt.Sprintf("query %d", i+1), prepareQuery(cfg, sqlQuery), int64(cfg.Estimate))
 			}
 		}
 
-		results, err := importer.ImportConcurrent(db.DB, inputs, traceDebug, progressCallback, parseProgressCallback, writeProgressCallback)
-
-		// Stop progress tracker render loop
-		tracker.Stop()
-
-		if err != nil {
-			warnColor.Fprintf(os.Stderr, "Warning: some imports failed:\n%v\n", err)
+		// Delimiter 0 (auto) lets the exporter detect it from each output's extension
+		exportOpts := exporter.Options{
+			Delimiter:   cfg.ExportDelimiter(),
+			QueryOnly:   cfg.ReadOnlyQuery,
+			Append:      cfg.AppendOutput,
+			NoHeader:    cfg.NoHeaderOut,
+			JSONKey:     cfg.JSONKey,
+			NullOutput:  cfg.NullOutput,
+			RotateBytes: cfg.RotateBytes,
+			FloatFormat: cfg.FloatFormat,
+			MaxRows:     cfg.MaxRows,
 		}
-
-		// If all imports failed, return the error
-		if len(results) == 0 && err != nil {
-			return fmt.Errorf("all imports failed: %w", err)
+		if cfg.OutputFormat == exporter.FormatTable && isTerminal() {
+			exportOpts.Format = exporter.FormatTable
 		}
-	}
-
-	// Execute SQL queries and export results
-	if len(cfg.SQLQueries) > 0 {
-		// Determine output files - use provided outputs or default to stdout for each
-		outputFiles := cfg.OutputFiles
-		if len(outputFiles) == 0 {
-			// No outputs provided, all queries write to stdout
-			outputFiles = make([]string, len(cfg.SQLQueries))
-			for i := range outputFiles {
-				outputFiles[i] = "" // Empty string means stdout
-			}
-		} else if len(outputFiles) != len(cfg.SQLQueries) {
-			// This should be caught by Validate(), but check here for safety
-			return fmt.Errorf("number of output files (%d) must match number of queries (%d)", len(outputFiles), len(cfg.SQLQueries))
+		if cfg.ReplaceNaN {
+			exportOpts.ReplaceNaN = true
+			exportOpts.NaNToken = cfg.NaNToken
 		}
-
-		// Check if any queries write to stdout (can't be concurrent)
-		hasStdout := false
-		for _, outputFile := range outputFiles {
-			if outputFile == "" {
-				hasStdout = true
-				break
+		if cfg.BinarySafe {
+			exportOpts.BinaryEncoding = cfg.BinaryEncoding
+			if exportOpts.BinaryEncoding == "" {
+				exportOpts.BinaryEncoding = exporter.BinaryBase64
 			}
 		}
 
-		if hasStdout || len(cfg.SQLQueries) == 1 {
-			// Sequential execution for stdout or single query
-			for i, query := range cfg.SQLQueries {
-				outputFile := outputFiles[i]
-
-				// Determine delimiter for this output
-				outputDelimiter := cfg.Delimiter
-				if outputDelimiter == 0 {
-					outputDelimiter = exporter.DetectOutputDelimiter(outputFile)
+		if cfg.CountOnly {
+			// Count-only runs write no outputs, so queries simply run in order
+			for i, sqlQuery := range cfg.SQLQueries {
+				opts := exportOpts
+				opts.QueryIndex = i + 1
+				queryStart := time.Now()
+				count, err := exporter.CountRows(db.DB, prepareQuery(cfg, sqlQuery), opts)
+				if err != nil {
+					return fmt.Errorf("failed to execute query %d: %w", i+1, err)
+				}
+				queryTimings[i] = queryTiming(i, queryStart, count)
+				if len(cfg.SQLQueries) > 1 {
+					successColor.Printf("✓ Query %d: %d rows\n", i+1, count)
+				} else {
+					successColor.Printf("✓ Query returned %d rows\n", count)
+				}
+			}
+		} else if cfg.Scalar {
+			for i, sqlQuery := range cfg.SQLQueries {
+				opts := exportOpts
+				opts.QueryIndex = i + 1
+				queryStart := time.Now()
+				value, err := exporter.QueryScalar(db.DB, prepareQuery(cfg, sqlQuery), opts)
+				if err != nil {
+					return fmt.Errorf("failed to execute query %d: %w", i+1, err)
 				}
+				queryTimings[i] = queryTiming(i, queryStart, 1)
+				fmt.Fprintln(os.Stdout, value)
+			}
+		} else if hasStdout || len(cfg.SQLQueries) == 1 {
+			// Sequential execution for stdout or single query
+			for i, sqlQuery := range cfg.SQLQueries {
+				outputFiles := cfg.OutputsFor(i)
+				toFile := outputFiles[0] != ""
 
 				// Show which query is being executed
 				if len(cfg.SQLQueries) > 1 {
@@ -444,15 +716,23 @@ func run(cfg *config.Config, traceDebug, showProgress bool) error {
 					infoColor.Printf("Executing query...\n")
 				}
 
-				result, err := exporter.Execute(db.DB, query, outputFile, outputDelimiter)
+				opts := exportOpts
+				opts.QueryIndex = i + 1
+				queryStart := time.Now()
+				result, err := exporter.ExecuteToFiles(db.DB, prepareQuery(cfg, sqlQuery), outputFiles, opts)
 				if err != nil {
 					return fmt.Errorf("failed to execute query %d: %w", i+1, err)
 				}
-				infoColor.Printf("  Exported %d rows\n", result.RowCount)
-				if outputFile != "" {
-					successColor.Printf("✓ Query %d results exported to %s\n", i+1, outputFile)
-				} else if len(cfg.SQLQueries) > 1 {
-					successColor.Printf("✓ Query %d results written to stdout\n", i+1)
+				results[i] = result
+				queryTimings[i] = queryTiming(i, queryStart, result.RowCount)
+				if toFile {
+					infoColor.Printf("  %s, %s\n", exportedRows(result), fmtBytes(result.BytesWritten))
+					successColor.Printf("✓ Query %d results exported to %s\n", i+1, outputPaths(result))
+				} else {
+					infoColor.Printf("  %s\n", exportedRows(result))
+					if len(cfg.SQLQueries) > 1 {
+						successColor.Printf("✓ Query %d results written to stdout\n", i+1)
+					}
 				}
 			}
 		} else {
@@ -461,22 +741,19 @@ func run(cfg *config.Config, traceDebug, showProgress bool) error {
 			var queryMu sync.Mutex
 			var queryErrs []error
 
-			for i, query := range cfg.SQLQueries {
+			for i, sqlQuery := range cfg.SQLQueries {
 				queryWg.Add(1)
-				go func(queryIdx int, q string, outFile string) {
+				go func(queryIdx int, q string, outFiles []string) {
 					defer queryWg.Done()
 
-					// Determine delimiter for this output
-					outputDelimiter := cfg.Delimiter
-					if outputDelimiter == 0 {
-						outputDelimiter = exporter.DetectOutputDelimiter(outFile)
-					}
-
 					queryMu.Lock()
 					infoColor.Printf("Executing query %d/%d...\n", queryIdx+1, len(cfg.SQLQueries))
 					queryMu.Unlock()
 
-					result, err := exporter.Execute(db.DB, q, outFile, outputDelimiter)
+					opts := exportOpts
+					opts.QueryIndex = queryIdx + 1
+					queryStart := time.Now()
+					result, err := exporter.ExecuteToFiles(db.DB, prepareQuery(cfg, q), outFiles, opts)
 					if err != nil {
 						queryMu.Lock()
 						queryErrs = append(queryErrs, fmt.Errorf("query %d: %w", queryIdx+1, err))
@@ -485,10 +762,12 @@ func run(cfg *config.Config, traceDebug, showProgress bool) error {
 					}
 
 					queryMu.Lock()
-					infoColor.Printf("  Exported %d rows\n", result.RowCount)
-					successColor.Printf("✓ Query %d results exported to %s\n", queryIdx+1, outFile)
+					results[queryIdx] = result
+					queryTimings[queryIdx] = queryTiming(queryIdx, queryStart, result.RowCount)
+					infoColor.Printf("  %s, %s\n", exportedRows(result), fmtBytes(result.BytesWritten))
+					successColor.Printf("✓ Query %d results exported to %s\n", queryIdx+1, outputPaths(result))
 					queryMu.Unlock()
-				}(i, query, outputFiles[i])
+				}(i, sqlQuery, cfg.OutputsFor(i))
 			}
 
 			queryWg.Wait()
@@ -499,5 +778,583 @@ func run(cfg *config.Config, traceDebug, showProgress bool) error {
 		}
 	}
 
+	// A file with only a header usually means a wrong filter or table name
+	emptyWarn := &warner{strict: cfg.FailIfEmpty}
+	for i, result := range results {
+		if result == nil || result.RowCount > 0 {
+			continue
+		}
+		for _, out := range result.Outputs {
+			if out.Path == "" {
+				continue
+			}
+			if err := emptyWarn.Warn("query %d wrote no rows to %s; check its filters and table names", i+1, out.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cfg.ManifestPath != "" {
+		if err := writeManifest(cfg.ManifestPath, results); err != nil {
+			return err
+		}
+		successColor.Printf("✓ Manifest written to %s\n", cfg.ManifestPath)
+	}
+
+	if cfg.EmitMetadata {
+		written, err := writeMetadata(cfg.SQLQueries, results)
+		if err != nil {
+			return err
+		}
+		for _, path := range written {
+			successColor.Printf("✓ Metadata written to %s\n", path)
+		}
+	}
+
+	if cfg.Timing {
+		return writeTimings(os.Stderr, append(importTimings(imported), queryTimings...), time.Since(start))
+	}
+	return nil
+}
+
+// checkOutputDelimiter warns about output files whose extension disagrees
+// with an explicit --delimiter-out, such as a tab-delimited results.csv or a
+// JSON output, which has no delimiter. Output formats otherwise follow the
+// extension, so this is the only way to ask for one the name does not show.
+func checkOutputDelimiter(cfg *config.Config, warn *warner) error {
+	if cfg.OutputDelimiter == "" || cfg.ExportDelimiter() == 0 {
+		return nil
+	}
+	delimiter := cfg.ExportDelimiter()
+	for _, outputFile := range cfg.OutputFiles {
+		name := strings.ToLower(outputFile)
+		for _, compression := range []string{".gz", ".bz2"} {
+			name = strings.TrimSuffix(name, compression)
+		}
+
+		var err error
+		switch ext := filepath.Ext(name); {
+		case exporter.DetectOutputFormat(outputFile) == exporter.FormatJSON:
+			err = warn.Warn("--delimiter-out %s does not apply to JSON output %s", cfg.OutputDelimiter, outputFile)
+		case (ext == ".csv" || ext == ".tsv") && exporter.DetectOutputDelimiter(outputFile) != delimiter:
+			err = warn.Warn("output %s has a %s extension but is written with --delimiter-out %s", outputFile, ext, cfg.OutputDelimiter)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// uniqueIndexColumns returns columns without repeated entries, which would
+// otherwise be skipped silently by CREATE INDEX IF NOT EXISTS. Each repeat,
+// e.g. from -x name,name or from both -x id and -x table:id, is a warning.
+func uniqueIndexColumns(columns []string, tableName string, warn *warner) ([]string, error) {
+	seen := make(map[string]bool, len(columns))
+	unique := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if seen[strings.ToLower(column)] {
+			if err := warn.Warn("index on column '%s' of table '%s' requested more than once", column, tableName); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		seen[strings.ToLower(column)] = true
+		unique = append(unique, column)
+	}
+	return unique, nil
+}
+
+// exportedRows reports how many rows a query wrote, and whether --max-rows
+// cut its results short.
+func exportedRows(result *exporter.Result) string {
+	if result.Truncated {
+		return fmt.Sprintf("Exported %d rows (truncated by --max-rows; the query returned more)", result.RowCount)
+	}
+	return fmt.Sprintf("Exported %d rows", result.RowCount)
+}
+
+// outputPaths lists the files a query's results were written to, including
+// every part of a rotated output.
+func outputPaths(result *exporter.Result) string {
+	paths := make([]string, len(result.Outputs))
+	for i, out := range result.Outputs {
+		paths[i] = out.Path
+	}
+	return strings.Join(paths, ", ")
+}
+
+// queriesFromEnv returns the queries held by the named environment variables.
+// An unset or empty variable is an error rather than a query silently skipped.
+func queriesFromEnv(names []string) ([]string, error) {
+	var queries []string
+	for _, name := range names {
+		sql := strings.TrimSpace(os.Getenv(name))
+		if sql == "" {
+			return nil, fmt.Errorf("--query-env: environment variable %s is not set or empty", name)
+		}
+		queries = append(queries, sql)
+	}
+	return queries, nil
+}
+
+// defaultInputs returns the input files to import. If -i is omitted but
+// queries are provided, stdin is read, unless it is a terminal: nothing would
+// ever arrive and the read would block forever. Queries against an existing
+// database then run without importing anything.
+func defaultInputs(inputFiles, commands, queries []string, dbPath string) ([]string, error) {
+	if len(inputFiles) > 0 || len(commands) > 0 || len(queries) == 0 {
+		return inputFiles, nil
+	}
+	if !stdinIsTerminal() {
+		return []string{"-"}, nil
+	}
+	if dbPath != "" {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("no input provided; pipe data to stdin or pass -i (or -d to query an existing database)")
+}
+
+// prepareQuery applies the configured query rewrites before execution.
+func prepareQuery(cfg *config.Config, sql string) string {
+	sql = query.RewriteCompat(sql, cfg.Compat)
+	sql = query.SortOutput(sql, cfg.SortKeys)
+	sql = query.ApplyNullsOrder(sql, cfg.NullsOrder)
+	return query.PrependCTEs(sql, cfg.CTEs)
+}
+
+// selectQuery builds the query for --select, --where and --order-by: the
+// selected columns (or all) of the rows matching the condition (or all) of
+// the first imported table, or of the first -t table of an existing
+// database, in the given order.
+func selectQuery(db *database.DB, cfg *config.Config, imported []*importer.Result) (string, error) {
+	table := "data"
+	if len(imported) > 0 {
+		table = imported[0].TableName
+	} else if len(cfg.TableNames) > 0 {
+		table = cfg.TableNames[0]
+	}
+	if err := database.ValidateColumns(db.DB, table, cfg.Select); err != nil {
+		return "", fmt.Errorf("--select: %w", err)
+	}
+	orderColumns := make([]string, len(cfg.OrderBy))
+	for i, key := range cfg.OrderBy {
+		orderColumns[i] = key.Column
+	}
+	if err := database.ValidateColumns(db.DB, table, orderColumns); err != nil {
+		return "", fmt.Errorf("--order-by: %w", err)
+	}
+
+	// Columns are named as on import, so --select accepts the original headers
+	quote := func(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` }
+	columns := []string{"*"}
+	if len(cfg.Select) > 0 {
+		columns = make([]string, len(cfg.Select))
+		for i, column := range cfg.Select {
+			columns[i] = quote(database.SanitizeColumnName(column))
+		}
+	}
+	sqlQuery := fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), quote(table))
+	if cfg.Where != "" {
+		sqlQuery += " WHERE " + cfg.Where
+	}
+	if len(cfg.OrderBy) > 0 {
+		terms := make([]string, len(cfg.OrderBy))
+		for i, key := range cfg.OrderBy {
+			terms[i] = quote(database.SanitizeColumnName(key.Column))
+			if key.Desc {
+				terms[i] += " DESC"
+			}
+		}
+		sqlQuery += " ORDER BY " + strings.Join(terms, ", ")
+	}
+	return sqlQuery, nil
+}
+
+// checkSortColumns checks that a query can be sorted by cfg.SortKeys: it
+// must return rows and have every sort column in its result.
+func checkSortColumns(db *database.DB, cfg *config.Config, sql string) error {
+	if !query.Wrappable(sql) {
+		return fmt.Errorf("--sort-output only applies to SELECT, VALUES and WITH queries")
+	}
+
+	// LIMIT 0 reports the result columns without computing any rows
+	probe := "SELECT * FROM (\n" + strings.TrimRight(strings.TrimSpace(sql), ";") + "\n) LIMIT 0"
+	rows, err := db.DB.Query(query.PrependCTEs(query.RewriteCompat(probe, cfg.Compat), cfg.CTEs))
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	for _, key := range cfg.SortKeys {
+		found := false
+		for _, column := range columns {
+			found = found || strings.EqualFold(column, key.Column)
+		}
+		if !found {
+			return fmt.Errorf("sort column '%s' is not in the query results (columns: %s)", key.Column, strings.Join(columns, ", "))
+		}
+	}
+	return nil
+}
+
+// openDatabase opens the configured database, reporting whether it is temporary.
+func openDatabase(cfg *config.Config) (*database.DB, error) {
+	db, err := database.OpenWithOptions(cfg.DBPath, database.Options{
+		BusyTimeout:     cfg.BusyTimeout,
+		Replace:         cfg.ReplaceDB,
+		CompatFunctions: cfg.Compat != "",
+		TempStore:       cfg.TempStore,
+		JournalMode:     cfg.JournalMode,
+		Synchronous:     cfg.Synchronous,
+		Attach:          cfg.Attachments,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !db.IsTemp {
+		infoColor.Printf("Opening database: %s\n", db.Path)
+	} else if !cfg.QuietTempDB {
+		infoColor.Printf("Using temporary database: %s\n", db.Path)
+	}
+	return db, nil
+}
+
+// closeDatabase closes the database and removes it if it is temporary.
+func closeDatabase(db *database.DB, cfg *config.Config) {
+	db.DB.Close()
+	if db.ShouldCleanup {
+		if err := db.Cleanup(); err != nil {
+			warnColor.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else if !cfg.QuietTempDB {
+			infoColor.Printf("Cleaned up temporary database\n")
+		}
+	}
+}
+
+// importInputs imports the configured input files into db concurrently,
+// reporting progress as it goes. Returns the results of successful imports,
+// in input order.
+func importInputs(db *database.DB, cfg *config.Config, warn *warner, traceDebug, showProgress bool) ([]*importer.Result, error) {
+	if len(cfg.InputFiles) == 0 && len(cfg.Commands) == 0 {
+		return nil, nil
+	}
+
+	// Check if any input is stdin
+	hasStdin := false
+	for _, inputFile := range cfg.InputFiles {
+		if inputFile == "-" || inputFile == "" {
+			hasStdin = true
+			break
+		}
+	}
+
+	inputs, err := fileInputs(cfg, warn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Import all files concurrently with progress reporting
+	// Disable progress bars for stdin (no file path to track)
+	var tracker *ProgressTracker
+	if showProgress && isTerminal() && !hasStdin {
+		tracker = NewProgressTracker(true)
+	} else {
+		tracker = NewProgressTracker(false)
+	}
+
+	var mu sync.Mutex
+	isStdin := func(path string) bool {
+		return path == "-" || path == ""
+	}
+	progressCallback := func(event string, filePath, tableName string, details ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch event {
+		case "parse_start":
+			// Skip progress output for stdin
+			if isStdin(filePath) {
+				// Silent for stdin
+				break
+			}
+			switch {
+			case !showProgress || !isTerminal():
+				infoColor.Printf("  [→] Parsing & writing %s → table '%s' (streaming)...\n", filePath, tableName)
+			default:
+				tracker.StartParse(filePath, tableName)
+			}
+		case "parse_complete":
+			rowCount := details[0].(int)
+			duration := details[1].(time.Duration)
+			// Skip progress output for stdin
+			if isStdin(filePath) {
+				// Silent for stdin
+				break
+			}
+			switch {
+			case !showProgress || !isTerminal():
+				infoColor.Printf("  [✓] Completed streaming %s (%d rows parsed & written) in %v\n", filePath, rowCount, duration.Round(time.Millisecond))
+			default:
+				tracker.FinishParse(filePath, int64(rowCount), duration)
+			}
+		case "parse_error":
+			err := details[0].(error)
+			if !showProgress || !isTerminal() {
+				warnColor.Printf("  [✗] Parse failed: %s - %v\n", filePath, err)
+			} else {
+				tracker.Error(filePath, err, "Parse")
+			}
+		case "write_start":
+			rowCount := int64(0)
+			if len(details) > 0 {
+				switch rc := details[0].(type) {
+				case int:
+					rowCount = int64(rc)
+				case int64:
+					rowCount = rc
+				}
+			}
+			// Skip progress output for stdin
+			if isStdin(filePath) {
+				// Silent for stdin
+				break
+			}
+			switch {
+			case !showProgress || !isTerminal():
+				infoColor.Printf("  [→] Writing %s to database...\n", filePath)
+			default:
+				tracker.StartWrite(filePath, tableName, rowCount)
+			}
+		case "write_complete":
+			rowCount := details[0].(int)
+			// Skip progress output for stdin
+			if isStdin(filePath) {
+				// Silent for stdin
+				break
+			}
+			switch {
+			case !showProgress || !isTerminal():
+				infoColor.Printf("  [✓] Imported %d rows into '%s'\n", rowCount, tableName)
+				successColor.Printf("✓ Successfully imported table '%s'\n", tableName)
+			default:
+				tracker.FinishWrite(filePath, tableName, int64(rowCount))
+			}
+		case "write_error":
+			err := details[0].(error)
+			if !showProgress || !isTerminal() {
+				warnColor.Printf("  [✗] Write failed: %s - %v\n", filePath, err)
+			} else {
+				tracker.Error(filePath, err, "Write")
+			}
+		case "index_start":
+			indexCols := details[0].([]string)
+			if !showProgress || !isTerminal() {
+				infoColor.Printf("  [→] Creating %d index(es) on '%s'...\n", len(indexCols), tableName)
+			} else {
+				tracker.StartIndex(filePath, tableName, len(indexCols))
+			}
+		case "index_complete":
+			indexCount := details[0].(int)
+			duration := details[1].(time.Duration)
+			if !showProgress || !isTerminal() {
+				successColor.Printf("  [✓] Created %d index(es) on '%s' in %v\n", indexCount, tableName, duration.Round(time.Millisecond))
+			} else {
+				tracker.FinishIndex(filePath, tableName, indexCount, duration)
+			}
+		case "index_error":
+			err := details[0].(error)
+			if !showProgress || !isTerminal() {
+				warnColor.Printf("  [✗] Index creation failed on '%s': %v\n", tableName, err)
+			} else {
+				tracker.Error(filePath, err, "index")
+			}
+		}
+	}
+
+	parseProgressCallback := func(filePath string, rowsRead int64) {
+		// Skip progress updates for stdin
+		if (filePath != "-" && filePath != "") && showProgress && isTerminal() {
+			tracker.UpdateParse(filePath, rowsRead)
+		}
+	}
+
+	writeProgressCallback := func(filePath string, rowsWritten int64) {
+		// Skip progress updates for stdin
+		if (filePath != "-" && filePath != "") && showProgress && isTerminal() {
+			tracker.UpdateWrite(filePath, rowsWritten)
+		}
+	}
+
+	results, err := importer.ImportConcurrentWithLimit(db.DB, inputs, cfg.ImportJobs, traceDebug, progressCallback, parseProgressCallback, writeProgressCallback)
+
+	// Stop progress tracker render loop
+	tracker.Stop()
+
+	if err != nil {
+		if warnErr := warn.Warn("some imports failed:\n%v", err); warnErr != nil {
+			return nil, warnErr
+		}
+	}
+
+	// If all imports failed, return the error
+	if len(results) == 0 && err != nil {
+		return nil, fmt.Errorf("all imports failed: %w", err)
+	}
+
+	// ImportConcurrentWithLimit returns results in completion order
+	position := make(map[string]int, len(inputs))
+	for i := len(inputs) - 1; i >= 0; i-- {
+		position[strings.ToLower(inputs[i].TableName)] = i
+	}
+	sort.SliceStable(results, func(a, b int) bool {
+		return position[strings.ToLower(results[a].TableName)] < position[strings.ToLower(results[b].TableName)]
+	})
+
+	for _, result := range results {
+		if result.Appended {
+			infoColor.Printf("Appended %d rows to the existing '%s' table\n", result.RowCount, result.TableName)
+		}
+		if result.VersionedAs != "" {
+			infoColor.Printf("Kept the previous '%s' table as '%s'\n", result.TableName, result.VersionedAs)
+		}
+		if len(result.DroppedColumns) > 0 {
+			infoColor.Printf("Dropped empty columns from '%s': %s\n", result.TableName, strings.Join(result.DroppedColumns, ", "))
+		}
+		if result.ResumedAfter > 0 {
+			infoColor.Printf("Resumed '%s' after the %d rows imported by an earlier run\n", result.TableName, result.ResumedAfter)
+		}
+
+		// Ragged rows are imported, but may mean the file was cut or misparsed
+		if result.PaddedRows > 0 {
+			if err := warn.Warn("%d rows of '%s' had fewer fields than the header and were padded with empty values", result.PaddedRows, result.TableName); err != nil {
+				return nil, err
+			}
+		}
+		if result.TruncatedRows > 0 {
+			if err := warn.Warn("%d rows of '%s' had more fields than the header and lost the extra fields (use --extra-columns capture to keep them)", result.TruncatedRows, result.TableName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// fileInputs builds the importer inputs of cfg's input files and, after them,
+// its commands, resolving their delimiters and table names.
+func fileInputs(cfg *config.Config, warn *warner) ([]importer.FileInput, error) {
+	// Command outputs follow the files
+	sources := append(append([]string{}, cfg.InputFiles...), cfg.Commands...)
+	inputs := make([]importer.FileInput, len(sources))
+	for i, inputFile := range sources {
+		var command string
+		if i >= len(cfg.InputFiles) {
+			command = inputFile
+		}
+
+		// Determine delimiter for this file if auto; the importer sniffs that of
+		// stdin, commands and files without a .csv or .tsv extension (0)
+		delimiter := cfg.Delimiter
+		if delimiter == 0 && command == "" {
+			delimiter = importer.ExtensionDelimiter(inputFile)
+		}
+
+		// Files, unlike streams, can be sampled before they are imported
+		if len(cfg.TryDelimiters) > 0 && command == "" && inputFile != "-" && inputFile != "" {
+			sample := importer.FileInput{FilePath: inputFile, Encoding: cfg.EncodingFor(i), SkipLines: cfg.SkipLines, CommentChar: cfg.CommentChar}
+			score, err := importer.ChooseDelimiter(sample, cfg.TryDelimiters, tryDelimiterLines)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", inputFile, err)
+			}
+			delimiter = score.Delimiter
+			infoColor.Printf("Using %s as the delimiter of %s (%.0f%% of %d sampled lines have %d fields)\n", delimiterName(delimiter), inputFile, score.Share*100, score.Lines, score.Fields)
+		}
+
+		// Determine table name
+		tableName := "data"
+		if i < len(cfg.TableNames) {
+			tableName = cfg.TableNames[i]
+		} else if i > 0 {
+			tableName = fmt.Sprintf("data%d", i+1)
+		}
+		if cfg.StdinTable != "" && command == "" && (inputFile == "-" || inputFile == "") {
+			tableName = cfg.StdinTable
+		}
+
+		indexColumns, err := uniqueIndexColumns(cfg.IndexColumnsFor(tableName), tableName, warn)
+		if err != nil {
+			return nil, err
+		}
+		uniqueIndexes, err := uniqueIndexColumns(cfg.UniqueIndexColumnsFor(tableName), tableName, warn)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs[i] = importer.FileInput{
+			FilePath:           inputFile,
+			TableName:          tableName,
+			Delimiter:          delimiter,
+			HasHeader:          cfg.HasHeader,
+			ColumnNames:        cfg.ColumnNames,
+			IndexColumns:       indexColumns,
+			UniqueIndexes:      uniqueIndexes,
+			JSONIndexes:        cfg.JSONIndexes,
+			Encoding:           cfg.EncodingFor(i),
+			MultiDelimiter:     cfg.MultiDelimiter,
+			RecordSeparator:    cfg.RecordSep,
+			SkipLines:          cfg.SkipLines,
+			CommentChar:        cfg.CommentChar,
+			ColumnCase:         cfg.ColumnCase,
+			ExtraColumns:       cfg.ExtraColumns,
+			StrictColumns:      cfg.StrictColumns || cfg.Strict,
+			LineRange:          cfg.LineRange,
+			SqueezeSpaces:      cfg.SqueezeSpaces,
+			DropEmptyCols:      cfg.DropEmptyCols,
+			InferTypes:         cfg.InferTypes,
+			NullStrings:        cfg.NullStrings,
+			BinarySafe:         cfg.BinarySafe,
+			VersionTable:       cfg.VersionTables,
+			Resume:             cfg.Resume,
+			Append:             cfg.Append,
+			BatchSize:          cfg.BatchSize,
+			PreserveHeaders:    cfg.PreserveHeaders,
+			HeaderOnly:         cfg.HeaderOnly,
+			ValueMaps:          cfg.ValueMaps,
+			Command:            command,
+			FailOnTypeMismatch: cfg.FailOnTypeMismatch,
+			OnConflict:         cfg.OnConflict,
+		}
+	}
+
+	// Per-table indexes must name an imported table
+	for _, tableIndexes := range []map[string][]string{cfg.TableIndexes, cfg.TableUniques} {
+		for table := range tableIndexes {
+			found := false
+			for _, input := range inputs {
+				found = found || strings.EqualFold(input.TableName, table)
+			}
+			if !found {
+				return nil, fmt.Errorf("index specified for table '%s', which is not imported", table)
+			}
+		}
+	}
+
+	// Importing two files into the same table silently keeps only one of them
+	tableSources := make(map[string]string)
+	for _, input := range inputs {
+		if prev, ok := tableSources[strings.ToLower(input.TableName)]; ok {
+			if err := warn.Warn("files %s and %s both import into table '%s'", prev, input.FilePath, input.TableName); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tableSources[strings.ToLower(input.TableName)] = input.FilePath
+	}
+	return inputs, nil
+}
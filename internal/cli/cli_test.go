@@ -2,13 +2,23 @@ package cli
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/fatih/color"
+
 	"github.com/yatisql/yatisql-go/internal/config"
+	"github.com/yatisql/yatisql-go/internal/database"
+	"github.com/yatisql/yatisql-go/internal/query"
 )
 
 func TestExecuteHelp(t *testing.T) {
@@ -258,6 +268,283 @@ func TestStdinInput(t *testing.T) {
 	}
 }
 
+func TestSelectColumns(t *testing.T) {
+	testdataPath := findTestdata(t)
+	outputPath := filepath.Join(t.TempDir(), "output.csv")
+
+	cfg := &config.Config{
+		InputFiles:  []string{filepath.Join(testdataPath, "sample.csv")},
+		Select:      []string{"name", "city"},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 11 || lines[0] != "name,city" || lines[1] != "Alice,New York" {
+		t.Errorf("Output = %q, want name,city header and 10 rows starting with Alice,New York", content)
+	}
+
+	cfg = &config.Config{
+		InputFiles: []string{filepath.Join(testdataPath, "sample.csv")},
+		Select:     []string{"name", "zip"},
+		HasHeader:  true,
+		Delimiter:  ',',
+	}
+	if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "columns not found in table 'data': zip") {
+		t.Errorf("run() with unknown column error = %v, want columns not found", err)
+	}
+
+	cfg.Select = []string{"name"}
+	cfg.SQLQueries = []string{"SELECT 1"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+		t.Errorf("Validate() with --select and -q error = %v, want exclusive error", err)
+	}
+}
+
+func TestWhereShortcut(t *testing.T) {
+	testdataPath := findTestdata(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		columns []string
+		want    string
+	}{
+		{"all columns", nil, "id,name,age,city,email\n3,Charlie,35,Chicago,charlie@example.com\n"},
+		{"with select", []string{"name", "age"}, "name,age\nCharlie,35\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(dir, tt.name+".csv")
+			cfg := &config.Config{
+				InputFiles:  []string{filepath.Join(testdataPath, "sample.csv")},
+				Select:      tt.columns,
+				Where:       "CAST(age AS INTEGER) > 30 AND city = 'Chicago'",
+				OutputFiles: []string{outputPath},
+				HasHeader:   true,
+				Delimiter:   ',',
+			}
+			if err := run(cfg, false, false); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			content, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("Output = %q, want %q", content, tt.want)
+			}
+		})
+	}
+
+	cfg := &config.Config{InputFiles: []string{"data.csv"}, Where: "age > 30", SQLQueries: []string{"SELECT 1"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+		t.Errorf("Validate() with --where and -q error = %v, want exclusive error", err)
+	}
+}
+
+func TestOrderByShortcut(t *testing.T) {
+	testdataPath := findTestdata(t)
+	outputPath := filepath.Join(t.TempDir(), "output.csv")
+
+	cfg := &config.Config{
+		InputFiles:  []string{filepath.Join(testdataPath, "sample.csv")},
+		Select:      []string{"name", "age"},
+		Where:       "city LIKE 'San %'",
+		OrderBy:     []query.SortKey{{Column: "age", Desc: true}, {Column: "name"}},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "name,age\nJack,41\nHenry,38\nGrace,29\n"; string(content) != want {
+		t.Errorf("Output = %q, want %q", content, want)
+	}
+
+	cfg.OrderBy = []query.SortKey{{Column: "zip"}}
+	if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "--order-by: columns not found in table 'data': zip") {
+		t.Errorf("run() with unknown sort column error = %v, want columns not found", err)
+	}
+}
+
+func TestStdinTable(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "output.csv")
+
+	// A file comes first, so stdin would otherwise be imported as data2
+	cfg := &config.Config{
+		InputFiles:  []string{filepath.Join(findTestdata(t), "sample.csv"), "-"},
+		StdinTable:  "orders",
+		SQLQueries:  []string{"SELECT d.name, o.total FROM orders o JOIN data d ON d.id = o.customer ORDER BY CAST(o.total AS INTEGER)"},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+	}
+
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	defer r.Close()
+	os.Stdin = r
+	go func() {
+		defer w.Close()
+		_, _ = w.Write([]byte("customer,total\n2,15\n1,7\n"))
+	}()
+
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "name,total\nAlice,7\nBob,15\n"; string(content) != want {
+		t.Errorf("Output = %q, want %q", content, want)
+	}
+
+	cfg = &config.Config{InputFiles: []string{"data.csv"}, StdinTable: "orders", SQLQueries: []string{"SELECT 1"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "requires reading from stdin") {
+		t.Errorf("Validate() without stdin error = %v, want stdin error", err)
+	}
+}
+
+func TestQueryEnv(t *testing.T) {
+	t.Setenv("YATISQL_TEST_QUERY", "SELECT name FROM data WHERE id = '3'")
+	t.Setenv("YATISQL_TEST_EMPTY", " ")
+
+	queries, err := queriesFromEnv([]string{"YATISQL_TEST_QUERY"})
+	if err != nil {
+		t.Fatalf("queriesFromEnv() error = %v", err)
+	}
+	outputPath := filepath.Join(t.TempDir(), "output.csv")
+	cfg := &config.Config{
+		InputFiles:  []string{filepath.Join(findTestdata(t), "sample.csv")},
+		SQLQueries:  queries,
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "name\nCharlie\n"; string(content) != want {
+		t.Errorf("Output = %q, want %q", content, want)
+	}
+
+	for _, name := range []string{"YATISQL_TEST_EMPTY", "YATISQL_TEST_UNSET"} {
+		if _, err := queriesFromEnv([]string{name}); err == nil || !strings.Contains(err.Error(), name+" is not set or empty") {
+			t.Errorf("queriesFromEnv(%s) error = %v, want not set error", name, err)
+		}
+	}
+}
+
+func TestQueryFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	countPath := filepath.Join(tmpDir, "count.sql")
+	namePath := filepath.Join(tmpDir, "name.sql")
+	emptyPath := filepath.Join(tmpDir, "empty.sql")
+	for path, content := range map[string]string{
+		countPath: "SELECT COUNT(*)\nFROM data\n",
+		namePath:  "SELECT name\n  FROM data\n WHERE id = '3';\n",
+		emptyPath: "\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	// Inline and file queries keep their command-line order
+	var sources []querySource
+	inline := &queryFlag{sources: &sources}
+	file := &queryFlag{sources: &sources, file: true}
+	for _, set := range []func() error{
+		func() error { return inline.Set("SELECT 1") },
+		func() error { return file.Set(countPath + "," + namePath) },
+		func() error { return inline.Set("SELECT 4") },
+	} {
+		if err := set(); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	queries, err := resolveQueries(sources)
+	if err != nil {
+		t.Fatalf("resolveQueries() error = %v", err)
+	}
+	want := []string{"SELECT 1", "SELECT COUNT(*)\nFROM data", "SELECT name\n  FROM data\n WHERE id = '3';", "SELECT 4"}
+	if strings.Join(queries, "|") != strings.Join(want, "|") {
+		t.Errorf("resolveQueries() = %q, want %q", queries, want)
+	}
+	if got := file.String(); got != countPath+","+namePath {
+		t.Errorf("String() = %q, want the file paths", got)
+	}
+
+	if _, err := resolveQueries([]querySource{{path: emptyPath}}); err == nil || !strings.Contains(err.Error(), "holds no query") {
+		t.Errorf("resolveQueries() with an empty file error = %v, want no query error", err)
+	}
+	if _, err := resolveQueries([]querySource{{path: filepath.Join(tmpDir, "missing.sql")}}); err == nil {
+		t.Error("Expected error for a missing query file, got nil")
+	}
+
+	// "-" reads the query from stdin, once
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	oldStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = oldStdin }()
+	w.WriteString("SELECT 2\n")
+	w.Close()
+	if queries, err = resolveQueries([]querySource{{path: "-"}}); err != nil || len(queries) != 1 || queries[0] != "SELECT 2" {
+		t.Errorf("resolveQueries() from stdin = %q, %v, want SELECT 2", queries, err)
+	}
+	if _, err := resolveQueries([]querySource{{path: "-"}, {path: "-"}}); err == nil {
+		t.Error("Expected error for reading stdin twice, got nil")
+	}
+}
+
+func TestDefaultInputsTerminalStdin(t *testing.T) {
+	origStdinIsTerminal := stdinIsTerminal
+	defer func() { stdinIsTerminal = origStdinIsTerminal }()
+	queries := []string{"SELECT 1"}
+
+	stdinIsTerminal = func() bool { return false }
+	if got, err := defaultInputs(nil, nil, queries, ""); err != nil || len(got) != 1 || got[0] != "-" {
+		t.Errorf("defaultInputs() with piped stdin = %v, %v; want [-]", got, err)
+	}
+
+	stdinIsTerminal = func() bool { return true }
+	_, err := defaultInputs(nil, nil, queries, "")
+	if err == nil || !strings.Contains(err.Error(), "no input provided") {
+		t.Errorf("defaultInputs() with terminal stdin error = %v, want no input error", err)
+	}
+	if got, err := defaultInputs(nil, nil, queries, "existing.db"); err != nil || len(got) != 0 {
+		t.Errorf("defaultInputs() with terminal stdin and a database = %v, %v; want no inputs", got, err)
+	}
+	if got, err := defaultInputs([]string{"data.csv"}, nil, queries, ""); err != nil || len(got) != 1 {
+		t.Errorf("defaultInputs() with -i = %v, %v; want [data.csv]", got, err)
+	}
+}
+
 func TestStdoutOutput(t *testing.T) {
 	testdataPath := findTestdata(t)
 	csvPath := filepath.Join(testdataPath, "sample.csv")
@@ -587,3 +874,1189 @@ func TestMultipleQueriesNoOutputs(t *testing.T) {
 	// when multiple queries write to stdout sequentially. This is a known limitation.
 	// In practice, users should specify separate output files for multiple queries.
 }
+
+func TestStrictDuplicateTableName(t *testing.T) {
+	testdataPath := findTestdata(t)
+	usersPath := filepath.Join(testdataPath, "multi_file", "users.csv")
+	ordersPath := filepath.Join(testdataPath, "multi_file", "orders.csv")
+
+	cfg := &config.Config{
+		InputFiles: []string{usersPath, ordersPath},
+		TableNames: []string{"data", "data"},
+		HasHeader:  true,
+		Delimiter:  ',',
+	}
+
+	// Lenient mode only warns
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() without strict error = %v", err)
+	}
+
+	cfg.Strict = true
+	err := run(cfg, false, false)
+	if err == nil {
+		t.Fatal("Expected error for duplicate table name under strict, got nil")
+	}
+	if !strings.Contains(err.Error(), "both import into table 'data'") {
+		t.Errorf("Expected duplicate table error, got: %v", err)
+	}
+}
+
+func TestCheckOutputDelimiter(t *testing.T) {
+	tests := []struct {
+		outputDelimiter string
+		outputFile      string
+		want            string
+	}{
+		{"tab", "results.csv", "results.csv has a .csv extension"},
+		{"comma", "results.tsv.gz", "results.tsv.gz has a .tsv extension"},
+		{"tab", "results.json", "does not apply to JSON output results.json"},
+		{"tab", "results.TSV", ""},
+		{"pipe", "results.txt", ""},
+		{"auto", "results.json", ""},
+		{"", "results.tsv", ""},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{OutputDelimiter: tt.outputDelimiter, OutputFiles: []string{tt.outputFile}, Delimiter: ','}
+		err := checkOutputDelimiter(cfg, &warner{strict: true})
+		if tt.want == "" && err != nil {
+			t.Errorf("--delimiter-out %q -o %s error = %v, want none", tt.outputDelimiter, tt.outputFile, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("--delimiter-out %q -o %s error = %v, want %q", tt.outputDelimiter, tt.outputFile, err, tt.want)
+		}
+	}
+}
+
+func TestDuplicateIndexColumns(t *testing.T) {
+	testdataPath := findTestdata(t)
+	cfg := &config.Config{
+		InputFiles:   []string{filepath.Join(testdataPath, "sample.csv")},
+		IndexColumns: []string{"name", "NAME"},
+		TableIndexes: map[string][]string{"data": {"name", "age"}},
+		HasHeader:    true,
+		Delimiter:    ',',
+	}
+
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	os.Stderr = w
+	stderr := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		stderr <- string(data)
+	}()
+
+	// Lenient mode warns about each repeat and creates the other indexes
+	runErr := run(cfg, false, false)
+	w.Close()
+	os.Stderr = oldStderr
+	if runErr != nil {
+		t.Fatalf("run() without strict error = %v", runErr)
+	}
+	output := <-stderr
+	if n := strings.Count(strings.ToLower(output), "index on column 'name' of table 'data' requested more than once"); n != 2 {
+		t.Errorf("Expected 2 duplicate index warnings, got %d in %q", n, output)
+	}
+
+	cfg.Strict = true
+	err = run(cfg, false, false)
+	if err == nil || !strings.Contains(err.Error(), "index on column 'NAME' of table 'data' requested more than once") {
+		t.Errorf("Expected duplicate index error under strict, got: %v", err)
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(path, []byte("id,email\n1,a@example.com\n2,b@example.com\n3,a@example.com\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	cfg := &config.Config{
+		InputFiles:    []string{path},
+		UniqueIndexes: []string{"id"},
+		TableUniques:  map[string][]string{"data": {"email"}},
+		HasHeader:     true,
+		Delimiter:     ',',
+	}
+
+	err := run(cfg, false, false)
+	if err == nil || !strings.Contains(err.Error(), "unique index on data (email): 'a@example.com' appears 2 times") {
+		t.Errorf("run() error = %v, want the duplicated email", err)
+	}
+
+	cfg.TableUniques = nil
+	if err := run(cfg, false, false); err != nil {
+		t.Errorf("run() with a unique id error = %v", err)
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	dir := t.TempDir()
+	usersPath := filepath.Join(dir, "users.csv")
+	if err := os.WriteFile(usersPath, []byte("id,name\n1,Alice\n2,Bob\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	// Re-running with an overlapping file hits the unique index on id
+	updatePath := filepath.Join(dir, "update.csv")
+	if err := os.WriteFile(updatePath, []byte("id,name\n2,Robert\n3,Carol\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		policy  string
+		wantErr bool
+		want    string
+	}{
+		{policy: "", wantErr: true, want: "1:Alice,2:Bob"},
+		{policy: database.ConflictAbort, wantErr: true, want: "1:Alice,2:Bob"},
+		{policy: database.ConflictIgnore, want: "1:Alice,2:Bob,3:Carol"},
+		{policy: database.ConflictReplace, want: "1:Alice,2:Robert,3:Carol"},
+	}
+	for _, tt := range tests {
+		dbPath := filepath.Join(dir, "conflict_"+tt.policy+".db")
+		cfg := &config.Config{
+			InputFiles:    []string{usersPath},
+			TableNames:    []string{"users"},
+			DBPath:        dbPath,
+			UniqueIndexes: []string{"id"},
+			HasHeader:     true,
+			Delimiter:     ',',
+			CountOnly:     true,
+		}
+		if err := run(cfg, false, false); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+
+		cfg.InputFiles = []string{updatePath}
+		cfg.Append = true
+		cfg.OnConflict = tt.policy
+		err := run(cfg, false, false)
+		if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed")) {
+			t.Errorf("policy %q: run() error = %v, want a UNIQUE constraint error", tt.policy, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("policy %q: run() error = %v", tt.policy, err)
+		}
+
+		db, err := database.Open(dbPath)
+		if err != nil {
+			t.Fatalf("database.Open() error = %v", err)
+		}
+		var got string
+		if err := db.QueryRow("SELECT group_concat(id || ':' || name, ',') FROM (SELECT * FROM users ORDER BY id)").Scan(&got); err != nil {
+			t.Fatalf("Query error = %v", err)
+		}
+		db.Close()
+		if got != tt.want {
+			t.Errorf("policy %q: users = %s, want %s", tt.policy, got, tt.want)
+		}
+	}
+
+	cfg := &config.Config{InputFiles: []string{usersPath}, HasHeader: true, Delimiter: ',', OnConflict: "skip"}
+	if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "invalid conflict policy") {
+		t.Errorf("run() with an invalid policy error = %v, want invalid conflict policy", err)
+	}
+}
+
+func TestStrictPartialImportFailure(t *testing.T) {
+	testdataPath := findTestdata(t)
+	usersPath := filepath.Join(testdataPath, "multi_file", "users.csv")
+	missingPath := filepath.Join(testdataPath, "nonexistent.csv")
+
+	cfg := &config.Config{
+		InputFiles: []string{usersPath, missingPath},
+		TableNames: []string{"users", "missing"},
+		HasHeader:  true,
+		Delimiter:  ',',
+		Strict:     true,
+	}
+
+	err := run(cfg, false, false)
+	if err == nil {
+		t.Fatal("Expected error for partial import failure under strict, got nil")
+	}
+	if !strings.Contains(err.Error(), "some imports failed") {
+		t.Errorf("Expected import failure error, got: %v", err)
+	}
+}
+
+func TestRaggedRowsWarning(t *testing.T) {
+	// Line 3 is short and line 4 has an extra field
+	path := filepath.Join(t.TempDir(), "ragged.csv")
+	if err := os.WriteFile(path, []byte("id,name,city\n1,Alice,Paris\n2,Bob\n3,Carol,Oslo,extra\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	os.Stderr = w
+	stderr := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		stderr <- string(data)
+	}()
+
+	// Both are imported and counted by default
+	cfg := &config.Config{
+		InputFiles: []string{path},
+		HasHeader:  true,
+		Delimiter:  ',',
+	}
+	runErr := run(cfg, false, false)
+	w.Close()
+	os.Stderr = oldStderr
+	if runErr != nil {
+		t.Fatalf("run() error = %v", runErr)
+	}
+	output := <-stderr
+	for _, want := range []string{
+		"1 rows of 'data' had fewer fields than the header",
+		"1 rows of 'data' had more fields than the header",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("stderr = %q, want a warning containing %q", output, want)
+		}
+	}
+
+	// Under --strict the short row fails the import at its line
+	cfg.Strict = true
+	err = run(cfg, false, false)
+	if err == nil || !strings.Contains(err.Error(), "parse error at line 3") {
+		t.Errorf("run() with strict error = %v, want a parse error at line 3", err)
+	}
+
+	// --strict-columns alone fails on a long row too
+	if err := os.WriteFile(path, []byte("id,name,city\n1,Alice,Paris\n3,Carol,Oslo,extra\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	cfg.Strict = false
+	cfg.StrictColumns = true
+	err = run(cfg, false, false)
+	if err == nil || !strings.Contains(err.Error(), "parse error at line 3: 4 fields but the header has 3") {
+		t.Errorf("run() with strict columns error = %v, want a parse error at line 3", err)
+	}
+}
+
+func TestPerTableIndexes(t *testing.T) {
+	testdataPath := findTestdata(t)
+	usersPath := filepath.Join(testdataPath, "multi_file", "users.csv")
+	ordersPath := filepath.Join(testdataPath, "multi_file", "orders.csv")
+	dbPath := filepath.Join(t.TempDir(), "indexes.db")
+
+	cfg := &config.Config{
+		InputFiles:   []string{usersPath, ordersPath},
+		TableNames:   []string{"users", "orders"},
+		DBPath:       dbPath,
+		IndexColumns: []string{"id"},
+		TableIndexes: map[string][]string{"users": {"email"}, "orders": {"user_id"}},
+		HasHeader:    true,
+		Delimiter:    ',',
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	db, err := database.Open(dbPath)
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'index' ORDER BY name")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	defer rows.Close()
+	var indexes []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		indexes = append(indexes, name)
+	}
+	want := "idx_orders_id,idx_orders_user_id,idx_users_email,idx_users_id"
+	if got := strings.Join(indexes, ","); got != want {
+		t.Errorf("indexes = %s, want %s", got, want)
+	}
+
+	// Each table's columns are validated against that table only
+	cfg.Strict = true
+	cfg.TableIndexes = map[string][]string{"users": {"user_id"}}
+	if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "user_id") {
+		t.Errorf("run() with a column from another table error = %v, want missing column error", err)
+	}
+	cfg.TableIndexes = map[string][]string{"products": {"id"}}
+	if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "'products'") {
+		t.Errorf("run() with an unknown table error = %v, want unknown table error", err)
+	}
+}
+
+func TestOutputDelimiter(t *testing.T) {
+	testdataPath := findTestdata(t)
+	tsvPath := filepath.Join(testdataPath, "sample.tsv")
+	outputPath := filepath.Join(t.TempDir(), "out.tsv")
+
+	cfg := &config.Config{
+		InputFiles:      []string{tsvPath},
+		SQLQueries:      []string{"SELECT id, name FROM data WHERE id = '1'"},
+		OutputFiles:     []string{outputPath},
+		HasHeader:       true,
+		Delimiter:       '\t',
+		OutputDelimiter: "comma",
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 || lines[0] != "id,name" || !strings.HasPrefix(lines[1], "1,") {
+		t.Errorf("Output = %q, want comma-separated despite the .tsv extension", content)
+	}
+}
+
+func TestEstimateQuery(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "age"}
+	if err := database.CreateTable(db.DB, "people", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	rows := make([][]string, 20000)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i), strconv.Itoa(i % 90)}
+	}
+	if err := database.InsertBatch(db.DB, "people", headers, rows); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+	if err := database.CreateIndexes(db.DB, "people", []string{"id"}); err != nil {
+		t.Fatalf("CreateIndexes() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		minRows int64
+		want    string
+	}{
+		{"unindexed filter", "SELECT * FROM people WHERE age = '30'", 10000, "query 1 scans ~20K rows of 'people' without an index"},
+		{"aliased join", "SELECT * FROM people p JOIN people q ON q.id = p.age", 10000, "query 1 scans ~20K rows of 'people' without an index"},
+		{"indexed filter", "SELECT * FROM people WHERE id = '30'", 10000, ""},
+		{"small table", "SELECT * FROM people WHERE age = '30'", 50000, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			estimateQuery(&out, db.DB, "query 1", tt.query, tt.minRows)
+			if tt.want == "" && out.Len() > 0 {
+				t.Errorf("estimateQuery() = %q, want no warning", out.String())
+			}
+			if tt.want != "" && !strings.Contains(out.String(), tt.want) {
+				t.Errorf("estimateQuery() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	os.Stderr = w
+
+	cfg := &config.Config{
+		InputFiles:  []string{csvPath},
+		TableNames:  []string{"people"},
+		SQLQueries:  []string{"SELECT COUNT(*) FROM people"},
+		OutputFiles: []string{filepath.Join(t.TempDir(), "count.csv")},
+		HasHeader:   true,
+		Delimiter:   ',',
+		Preview:     2,
+	}
+	err = run(cfg, false, false)
+	w.Close()
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	stderr, _ := io.ReadAll(r)
+
+	lines := strings.Split(strings.TrimSpace(string(stderr)), "\n")
+	if len(lines) != 4 || lines[0] != "Preview of table 'people' (first 2 rows):" {
+		t.Fatalf("Preview = %q, want a title, header and 2 rows", stderr)
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, ",") != "id,name,age,city,email" {
+		t.Errorf("Preview header = %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "1   Alice") || !strings.Contains(lines[2], "New York") {
+		t.Errorf("Preview row = %q, want Alice's row aligned with the header", lines[2])
+	}
+}
+
+func TestExplainDelimiter(t *testing.T) {
+	tsvPath := filepath.Join(t.TempDir(), "export.csv")
+	content := "id\tname\tnote\n1\tAlice\thello, world\n2\tBob\ta, b, c\n"
+	if err := os.WriteFile(tsvPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	cfg := &config.Config{InputFiles: []string{tsvPath}, ExplainDelim: 10}
+	if err := explainDelimiters(cfg, &out); err != nil {
+		t.Fatalf("explainDelimiters() error = %v", err)
+	}
+
+	report := out.String()
+	if !strings.HasPrefix(report, tsvPath+": importing with comma (3 lines sampled)\n") {
+		t.Errorf("report = %q, want the delimiter chosen from the extension", report)
+	}
+	tab, comma := strings.Index(report, "\ntab "), strings.Index(report, "\ncomma ")
+	if tab < 0 || comma < 0 || tab > comma {
+		t.Errorf("report ranks comma above tab:\n%s", report)
+	}
+	if !strings.Contains(report, "try --delimiter tab") {
+		t.Errorf("report does not suggest tab:\n%s", report)
+	}
+
+	// The diagnostic exits without importing anything
+	cfg.DBPath = filepath.Join(t.TempDir(), "unused.db")
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if _, err := os.Stat(cfg.DBPath); !os.IsNotExist(err) {
+		t.Errorf("Stat(%s) error = %v, want no database created", cfg.DBPath, err)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	testdataPath := findTestdata(t)
+	dbPath := filepath.Join(t.TempDir(), "people.db")
+	cfg := &config.Config{
+		InputFiles: []string{filepath.Join(testdataPath, "sample.csv")},
+		DBPath:     dbPath,
+		KeepDB:     true,
+		HasHeader:  true,
+		Delimiter:  ',',
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	// The export renamed email, dropped city and moved age to the front
+	changed := filepath.Join(t.TempDir(), "changed.csv")
+	if err := os.WriteFile(changed, []byte("age,id,name,e-mail\n30,11,Zed,zed@example.com\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	cfg = &config.Config{
+		InputFiles:  []string{changed},
+		DBPath:      dbPath,
+		KeepDB:      true,
+		HasHeader:   true,
+		Delimiter:   ',',
+		CheckSchema: true,
+	}
+	db, err := openDatabase(cfg)
+	if err != nil {
+		t.Fatalf("openDatabase() error = %v", err)
+	}
+	defer closeDatabase(db, cfg)
+
+	var out bytes.Buffer
+	err = checkSchema(db, cfg, &warner{}, &out)
+	if err == nil {
+		t.Fatal("checkSchema() error = nil, want an error for the mismatched input")
+	}
+	want := changed + ": does not match table 'data'\n" +
+		"  added:     e_mail\n" +
+		"  removed:   city, email\n" +
+		"  reordered: table has (id, name, age, city, email), input has (age, id, name, e_mail)\n"
+	if out.String() != want {
+		t.Errorf("checkSchema() report = %q, want %q", out.String(), want)
+	}
+
+	// Nothing was imported
+	var count int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM data").Scan(&count); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if count != 10 {
+		t.Errorf("data has %d rows, want the 10 imported before the check", count)
+	}
+}
+
+func TestEmptyResultWarning(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+	outputPath := filepath.Join(t.TempDir(), "empty.csv")
+
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	os.Stderr = w
+
+	cfg := &config.Config{
+		InputFiles:  []string{csvPath},
+		SQLQueries:  []string{"SELECT * FROM data WHERE name = 'Nobody'"},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+	}
+	err = run(cfg, false, false)
+	w.Close()
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	stderr, _ := io.ReadAll(r)
+	if !strings.Contains(string(stderr), "query 1 wrote no rows to "+outputPath) {
+		t.Errorf("Expected empty result warning, got stderr:\n%s", stderr)
+	}
+
+	cfg.FailIfEmpty = true
+	if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "wrote no rows") {
+		t.Errorf("run() with FailIfEmpty error = %v, want empty result error", err)
+	}
+
+	cfg.SQLQueries = []string{"SELECT * FROM data"}
+	if err := run(cfg, false, false); err != nil {
+		t.Errorf("run() with FailIfEmpty and rows error = %v", err)
+	}
+}
+
+func TestColumnsInfo(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	cfg := &config.Config{
+		InputFiles: []string{csvPath},
+		TableNames: []string{"data"},
+		HasHeader:  true,
+		Delimiter:  ',',
+	}
+
+	var out bytes.Buffer
+	if err := columnsInfo(cfg, true, &out); err != nil {
+		t.Fatalf("columnsInfo() error = %v", err)
+	}
+
+	var report []tableProfile
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse report: %v\n%s", err, out.String())
+	}
+	if len(report) != 1 || report[0].Table != "data" {
+		t.Fatalf("Expected one table 'data', got %+v", report)
+	}
+
+	want := map[string]database.ColumnProfile{
+		"id":   {Name: "id", EmptyCount: 0, DistinctCount: 10, MinLength: 1, MaxLength: 2},
+		"name": {Name: "name", EmptyCount: 0, DistinctCount: 10, MinLength: 3, MaxLength: 7},
+		"age":  {Name: "age", EmptyCount: 0, DistinctCount: 10, MinLength: 2, MaxLength: 2},
+		"city": {Name: "city", EmptyCount: 0, DistinctCount: 10, MinLength: 6, MaxLength: 12},
+	}
+	for _, col := range report[0].Columns {
+		if expected, ok := want[col.Name]; ok && col != expected {
+			t.Errorf("Column %s = %+v, want %+v", col.Name, col, expected)
+		}
+	}
+	if len(report[0].Columns) != 5 {
+		t.Errorf("Expected 5 columns, got %d", len(report[0].Columns))
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+	tmpFile := filepath.Join(t.TempDir(), "visits.csv")
+	content := "email,page\na@example.com,home\nb@example.com,home\na@example.com,about\n,home\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	cfg := &config.Config{
+		InputFiles: []string{csvPath, tmpFile},
+		TableNames: []string{"people", "visits"},
+		HasHeader:  true,
+		Delimiter:  ',',
+	}
+
+	var out bytes.Buffer
+	if err := distinct(cfg, "email", false, &out); err != nil {
+		t.Fatalf("distinct() error = %v", err)
+	}
+	want := "Table 'people': 10 distinct values in column 'email'\nTable 'visits': 3 distinct values in column 'email'\n"
+	if out.String() != want {
+		t.Errorf("distinct() output = %q, want %q", out.String(), want)
+	}
+
+	cfg.InputFiles, cfg.TableNames = []string{tmpFile}, nil
+	out.Reset()
+	if err := distinct(cfg, "EMAIL", true, &out); err != nil {
+		t.Fatalf("distinct() with values error = %v", err)
+	}
+	want = "Table 'data': 3 distinct values in column 'EMAIL'\n  \n  a@example.com\n  b@example.com\n"
+	if out.String() != want {
+		t.Errorf("distinct() with values output = %q, want %q", out.String(), want)
+	}
+
+	if err := distinct(cfg, "missing", false, &out); err == nil {
+		t.Error("distinct() of a missing column succeeded, want error")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	tmpDir := t.TempDir()
+	outputPath1 := filepath.Join(tmpDir, "older.csv.gz")
+	outputPath2 := filepath.Join(tmpDir, "cities.json")
+	manifestPath := filepath.Join(tmpDir, "manifest.json")
+
+	cfg := &config.Config{
+		InputFiles:   []string{csvPath},
+		SQLQueries:   []string{"SELECT * FROM data WHERE CAST(age AS INTEGER) > 30", "SELECT DISTINCT city FROM data"},
+		OutputFiles:  []string{outputPath1, outputPath2},
+		HasHeader:    true,
+		Delimiter:    ',',
+		ManifestPath: manifestPath,
+	}
+
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("ReadFile(manifest) error = %v", err)
+	}
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("Failed to parse manifest: %v\n%s", err, data)
+	}
+
+	want := []manifestEntry{
+		{Path: outputPath1, Format: "csv", QueryIndex: 1, Rows: 5},
+		{Path: outputPath2, Format: "json", QueryIndex: 2, Rows: 10},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d manifest entries, got %d: %+v", len(want), len(entries), entries)
+	}
+	for i, entry := range entries {
+		info, err := os.Stat(want[i].Path)
+		if err != nil {
+			t.Fatalf("Stat(%s) error = %v", want[i].Path, err)
+		}
+		want[i].Bytes = info.Size()
+		if entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
+
+func TestEmitMetadata(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+	outputPath := filepath.Join(t.TempDir(), "people.tsv")
+	sqlQuery := "SELECT name, CAST(age AS INTEGER) AS age FROM data WHERE city = 'Chicago'"
+
+	cfg := &config.Config{
+		InputFiles:   []string{csvPath},
+		SQLQueries:   []string{sqlQuery},
+		OutputFiles:  []string{outputPath},
+		HasHeader:    true,
+		EmitMetadata: true,
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath + ".meta.json")
+	if err != nil {
+		t.Fatalf("ReadFile(metadata) error = %v", err)
+	}
+	var meta outputMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("Failed to parse metadata: %v\n%s", err, data)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+
+	if meta.Path != outputPath || meta.Format != "csv" || meta.Delimiter != "\t" || meta.Compression != "none" || meta.Query != sqlQuery {
+		t.Errorf("metadata = %+v, want the output's path, format, delimiter, compression and query", meta)
+	}
+	if meta.Rows != len(records)-1 || meta.Bytes != info.Size() {
+		t.Errorf("metadata rows = %d, bytes = %d, want %d and %d", meta.Rows, meta.Bytes, len(records)-1, info.Size())
+	}
+	wantColumns := []metadataColumn{{Name: "name", Type: "TEXT"}, {Name: "age", Type: "INTEGER"}}
+	if len(meta.Columns) != len(records[0]) || len(meta.Columns) != len(wantColumns) {
+		t.Fatalf("metadata columns = %+v, header = %v", meta.Columns, records[0])
+	}
+	for i, column := range meta.Columns {
+		if column != wantColumns[i] || column.Name != records[0][i] {
+			t.Errorf("column %d = %+v, want %+v", i, column, wantColumns[i])
+		}
+	}
+}
+
+func TestQueryWithCTEFile(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	tmpDir := t.TempDir()
+	ctePath := filepath.Join(tmpDir, "ctes.sql")
+	outputPath := filepath.Join(tmpDir, "output.csv")
+
+	ctes := `-- Shared definitions
+seniors AS (SELECT * FROM data WHERE CAST(age AS INTEGER) >= 40),
+senior_names AS (SELECT name FROM seniors)`
+	if err := os.WriteFile(ctePath, []byte(ctes), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	content, err := os.ReadFile(ctePath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	parsed, err := query.ParseCTEs(string(content))
+	if err != nil {
+		t.Fatalf("ParseCTEs() error = %v", err)
+	}
+
+	cfg := &config.Config{
+		InputFiles:  []string{csvPath},
+		SQLQueries:  []string{"SELECT name FROM senior_names ORDER BY name"},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+		CTEs:        parsed,
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if got, want := strings.TrimSpace(string(output)), "name\nFrank\nJack"; got != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+}
+
+func TestRunWithCommandInput(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+	outputPath := filepath.Join(t.TempDir(), "output.csv")
+
+	cfg := &config.Config{
+		Commands:    []string{"head -n 4 " + csvPath},
+		TableNames:  []string{"people"},
+		SQLQueries:  []string{"SELECT COUNT(*) AS total FROM people"},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if got := strings.TrimSpace(string(content)); got != "total\n3" {
+		t.Errorf("Output = %q, want %q", got, "total\n3")
+	}
+}
+
+func TestQuietTempDB(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	var out bytes.Buffer
+	origOutput := color.Output
+	color.Output = &out
+	defer func() { color.Output = origOutput }()
+
+	cfg := &config.Config{
+		InputFiles: []string{csvPath},
+		SQLQueries: []string{"SELECT COUNT(*) FROM data"},
+		HasHeader:  true,
+		Delimiter:  ',',
+		CountOnly:  true,
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Using temporary database") || !strings.Contains(out.String(), "Cleaned up temporary database") {
+		t.Fatalf("Expected temporary database messages by default, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	cfg.QuietTempDB = true
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if strings.Contains(out.String(), "temporary database") {
+		t.Errorf("Expected no temporary database messages, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Query returned 1 rows") {
+		t.Errorf("Expected query feedback to be kept, got:\n%s", out.String())
+	}
+}
+
+func TestTimingReport(t *testing.T) {
+	testdataPath := findTestdata(t)
+	cfg := &config.Config{
+		InputFiles:   []string{filepath.Join(testdataPath, "sample.csv")},
+		IndexColumns: []string{"city"},
+		SQLQueries:   []string{"SELECT * FROM data WHERE city = 'Chicago'"},
+		OutputFiles:  []string{filepath.Join(t.TempDir(), "out.csv")},
+		HasHeader:    true,
+		Delimiter:    ',',
+		Timing:       true,
+	}
+
+	oldStderr := os.Stderr
+	defer func() { os.Stderr = oldStderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	os.Stderr = w
+	stderr := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		stderr <- string(data)
+	}()
+
+	runErr := run(cfg, false, false)
+	w.Close()
+	os.Stderr = oldStderr
+	if runErr != nil {
+		t.Fatalf("run() error = %v", runErr)
+	}
+	output := <-stderr
+
+	for _, phase := range []string{"parse", "write", "index", "query 1", "total"} {
+		if !regexp.MustCompile(`(?m)^` + phase + `\s+\S+`).MatchString(output) {
+			t.Errorf("Expected a %q row in the timing report, got:\n%s", phase, output)
+		}
+	}
+	if !regexp.MustCompile(`(?m)^parse\s+\S+\s+10\s`).MatchString(output) {
+		t.Errorf("Expected 10 parsed rows in the timing report, got:\n%s", output)
+	}
+}
+
+func TestCountOnly(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+	tmpDir := t.TempDir()
+
+	var out bytes.Buffer
+	origOutput := color.Output
+	color.Output = &out
+	defer func() { color.Output = origOutput }()
+
+	cfg := &config.Config{
+		InputFiles: []string{csvPath},
+		DBPath:     filepath.Join(tmpDir, "count.db"),
+		SQLQueries: []string{"SELECT * FROM data WHERE CAST(age AS INTEGER) > 30"},
+		HasHeader:  true,
+		Delimiter:  ',',
+		CountOnly:  true,
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	if !strings.Contains(out.String(), "Query returned 5 rows") {
+		t.Errorf("Expected row count in output, got:\n%s", out.String())
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "count.db") {
+			t.Errorf("Unexpected file written: %s", entry.Name())
+		}
+	}
+
+	cfg.OutputFiles = []string{filepath.Join(tmpDir, "out.csv")}
+	if err := run(cfg, false, false); err == nil {
+		t.Error("Expected error for output files with count-only, got nil")
+	}
+}
+
+func TestScalarOutput(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	oldStdout := os.Stdout
+	defer func() { os.Stdout = oldStdout }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	os.Stdout = w
+
+	cfg := &config.Config{
+		InputFiles: []string{csvPath},
+		SQLQueries: []string{"SELECT COUNT(*) FROM data"},
+		HasHeader:  true,
+		Delimiter:  ',',
+		Scalar:     true,
+	}
+
+	var buf bytes.Buffer
+	readDone := make(chan error)
+	go func() {
+		defer r.Close()
+		_, err := io.Copy(&buf, r)
+		readDone <- err
+	}()
+
+	err = run(cfg, false, false)
+	w.Close()
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if err := <-readDone; err != nil {
+		t.Fatalf("Read error = %v", err)
+	}
+	if buf.String() != "10\n" {
+		t.Errorf("Output = %q, want %q", buf.String(), "10\n")
+	}
+
+	for _, query := range []string{"SELECT id, name FROM data LIMIT 1", "SELECT id FROM data", "SELECT id FROM data WHERE 0"} {
+		cfg.SQLQueries = []string{query}
+		if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "expected a single value") {
+			t.Errorf("run(%q) error = %v, want a single value error", query, err)
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	testdataPath := findTestdata(t)
+	tmpDir := t.TempDir()
+	cpuPath := filepath.Join(tmpDir, "cpu.prof")
+	memPath := filepath.Join(tmpDir, "mem.prof")
+
+	stopProfiles, err := startProfiles(cpuPath, memPath)
+	if err != nil {
+		t.Fatalf("startProfiles() error = %v", err)
+	}
+	cfg := &config.Config{
+		InputFiles:  []string{filepath.Join(testdataPath, "sample.csv")},
+		SQLQueries:  []string{"SELECT * FROM data"},
+		OutputFiles: []string{filepath.Join(tmpDir, "out.csv")},
+		HasHeader:   true,
+		Delimiter:   ',',
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if err := stopProfiles(); err != nil {
+		t.Fatalf("stopProfiles() error = %v", err)
+	}
+
+	for _, path := range []string{cpuPath, memPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("profile %s not created: %v", filepath.Base(path), err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("profile %s is empty", filepath.Base(path))
+		}
+	}
+
+	// Without profile paths, stopping is a no-op
+	stopProfiles, err = startProfiles("", "")
+	if err != nil {
+		t.Fatalf("startProfiles() without files error = %v", err)
+	}
+	if err := stopProfiles(); err != nil {
+		t.Errorf("stopProfiles() without files error = %v", err)
+	}
+}
+
+func TestBinarySafeRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	raw := "ok\xff\xfe\x00 bad \xc3("
+	csvPath := filepath.Join(tmpDir, "binary.csv")
+	if err := os.WriteFile(csvPath, []byte("id,payload\n1,"+raw+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	decoders := map[string]func(string) ([]byte, error){
+		"base64": base64.StdEncoding.DecodeString,
+		"hex":    hex.DecodeString,
+	}
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			outputPath := filepath.Join(tmpDir, encoding+".csv")
+			cfg := &config.Config{
+				InputFiles:     []string{csvPath},
+				SQLQueries:     []string{"SELECT payload, typeof(payload) AS type FROM data"},
+				OutputFiles:    []string{outputPath},
+				HasHeader:      true,
+				Delimiter:      ',',
+				BinarySafe:     true,
+				BinaryEncoding: encoding,
+			}
+			if err := run(cfg, false, false); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			f, err := os.Open(outputPath)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer f.Close()
+			records, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("got %d records, want header and 1 row", len(records))
+			}
+			if records[1][1] != "blob" {
+				t.Errorf("typeof(payload) = %s, want blob", records[1][1])
+			}
+			decoded, err := decode(records[1][0])
+			if err != nil {
+				t.Fatalf("decoding %q: %v", records[1][0], err)
+			}
+			if !bytes.Equal(decoded, []byte(raw)) {
+				t.Errorf("round trip = %q, want %q", decoded, raw)
+			}
+		})
+	}
+}
+
+func TestSortOutput(t *testing.T) {
+	testdataPath := findTestdata(t)
+	tmpDir := t.TempDir()
+	outputPath := filepath.Join(tmpDir, "sorted.csv")
+
+	keys, err := query.ParseSortKeys("age:desc")
+	if err != nil {
+		t.Fatalf("ParseSortKeys() error = %v", err)
+	}
+	cfg := &config.Config{
+		InputFiles:  []string{filepath.Join(testdataPath, "sample.csv")},
+		SQLQueries:  []string{"SELECT name, CAST(age AS INTEGER) AS age FROM data LIMIT 4"},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+		SortKeys:    keys,
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	f, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want header and 4 rows", len(records))
+	}
+	for i := 2; i < len(records); i++ {
+		if records[i-1][1] < records[i][1] {
+			t.Errorf("rows not sorted by age descending: %v", records[1:])
+			break
+		}
+	}
+
+	// A sort column missing from the results fails before any output is written
+	missingPath := filepath.Join(tmpDir, "missing.csv")
+	cfg.SortKeys = []query.SortKey{{Column: "salary"}}
+	cfg.OutputFiles = []string{missingPath}
+	err = run(cfg, false, false)
+	if err == nil || !strings.Contains(err.Error(), "sort column 'salary' is not in the query results (columns: name, age)") {
+		t.Errorf("run() error = %v, want missing sort column", err)
+	}
+	if _, statErr := os.Stat(missingPath); !os.IsNotExist(statErr) {
+		t.Errorf("output written despite the invalid sort column")
+	}
+}
+
+func TestJSONKeyOutput(t *testing.T) {
+	testdataPath := findTestdata(t)
+	tmpDir := t.TempDir()
+	outputPath := filepath.Join(tmpDir, "people.json")
+
+	cfg := &config.Config{
+		InputFiles:  []string{filepath.Join(testdataPath, "sample.csv")},
+		SQLQueries:  []string{"SELECT name, age, city FROM data"},
+		OutputFiles: []string{outputPath},
+		HasHeader:   true,
+		Delimiter:   ',',
+		JSONKey:     "name",
+	}
+	if err := run(cfg, false, false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var people map[string]map[string]string
+	if err := json.Unmarshal(content, &people); err != nil {
+		t.Fatalf("output is not a keyed object: %v\n%s", err, content)
+	}
+	if len(people) != 10 {
+		t.Errorf("got %d keys, want 10", len(people))
+	}
+	if alice := people["Alice"]; alice["age"] != "30" || alice["city"] != "New York" {
+		t.Errorf("people[Alice] = %v, want age 30 in New York", alice)
+	}
+
+	// Keys must be unique
+	cfg.SQLQueries = []string{"SELECT city, name FROM data UNION ALL SELECT city, name FROM data"}
+	cfg.JSONKey = "city"
+	if err := run(cfg, false, false); err == nil || !strings.Contains(err.Error(), "duplicate JSON key") {
+		t.Errorf("run() error = %v, want duplicate JSON key", err)
+	}
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yatisql/yatisql-go/internal/config"
+	"github.com/yatisql/yatisql-go/internal/database"
+)
+
+var columnsInfoCmd = &cobra.Command{
+	Use:   "columns-info",
+	Short: "Profile the columns of imported tables",
+	Long: `Import the input files (or open an existing database) and report, for each
+column, the number of NULL/empty values, the number of distinct values, and the
+minimum and maximum value length.`,
+	Example: `  # Profile a CSV file
+  yatisql columns-info -i data.csv
+
+  # Profile tables in an existing database as JSON
+  yatisql columns-info -d warehouse.db -t users,orders --json`,
+	RunE: runColumnsInfo,
+}
+
+func init() {
+	columnsInfoCmd.Flags().StringSliceP("input", "i", []string{}, "Input CSV/TSV file(s), comma-separated for multiple files")
+	columnsInfoCmd.Flags().StringSliceP("table", "t", []string{}, "Table name(s) for imported data or tables to profile in --db (default: 'data', 'data2', etc.)")
+	columnsInfoCmd.Flags().StringP("db", "d", "", "SQLite database path (default: temporary file, deleted after execution)")
+	columnsInfoCmd.Flags().BoolP("header", "H", true, "Input file has header row")
+	columnsInfoCmd.Flags().String("delimiter", "auto", "Field delimiter: 'comma', 'tab', 'semicolon', 'pipe', 'char:X' for another character, or 'auto' (default: auto)")
+	columnsInfoCmd.Flags().Bool("json", false, "Output the report as JSON")
+	rootCmd.AddCommand(columnsInfoCmd)
+}
+
+func runColumnsInfo(cmd *cobra.Command, _ []string) error {
+	inputFiles, _ := cmd.Flags().GetStringSlice("input")
+	tableNames, _ := cmd.Flags().GetStringSlice("table")
+	dbPath, _ := cmd.Flags().GetString("db")
+	hasHeader, _ := cmd.Flags().GetBool("header")
+	delimiterStr, _ := cmd.Flags().GetString("delimiter")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	delimiter, err := config.ParseDelimiter(delimiterStr)
+	if err != nil {
+		return err
+	}
+
+	cfg := &config.Config{
+		InputFiles: inputFiles,
+		TableNames: tableNames,
+		DBPath:     dbPath,
+		HasHeader:  hasHeader,
+		Delimiter:  delimiter,
+		KeepDB:     cmd.Flags().Changed("db"),
+	}
+	return columnsInfo(cfg, asJSON, os.Stdout)
+}
+
+// tableProfile is the columns-info report for one table.
+type tableProfile struct {
+	Table   string                   `json:"table"`
+	Columns []database.ColumnProfile `json:"columns"`
+}
+
+// columnsInfo imports cfg's inputs and writes a column profile of every
+// imported table (or of cfg.TableNames when there are no inputs) to out.
+func columnsInfo(cfg *config.Config, asJSON bool, out io.Writer) error {
+	if len(cfg.InputFiles) == 0 && (cfg.DBPath == "" || len(cfg.TableNames) == 0) {
+		return fmt.Errorf("specify input files with -i, or a database with -d and tables with -t")
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db, cfg)
+
+	results, err := importInputs(db, cfg, &warner{strict: cfg.Strict}, false, false)
+	if err != nil {
+		return err
+	}
+
+	tables := cfg.TableNames
+	if len(results) > 0 {
+		tables = make([]string, len(results))
+		for i, result := range results {
+			tables[i] = result.TableName
+		}
+	}
+
+	profiles := make([]tableProfile, 0, len(tables))
+	for _, table := range tables {
+		columns, err := database.ProfileColumns(db.DB, table)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, tableProfile{Table: table, Columns: columns})
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(profiles)
+	}
+
+	for i, profile := range profiles {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "Table '%s'\n", profile.Table)
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COLUMN\tNULL/EMPTY\tDISTINCT\tMIN LEN\tMAX LEN")
+		for _, col := range profile.Columns {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", col.Name, col.EmptyCount, col.DistinctCount, col.MinLength, col.MaxLength)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
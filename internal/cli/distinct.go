@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yatisql/yatisql-go/internal/config"
+	"github.com/yatisql/yatisql-go/internal/database"
+)
+
+var distinctCmd = &cobra.Command{
+	Use:   "distinct",
+	Short: "Count the distinct values of a column",
+	Long: `Import the input files (or open an existing database) and report the number
+of distinct non-NULL values of a column in each table, as COUNT(DISTINCT column)
+would. With --values the distinct values are listed as well.`,
+	Example: `  # How many different email addresses are there?
+  yatisql distinct -i users.csv -c email
+
+  # List the distinct cities in a table of an existing database
+  yatisql distinct -d warehouse.db -t users -c city --values`,
+	RunE: runDistinct,
+}
+
+func init() {
+	distinctCmd.Flags().StringSliceP("input", "i", []string{}, "Input CSV/TSV file(s), comma-separated for multiple files")
+	distinctCmd.Flags().StringSliceP("table", "t", []string{}, "Table name(s) for imported data or tables to read in --db (default: 'data', 'data2', etc.)")
+	distinctCmd.Flags().StringP("db", "d", "", "SQLite database path (default: temporary file, deleted after execution)")
+	distinctCmd.Flags().StringP("column", "c", "", "Column to count the distinct values of (required)")
+	distinctCmd.Flags().Bool("values", false, "Also list the distinct values, in ascending order")
+	distinctCmd.Flags().BoolP("header", "H", true, "Input file has header row")
+	distinctCmd.Flags().String("delimiter", "auto", "Field delimiter: 'comma', 'tab', 'semicolon', 'pipe', 'char:X' for another character, or 'auto' (default: auto)")
+	rootCmd.AddCommand(distinctCmd)
+}
+
+func runDistinct(cmd *cobra.Command, _ []string) error {
+	inputFiles, _ := cmd.Flags().GetStringSlice("input")
+	tableNames, _ := cmd.Flags().GetStringSlice("table")
+	dbPath, _ := cmd.Flags().GetString("db")
+	column, _ := cmd.Flags().GetString("column")
+	listValues, _ := cmd.Flags().GetBool("values")
+	hasHeader, _ := cmd.Flags().GetBool("header")
+	delimiterStr, _ := cmd.Flags().GetString("delimiter")
+
+	delimiter, err := config.ParseDelimiter(delimiterStr)
+	if err != nil {
+		return err
+	}
+
+	cfg := &config.Config{
+		InputFiles: inputFiles,
+		TableNames: tableNames,
+		DBPath:     dbPath,
+		HasHeader:  hasHeader,
+		Delimiter:  delimiter,
+		KeepDB:     cmd.Flags().Changed("db"),
+	}
+	return distinct(cfg, column, listValues, os.Stdout)
+}
+
+// distinct imports cfg's inputs and writes the distinct value count of column
+// in every imported table (or in cfg.TableNames when there are no inputs) to
+// out, followed by the values themselves if listValues is set.
+func distinct(cfg *config.Config, column string, listValues bool, out io.Writer) error {
+	if len(cfg.InputFiles) == 0 && (cfg.DBPath == "" || len(cfg.TableNames) == 0) {
+		return fmt.Errorf("specify input files with -i, or a database with -d and tables with -t")
+	}
+	if column == "" {
+		return fmt.Errorf("specify the column to count with -c")
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db, cfg)
+
+	results, err := importInputs(db, cfg, &warner{strict: cfg.Strict}, false, false)
+	if err != nil {
+		return err
+	}
+
+	tables := cfg.TableNames
+	if len(results) > 0 {
+		tables = make([]string, len(results))
+		for i, result := range results {
+			tables[i] = result.TableName
+		}
+	}
+
+	for i, table := range tables {
+		count, values, err := database.DistinctValues(db.DB, table, column, listValues)
+		if err != nil {
+			return err
+		}
+		if listValues && i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "Table '%s': %d distinct values in column '%s'\n", table, count, column)
+		for _, value := range values {
+			fmt.Fprintf(out, "  %s\n", value)
+		}
+	}
+	return nil
+}
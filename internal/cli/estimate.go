@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/yatisql/yatisql-go/internal/database"
+)
+
+// estimateQuery warns on out about every table of at least minRows rows that
+// a query would scan in full, before it runs, so that the user can index the
+// columns it filters on instead. label names the query in the warning. A
+// query that cannot be explained is left for its execution to report.
+func estimateQuery(out io.Writer, db *sql.DB, label, sqlQuery string, minRows int64) {
+	scans, err := database.FullScans(db, sqlQuery)
+	if err != nil {
+		return
+	}
+	for _, scan := range scans {
+		if scan.Rows < minRows {
+			continue
+		}
+		warnColor.Fprintf(out, "Warning: %s scans ~%s rows of '%s' without an index; if it filters or joins on a column, index it with -x\n", label, fmtCount(scan.Rows), scan.Table)
+	}
+}
+
+// fmtCount formats a row count to two significant figures, e.g. "12K" or "1.2M".
+func fmtCount(n int64) string {
+	switch {
+	case n >= 10_000_000:
+		return fmt.Sprintf("%.0fM", float64(n)/1e6)
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 10_000:
+		return fmt.Sprintf("%.0fK", float64(n)/1e3)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fK", float64(n)/1e3)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yatisql/yatisql-go/internal/config"
+	"github.com/yatisql/yatisql-go/internal/importer"
+)
+
+// tryDelimiterLines is how many lines of each input file --try-delimiters
+// samples to choose its delimiter.
+const tryDelimiterLines = 100
+
+// explainDelimiters writes, for every input file, how its first
+// cfg.ExplainDelim lines split on each candidate delimiter, best first,
+// next to the delimiter the file would be imported with.
+func explainDelimiters(cfg *config.Config, out io.Writer) error {
+	for i, inputFile := range cfg.InputFiles {
+		input := importer.FileInput{FilePath: inputFile, Encoding: cfg.EncodingFor(i), SkipLines: cfg.SkipLines, CommentChar: cfg.CommentChar}
+		delimiter := cfg.Delimiter
+		if delimiter == 0 {
+			delimiter = importer.ExtensionDelimiter(inputFile)
+		}
+		if delimiter == 0 {
+			sniffed, err := importer.SniffInputDelimiter(input)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", inputFile, err)
+			}
+			delimiter = sniffed
+		}
+		scores, err := importer.ExplainDelimiter(input, cfg.ExplainDelim)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", inputFile, err)
+		}
+
+		chosen := delimiterName(delimiter)
+		if cfg.MultiDelimiter != "" {
+			chosen = fmt.Sprintf("--multi-delimiter %q", cfg.MultiDelimiter)
+		}
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s: importing with %s (%d lines sampled)\n", inputFile, chosen, scores[0].Lines)
+
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "DELIMITER\tCONSISTENT\tFIELDS PER LINE")
+		for _, score := range scores {
+			fmt.Fprintf(tw, "%s\t%.0f%%\t%s\n", delimiterName(score.Delimiter), score.Share*100, fieldCounts(score))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		best := scores[0]
+		switch {
+		case best.Fields <= 1:
+			fmt.Fprintln(out, "No candidate splits the lines into several fields; the file will import as one column")
+		case best.Delimiter != delimiter || cfg.MultiDelimiter != "":
+			fmt.Fprintf(out, "The lines split best on %s: try --delimiter %s\n", delimiterName(best.Delimiter), delimiterName(best.Delimiter))
+		}
+	}
+	return nil
+}
+
+// delimiterName returns the name of a delimiter as used in --delimiter.
+func delimiterName(delimiter rune) string {
+	switch delimiter {
+	case ',':
+		return "comma"
+	case '\t':
+		return "tab"
+	case ';':
+		return "semicolon"
+	case '|':
+		return "pipe"
+	default:
+		return fmt.Sprintf("'char:%c'", delimiter)
+	}
+}
+
+// fieldCounts formats a score's field count distribution, most common first,
+// e.g. "3 (18 lines), 1 (2 lines)".
+func fieldCounts(score importer.DelimiterScore) string {
+	counts := make([]int, 0, len(score.FieldCounts))
+	for fields := range score.FieldCounts {
+		counts = append(counts, fields)
+	}
+	sort.Slice(counts, func(a, b int) bool {
+		la, lb := score.FieldCounts[counts[a]], score.FieldCounts[counts[b]]
+		if la != lb {
+			return la > lb
+		}
+		return counts[a] > counts[b]
+	})
+
+	parts := make([]string, len(counts))
+	for i, fields := range counts {
+		lines := score.FieldCounts[fields]
+		parts[i] = fmt.Sprintf("%d (%d lines)", fields, lines)
+		if lines == 1 {
+			parts[i] = fmt.Sprintf("%d (1 line)", fields)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/yatisql/yatisql-go/internal/exporter"
+)
+
+// manifestEntry describes one output file produced by a run.
+type manifestEntry struct {
+	Path       string `json:"path"`
+	Format     string `json:"format"`
+	QueryIndex int    `json:"query_index"` // 1-based, matching "query N" in messages
+	Rows       int    `json:"rows"`
+	Truncated  bool   `json:"truncated,omitempty"` // Rows were cut off by --max-rows
+	Bytes      int64  `json:"bytes"`
+}
+
+// writeManifest writes a JSON array describing every file written by the
+// queries, in query order. Results written to stdout are not listed.
+func writeManifest(path string, results []*exporter.Result) error {
+	entries := []manifestEntry{}
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		for _, out := range result.Outputs {
+			if out.Path == "" {
+				continue
+			}
+			entries = append(entries, manifestEntry{
+				Path:       out.Path,
+				Format:     out.Format,
+				QueryIndex: i + 1,
+				Rows:       result.RowCount,
+				Truncated:  result.Truncated,
+				Bytes:      out.BytesWritten,
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// metadataSuffix is appended to an output path to name its metadata sidecar.
+const metadataSuffix = ".meta.json"
+
+// outputMetadata describes one output file for data catalogs.
+type outputMetadata struct {
+	Path        string           `json:"path"`
+	Format      string           `json:"format"`
+	Delimiter   string           `json:"delimiter,omitempty"` // CSV/TSV only
+	Compression string           `json:"compression"`         // "gzip", "bzip2" or "none"
+	Query       string           `json:"query"`
+	Rows        int              `json:"rows"`
+	Bytes       int64            `json:"bytes"`
+	Columns     []metadataColumn `json:"columns"`
+}
+
+// metadataColumn is a result column in an outputMetadata.
+type metadataColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // SQLite type, "" if every value is NULL
+}
+
+// writeMetadata writes a <path>.meta.json sidecar next to every file written
+// by the queries, describing its columns, rows and encoding. queries holds
+// the query text as given by the user, by query index.
+func writeMetadata(queries []string, results []*exporter.Result) ([]string, error) {
+	var written []string
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+
+		columns := make([]metadataColumn, len(result.Columns))
+		for j, name := range result.Columns {
+			columns[j] = metadataColumn{Name: name}
+			if j < len(result.ColumnTypes) {
+				columns[j].Type = result.ColumnTypes[j]
+			}
+		}
+
+		for _, out := range result.Outputs {
+			if out.Path == "" {
+				continue
+			}
+			meta := outputMetadata{
+				Path:        out.Path,
+				Format:      out.Format,
+				Compression: "none",
+				Query:       queries[i],
+				Rows:        result.RowCount,
+				Bytes:       out.BytesWritten,
+				Columns:     columns,
+			}
+			if out.Delimiter != 0 {
+				meta.Delimiter = string(out.Delimiter)
+			}
+			if out.Compression != "" {
+				meta.Compression = out.Compression
+			}
+
+			data, err := json.MarshalIndent(meta, "", "  ")
+			if err != nil {
+				return written, fmt.Errorf("failed to encode metadata for %s: %w", out.Path, err)
+			}
+			path := out.Path + metadataSuffix
+			if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+				return written, fmt.Errorf("failed to write metadata for %s: %w", out.Path, err)
+			}
+			written = append(written, path)
+		}
+	}
+	return written, nil
+}
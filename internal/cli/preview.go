@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// previewTable writes the first n rows of table to out as an aligned table,
+// so the user can check that the delimiter and header were parsed as
+// expected. NULL values are shown as NULL.
+func previewTable(out io.Writer, db *sql.DB, table string, n int) error {
+	quoted := `"` + strings.ReplaceAll(table, `"`, `""`) + `"`
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT %d", quoted, n))
+	if err != nil {
+		return fmt.Errorf("failed to preview table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+
+	fmt.Fprintf(out, "Preview of table '%s' (first %d rows):\n", table, n)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	fields := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read row of %s: %w", table, err)
+		}
+		for i, value := range values {
+			fields[i] = value.String
+			if !value.Valid {
+				fields[i] = "NULL"
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to preview table %s: %w", table, err)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	return nil
+}
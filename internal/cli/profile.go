@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiles starts a CPU profile written to cpuFile and arranges for a
+// heap profile to be written to memFile. Either may be empty to skip it.
+// The returned stop function ends the CPU profile and writes the heap
+// profile; it must be called once the work being profiled is done.
+func startProfiles(cpuFile, memFile string) (func() error, error) {
+	var cpu *os.File
+	if cpuFile != "" {
+		f, err := os.Create(cpuFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+		cpu = f
+	}
+
+	return func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				return fmt.Errorf("failed to write CPU profile: %w", err)
+			}
+		}
+		if memFile == "" {
+			return nil
+		}
+
+		f, err := os.Create(memFile)
+		if err != nil {
+			return fmt.Errorf("failed to create memory profile: %w", err)
+		}
+		defer f.Close()
+		// Collect garbage first so the profile shows up-to-date live objects
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return fmt.Errorf("failed to write memory profile: %w", err)
+		}
+		return f.Close()
+	}, nil
+}
@@ -328,6 +328,19 @@ func fmtNum(n int64) string {
 	return fmt.Sprintf("%d", n)
 }
 
+func fmtBytes(n int64) string {
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	}
+	if n >= 1<<20 {
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+	if n >= 1<<10 {
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
 func getShortPath(filePath string) string {
 	parts := strings.Split(filePath, "/")
 	if len(parts) > 0 {
@@ -343,3 +356,13 @@ func isTerminal() bool {
 	}
 	return (fileInfo.Mode() & os.ModeCharDevice) != 0
 }
+
+// stdinIsTerminal reports whether stdin is an interactive terminal rather than
+// piped data. It is a variable so tests can simulate a terminal.
+var stdinIsTerminal = func() bool {
+	fileInfo, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return (fileInfo.Mode() & os.ModeCharDevice) != 0
+}
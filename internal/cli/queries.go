@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// querySource is a query given on the command line: inline with -q, or as
+// the path of a file holding it with --query-file.
+type querySource struct {
+	sql  string
+	path string // File to read the query from ("" = inline); "-" is stdin
+}
+
+// queryFlag is the flag value of -q or --query-file. Both append to the same
+// list so that queries run in the order they were given.
+type queryFlag struct {
+	sources *[]querySource
+	file    bool
+}
+
+// Set adds the comma-separated queries or paths of one flag, split as
+// pflag's string slices are.
+func (f *queryFlag) Set(value string) error {
+	if value == "" {
+		return nil
+	}
+	values, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if f.file {
+			*f.sources = append(*f.sources, querySource{path: v})
+		} else {
+			*f.sources = append(*f.sources, querySource{sql: v})
+		}
+	}
+	return nil
+}
+
+func (f *queryFlag) String() string {
+	var values []string
+	for _, source := range *f.sources {
+		if !f.file && source.path == "" {
+			values = append(values, source.sql)
+		} else if f.file && source.path != "" {
+			values = append(values, source.path)
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *queryFlag) Type() string {
+	return "strings"
+}
+
+// readsStdin reports whether one of sources is read from stdin.
+func readsStdin(sources []querySource) bool {
+	for _, source := range sources {
+		if source.path == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveQueries returns the text of each query source, in order, reading
+// files as needed.
+func resolveQueries(sources []querySource) ([]string, error) {
+	queries := make([]string, 0, len(sources))
+	readStdin := false
+	for _, source := range sources {
+		if source.path == "" {
+			queries = append(queries, source.sql)
+			continue
+		}
+
+		var content []byte
+		var err error
+		if source.path == "-" {
+			if readStdin {
+				return nil, fmt.Errorf("--query-file: stdin can only be read once")
+			}
+			readStdin = true
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(source.path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read query file %s: %w", source.path, err)
+		}
+		sql := strings.TrimSpace(string(content))
+		if sql == "" {
+			return nil, fmt.Errorf("--query-file: %s holds no query", source.path)
+		}
+		queries = append(queries, sql)
+	}
+	return queries, nil
+}
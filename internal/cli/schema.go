@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yatisql/yatisql-go/internal/config"
+	"github.com/yatisql/yatisql-go/internal/database"
+	"github.com/yatisql/yatisql-go/internal/importer"
+)
+
+// checkSchema writes, for every input, how its headers differ from the
+// columns of the existing table it would be imported into, without importing
+// anything. It fails if an input could not be appended to its table.
+func checkSchema(db *database.DB, cfg *config.Config, warn *warner, out io.Writer) error {
+	inputs, err := fileInputs(cfg, warn)
+	if err != nil {
+		return err
+	}
+
+	mismatched := 0
+	for _, input := range inputs {
+		headers, err := importer.ReadHeaders(input)
+		if err != nil {
+			return fmt.Errorf("%s: %w", input.FilePath, err)
+		}
+		diff, err := database.DiffColumns(db.DB, input.TableName, headers)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case diff == nil:
+			fmt.Fprintf(out, "%s: table '%s' does not exist and would be created\n", input.FilePath, input.TableName)
+			continue
+		case diff.Matches() && !diff.Reordered:
+			fmt.Fprintf(out, "%s: matches table '%s'\n", input.FilePath, input.TableName)
+			continue
+		case diff.Matches():
+			fmt.Fprintf(out, "%s: has the columns of table '%s' in a different order\n", input.FilePath, input.TableName)
+		default:
+			mismatched++
+			fmt.Fprintf(out, "%s: does not match table '%s'\n", input.FilePath, input.TableName)
+		}
+		if len(diff.Added) > 0 {
+			fmt.Fprintf(out, "  added:     %s\n", strings.Join(diff.Added, ", "))
+		}
+		if len(diff.Removed) > 0 {
+			fmt.Fprintf(out, "  removed:   %s\n", strings.Join(diff.Removed, ", "))
+		}
+		if diff.Reordered {
+			fmt.Fprintf(out, "  reordered: table has (%s), input has (%s)\n", strings.Join(diff.Columns, ", "), strings.Join(diff.Headers, ", "))
+		}
+	}
+
+	if mismatched > 0 {
+		return fmt.Errorf("%d of %d inputs do not match the columns of their table", mismatched, len(inputs))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yatisql/yatisql-go/internal/importer"
+)
+
+// phaseTiming is how long one phase of a run took.
+type phaseTiming struct {
+	phase    string
+	duration time.Duration
+	rows     int64 // Rows the phase handled (-1 = not counted)
+}
+
+// importTimings returns the parse, write and index phases of the imports,
+// each summed over the files, which may have been imported concurrently.
+func importTimings(results []*importer.Result) []phaseTiming {
+	parse := phaseTiming{phase: "parse"}
+	write := phaseTiming{phase: "write"}
+	index := phaseTiming{phase: "index", rows: -1}
+	for _, result := range results {
+		parse.duration += result.ParseTime
+		parse.rows += int64(result.RowCount)
+		write.duration += result.WriteTime
+		write.rows += int64(result.RowCount)
+		index.duration += result.IndexTime
+	}
+	return []phaseTiming{parse, write, index}
+}
+
+// queryTiming returns the phase of query i, which started at start and
+// produced the given number of rows.
+func queryTiming(i int, start time.Time, rows int) phaseTiming {
+	return phaseTiming{phase: fmt.Sprintf("query %d", i+1), duration: time.Since(start), rows: int64(rows)}
+}
+
+// writeTimings writes the duration of each phase, and the rows per second of
+// those that count rows, as an aligned table, followed by the total.
+func writeTimings(out io.Writer, timings []phaseTiming, total time.Duration) error {
+	fmt.Fprintln(out, "Timing (import phases are summed over files):")
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tDURATION\tROWS\tROWS/SEC")
+	for _, timing := range timings {
+		rows, rate := "", ""
+		if timing.rows >= 0 {
+			rows = fmt.Sprintf("%d", timing.rows)
+			if seconds := timing.duration.Seconds(); seconds > 0 {
+				rate = fmt.Sprintf("%.0f", float64(timing.rows)/seconds)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%s\t%s\n", timing.phase, timing.duration.Round(time.Microsecond), rows, rate)
+	}
+	fmt.Fprintf(tw, "total\t%v\t\t\n", total.Round(time.Microsecond))
+	return tw.Flush()
+}
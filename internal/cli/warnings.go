@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// warner reports data-quality problems that are tolerated by default.
+// In strict mode every such problem is escalated to an error instead.
+type warner struct {
+	strict bool
+}
+
+// Warn reports a data-quality problem.
+// In strict mode it returns the problem as an error and prints nothing;
+// otherwise it prints a warning to stderr and returns nil.
+func (w *warner) Warn(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if w.strict {
+		return errors.New(msg)
+	}
+	warnColor.Fprintf(os.Stderr, "Warning: %s\n", msg)
+	return nil
+}
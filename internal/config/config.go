@@ -2,25 +2,122 @@
 package config
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yatisql/yatisql-go/internal/database"
+	"github.com/yatisql/yatisql-go/internal/exporter"
+	"github.com/yatisql/yatisql-go/internal/importer"
+	"github.com/yatisql/yatisql-go/internal/query"
 )
 
 // Config holds all configuration options for yatisql.
 type Config struct {
-	InputFiles   []string
-	OutputFiles  []string // Multiple output files, one per query
-	SQLQueries   []string // Multiple SQL queries
-	Delimiter    rune
-	DBPath       string
-	TableNames   []string
-	IndexColumns []string // Columns to create indexes on
-	HasHeader    bool
-	KeepDB       bool // Track if db should be kept (explicitly set)
+	InputFiles      []string
+	Commands        []string // Shell commands whose stdout is imported, after InputFiles
+	OutputFiles     []string // Multiple output files, one per query
+	SQLQueries      []string // Multiple SQL queries
+	Select          []string // Columns of the first table to output, instead of SQLQueries
+	Where           string   // Condition on the rows of the first table to output, instead of SQLQueries
+	Delimiter       rune
+	MultiDelimiter  string // Literal multi-character field separator (overrides Delimiter)
+	TryDelimiters   []rune // Candidates each input file is sampled with to choose its delimiter (nil = detect from extension)
+	RecordSep       string // Literal record separator used instead of newlines
+	SkipLines       int    // Raw lines skipped at the start of each input, before the header
+	CommentChar     rune   // Skip lines whose first non-space rune is this (0 = none)
+	OutputDelimiter string // Output delimiter name for exports, as for ParseDelimiter (empty = Delimiter)
+	DBPath          string
+	TableNames      []string
+	StdinTable      string               // Table name for the stdin input (overrides its TableNames entry)
+	IndexColumns    []string             // Columns to create indexes on, in every table
+	TableIndexes    map[string][]string  // Additional index columns by table name
+	UniqueIndexes   []string             // Columns to create UNIQUE indexes on, in every table
+	TableUniques    map[string][]string  // Additional UNIQUE index columns by table name
+	JSONIndexes     []database.JSONIndex // json_extract expressions to index
+	Encodings       []string             // Input encodings, one for all files or one per file
+	ColumnCase      string               // Convert column names to "lower" or "upper" case
+	ExtraColumns    string               // Rows wider than the header: "error", "ignore", "capture" or "" (ignore, or error if strict)
+	StrictColumns   bool                 // Fail on rows narrower than the header instead of padding them
+	LineRange       importer.LineRange   // File lines to import rows from (zero = all)
+	SqueezeSpaces   bool                 // Collapse runs of whitespace within values to one space
+	DropEmptyCols   bool                 // Drop imported columns in which every value is empty
+	InferTypes      int                  // Rows sampled to infer INTEGER/REAL/TEXT column types (0 = all TEXT)
+	HasHeader       bool
+	ColumnNames     []string      // Column names used instead of the header row or col1, col2, ...
+	HeaderOnly      bool          // Create tables from headers without importing rows
+	PreserveHeaders bool          // Record unsanitized headers in the _yatisql_columns table
+	VersionTables   bool          // Rename existing tables to <table>_<timestamp> instead of dropping them
+	Resume          bool          // Checkpoint imports and continue tables an earlier run left unfinished
+	Append          bool          // Insert into existing tables with the same columns instead of replacing them
+	KeepDB          bool          // Track if db should be kept (explicitly set)
+	ReplaceDB       bool          // Delete an existing database at DBPath before opening it
+	QuietTempDB     bool          // Omit the messages about creating and cleaning up a temporary database
+	Strict          bool          // Escalate data-quality warnings to errors
+	ReadOnlyQuery   bool          // Reject queries that modify the database
+	Preview         int           // Print this many rows of each imported table to stderr (0 = none)
+	Estimate        int           // Warn about full scans of tables with at least this many rows (0 = off)
+	Timing          bool          // Report the duration of each import phase and query to stderr
+	ExplainDelim    int           // Report how this many lines of each input split on candidate delimiters, without importing (0 = off)
+	CheckSchema     bool          // Report how the inputs' headers differ from their existing tables, without importing
+	CountOnly       bool          // Report query row counts instead of writing results
+	Scalar          bool          // Print each query's single value to stdout without CSV framing
+	FailIfEmpty     bool          // Fail instead of warning when a query writes no rows to a file
+	AppendOutput    bool          // Append to existing output files instead of replacing them
+	NoHeaderOut     bool          // Omit the header row from CSV/TSV outputs
+	JSONKey         string        // Write JSON outputs as an object keyed by this column
+	OutputFormat    string        // "table" to draw stdout results as an aligned table on a terminal (empty = CSV)
+	MaxRows         int           // Stop writing each query's results after this many rows (0 = all)
+	RotateBytes     int64         // Split output files into parts of about this many bytes (0 = one file)
+	BinarySafe      bool          // Import values as BLOBs and write BLOBs with BinaryEncoding
+	BinaryEncoding  string        // Text encoding of BLOB outputs: "base64" (default) or "hex"
+	ReplaceNaN      bool          // Write NaN and infinite floats as NaNToken
+	NaNToken        string        // Replacement for NaN and infinite floats when ReplaceNaN is set
+	FloatFormat     string        // printf verb for float results, e.g. "%.2f" (empty = shortest exact decimal)
+	NullStrings     []string      // Input values imported as NULL, e.g. "NULL" or "\N"
+	NullOutput      string        // Text written for NULL in CSV/TSV results (default: empty)
+	BusyTimeout     time.Duration // How long to wait on a locked database (0 = driver default)
+	TempStore       string        // Where SQLite keeps temporary sort data: "memory", "file" or "" (default)
+	JournalMode     string        // SQLite journal_mode, e.g. "delete" ("" = WAL)
+	Synchronous     string        // SQLite synchronous setting, e.g. "full" ("" = NORMAL)
+	ImportJobs      int           // Maximum files imported at once (0 = number of CPUs)
+	BatchSize       int           // Rows inserted per transaction (0 = database.BatchSize)
+	Compat          string        // SQL dialect to accept functions from: "mysql" or "postgres"
+	NullsOrder      string        // Where ORDER BY sorts NULLs: "first", "last" or "" (SQLite default)
+	ManifestPath    string        // Where to write a JSON manifest of produced outputs (empty = none)
+	EmitMetadata    bool          // Write a <output>.meta.json sidecar next to each output file
+	// Value replacements applied on import: column -> original value -> replacement
+	ValueMaps map[string]map[string]string
+	CTEs      []query.CTE     // Shared CTE definitions prepended to every query
+	SortKeys  []query.SortKey // Result columns to sort every query's output by
+	OrderBy   []query.SortKey // Columns of the first table to sort by, instead of SQLQueries
+	// Database files attached to every connection, so queries can join their
+	// tables as name.table
+	Attachments []database.Attachment
+	// Fail on the first value that does not fit its column's type instead of
+	// importing the column as TEXT (requires InferTypes or Append)
+	FailOnTypeMismatch bool
+	// How rows violating a unique constraint of an appended-to table are
+	// inserted: "abort", "ignore", "replace" or "" (abort)
+	OnConflict string
+}
+
+// ShortcutQuery reports whether the query is built from Select, Where and
+// OrderBy rather than given in SQLQueries.
+func (c *Config) ShortcutQuery() bool {
+	return len(c.Select) > 0 || c.Where != "" || len(c.OrderBy) > 0
 }
 
 // ParseDelimiter converts a delimiter string to a rune.
-// Valid values: "comma", "csv", "tab", "tsv", "auto".
+// Valid values: "comma", "csv", "tab", "tsv", "semicolon", "pipe", "auto",
+// and "char:X" for any other single character X.
 // Returns 0 for auto-detection.
 func ParseDelimiter(delimiterStr string) (rune, error) {
 	switch strings.ToLower(delimiterStr) {
@@ -28,17 +125,239 @@ func ParseDelimiter(delimiterStr string) (rune, error) {
 		return ',', nil
 	case "tab", "tsv":
 		return '\t', nil
+	case "semicolon":
+		return ';', nil
+	case "pipe":
+		return '|', nil
 	case "auto":
 		return 0, nil
-	default:
-		return 0, fmt.Errorf("invalid delimiter: %s (use 'comma', 'tab', or 'auto')", delimiterStr)
 	}
+
+	char, ok := strings.CutPrefix(delimiterStr, "char:")
+	if !ok {
+		return 0, fmt.Errorf("invalid delimiter: %s (use 'comma', 'tab', 'semicolon', 'pipe', 'auto', or 'char:X')", delimiterStr)
+	}
+	if utf8.RuneCountInString(char) != 1 {
+		return 0, fmt.Errorf("invalid delimiter: %s (char: takes exactly one character; use --multi-delimiter for longer separators)", delimiterStr)
+	}
+	delimiter, _ := utf8.DecodeRuneInString(char)
+	if !validDelimiter(delimiter) {
+		return 0, fmt.Errorf("invalid delimiter: %s (quotes and control characters other than tab cannot delimit fields)", delimiterStr)
+	}
+	return delimiter, nil
+}
+
+// ParseDelimiterList parses a list of candidate delimiters written as one
+// string of characters with Go string escapes, e.g. `,;|\t`.
+func ParseDelimiterList(list string) ([]rune, error) {
+	parsed, err := ParseSeparator(list)
+	if err != nil {
+		return nil, err
+	}
+	var delimiters []rune
+	for _, delimiter := range parsed {
+		if !validDelimiter(delimiter) {
+			return nil, fmt.Errorf("invalid delimiter list %q: %q cannot delimit fields (quotes and control characters other than tab are not allowed)", list, delimiter)
+		}
+		if !slices.Contains(delimiters, delimiter) {
+			delimiters = append(delimiters, delimiter)
+		}
+	}
+	return delimiters, nil
+}
+
+// validDelimiter reports whether a character can delimit fields: the same
+// characters encoding/csv rejects are not allowed, along with control
+// characters other than tab.
+func validDelimiter(delimiter rune) bool {
+	return delimiter != utf8.RuneError && delimiter != '"' && (!unicode.IsControl(delimiter) || delimiter == '\t')
+}
+
+// byteUnits are the multipliers of the size suffixes ParseByteSize accepts.
+var byteUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+}
+
+// ParseByteSize parses a size such as "100MB", "1.5G" or "4096" into bytes.
+// Units are binary, so 1KB is 1024 bytes.
+func ParseByteSize(size string) (int64, error) {
+	trimmed := strings.TrimSpace(size)
+	number := strings.TrimRightFunc(trimmed, unicode.IsLetter)
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(trimmed[len(number):]))]
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if !ok || err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size: %s (use a positive number of bytes, optionally followed by KB, MB or GB)", size)
+	}
+	return int64(value * float64(unit)), nil
+}
+
+// ParseSeparator parses a literal field or record separator written with Go
+// string escapes, so that control characters can be given on the command
+// line, e.g. `\x1e` for the ASCII record separator or `\t` for a tab.
+func ParseSeparator(sep string) (string, error) {
+	parsed, err := strconv.Unquote(`"` + strings.ReplaceAll(sep, `"`, `\"`) + `"`)
+	if err != nil {
+		return "", fmt.Errorf("invalid separator %q: %w", sep, err)
+	}
+	if parsed == "" {
+		return "", fmt.Errorf("invalid separator %q: must not be empty", sep)
+	}
+	return parsed, nil
+}
+
+// ParseIndexSpecs parses index specifications of the form "col1,col2" (every
+// table) or "table:col1,col2" (one table) into the columns indexed in every
+// table and those indexed per table name. Columns joined with "+", e.g.
+// "user_id+created_at", are indexed together by one composite index.
+func ParseIndexSpecs(specs []string) ([]string, map[string][]string, error) {
+	var columns []string
+	var tableColumns map[string][]string
+	for _, spec := range specs {
+		if table, list, ok := strings.Cut(spec, ":"); ok {
+			table = strings.TrimSpace(table)
+			if table == "" {
+				return nil, nil, fmt.Errorf("invalid index %q (use 'column' or 'table:column,column')", spec)
+			}
+			entries, err := indexEntries(spec, list)
+			if err != nil {
+				return nil, nil, err
+			}
+			if tableColumns == nil {
+				tableColumns = make(map[string][]string)
+			}
+			tableColumns[table] = append(tableColumns[table], entries...)
+			if len(tableColumns[table]) == 0 {
+				return nil, nil, fmt.Errorf("invalid index %q: no columns for table %s", spec, table)
+			}
+			continue
+		}
+		entries, err := indexEntries(spec, spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		columns = append(columns, entries...)
+	}
+	return columns, tableColumns, nil
+}
+
+// indexEntries splits the comma-separated index columns of spec, with the
+// columns of each composite index trimmed and checked to be non-empty.
+func indexEntries(spec, list string) ([]string, error) {
+	entries := splitList(list)
+	for i, entry := range entries {
+		group := database.SplitIndexColumns(entry)
+		if len(group) == 1 {
+			continue
+		}
+		for _, column := range group {
+			if column == "" {
+				return nil, fmt.Errorf("invalid index %q: empty column in composite index %q", spec, entry)
+			}
+		}
+		entries[i] = strings.Join(group, database.CompositeIndexSeparator)
+	}
+	return entries, nil
+}
+
+// IndexColumnsFor returns the columns to index in the named table.
+func (c *Config) IndexColumnsFor(tableName string) []string {
+	return indexColumnsFor(c.IndexColumns, c.TableIndexes, tableName)
+}
+
+// UniqueIndexColumnsFor returns the columns to create UNIQUE indexes on in
+// the named table.
+func (c *Config) UniqueIndexColumnsFor(tableName string) []string {
+	return indexColumnsFor(c.UniqueIndexes, c.TableUniques, tableName)
+}
+
+// indexColumnsFor returns columns followed by the per-table columns of the
+// named table.
+func indexColumnsFor(columns []string, tableColumns map[string][]string, tableName string) []string {
+	for table, list := range tableColumns {
+		if strings.EqualFold(table, tableName) {
+			columns = append(append([]string{}, columns...), list...)
+		}
+	}
+	return columns
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseValueMap parses a value mapping of the form
+// "column:from=to;from2=to2" and adds its replacements to maps.
+func ParseValueMap(spec string, maps map[string]map[string]string) error {
+	column, pairs, ok := strings.Cut(spec, ":")
+	column = strings.TrimSpace(column)
+	if !ok || column == "" {
+		return fmt.Errorf("invalid value map %q (use 'column:from=to;from2=to2')", spec)
+	}
+
+	for _, pair := range strings.Split(pairs, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid value map %q: missing '=' in %q", spec, pair)
+		}
+		addValueMapping(maps, column, from, to)
+	}
+	return nil
+}
+
+// ReadValueMapFile reads value replacements from a CSV file with one
+// "column,from,to" mapping per row and adds them to maps. A first row of
+// exactly "column,from,to" is treated as a header and skipped.
+func ReadValueMapFile(path string, maps map[string]map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open value map file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 3
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read value map file %s: %w", path, err)
+		}
+		if line == 1 && strings.EqualFold(strings.Join(record, ","), "column,from,to") {
+			continue
+		}
+		if strings.TrimSpace(record[0]) == "" {
+			return fmt.Errorf("value map file %s line %d: empty column name", path, line)
+		}
+		addValueMapping(maps, strings.TrimSpace(record[0]), record[1], record[2])
+	}
+}
+
+func addValueMapping(maps map[string]map[string]string, column, from, to string) {
+	if maps[column] == nil {
+		maps[column] = make(map[string]string)
+	}
+	maps[column][from] = to
 }
 
 // Validate checks if the configuration is valid.
 func (c *Config) Validate() error {
 	// Check if we have at least one input file or query
-	if len(c.InputFiles) == 0 && len(c.SQLQueries) == 0 {
+	if len(c.InputFiles) == 0 && len(c.Commands) == 0 && len(c.SQLQueries) == 0 && !c.ShortcutQuery() {
 		return fmt.Errorf("must specify at least one input file or a query")
 	}
 
@@ -53,9 +372,189 @@ func (c *Config) Validate() error {
 	if hasStdin && len(c.SQLQueries) > 1 {
 		return fmt.Errorf("multiple queries not supported with stdin input (stdin can only be read once)")
 	}
+	if len(c.Select) > 0 && len(c.SQLQueries) > 0 {
+		return fmt.Errorf("--select and -q cannot be used together")
+	}
+	if c.Where != "" && len(c.SQLQueries) > 0 {
+		return fmt.Errorf("--where and -q cannot be used together")
+	}
+	if len(c.OrderBy) > 0 && len(c.SQLQueries) > 0 {
+		return fmt.Errorf("--order-by and -q cannot be used together (use --sort-output to sort query results)")
+	}
+	if c.StdinTable != "" && !hasStdin {
+		return fmt.Errorf("--stdin-table requires reading from stdin (-i - or no -i)")
+	}
+
+	if c.Preview < 0 {
+		return fmt.Errorf("preview row count must not be negative, got %d", c.Preview)
+	}
+	if c.Estimate < 0 {
+		return fmt.Errorf("estimate row count must not be negative, got %d", c.Estimate)
+	}
+	if c.ExplainDelim < 0 {
+		return fmt.Errorf("explain-delimiter line count must not be negative, got %d", c.ExplainDelim)
+	}
+	if c.ExplainDelim > 0 && len(c.InputFiles) == 0 {
+		return fmt.Errorf("explaining delimiters requires input files")
+	}
+
+	if c.CheckSchema && c.DBPath == "" {
+		return fmt.Errorf("checking the schema requires a database path")
+	}
+	if c.CheckSchema && len(c.InputFiles) == 0 && len(c.Commands) == 0 {
+		return fmt.Errorf("checking the schema requires input files")
+	}
+	if c.CheckSchema && c.ReplaceDB {
+		return fmt.Errorf("checking the schema cannot be combined with replacing the database")
+	}
+
+	for _, name := range c.ColumnNames {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("column names must not be empty")
+		}
+	}
+
+	if c.SkipLines < 0 {
+		return fmt.Errorf("skip-lines count must not be negative, got %d", c.SkipLines)
+	}
+	if (c.SkipLines > 0 || c.CommentChar != 0) && c.RecordSep != "" {
+		return fmt.Errorf("skipping lines cannot be combined with a record separator, which does not split the input into lines")
+	}
+
+	if c.ImportJobs < 0 {
+		return fmt.Errorf("import concurrency must be at least 1, got %d", c.ImportJobs)
+	}
+	if c.BatchSize < 0 {
+		return fmt.Errorf("batch size must be at least 1, got %d", c.BatchSize)
+	}
+
+	if c.ReplaceDB && c.DBPath == "" {
+		return fmt.Errorf("replacing the database requires a database path")
+	}
+
+	if c.Resume && c.DBPath == "" {
+		return fmt.Errorf("resuming imports requires a database path, where progress is recorded")
+	}
+	if c.Resume && c.DropEmptyCols {
+		// A finished table may have lost columns that rows read later still have
+		return fmt.Errorf("dropping empty columns cannot be combined with resuming imports")
+	}
+	if c.Append && c.DBPath == "" {
+		return fmt.Errorf("appending to tables requires a database path")
+	}
+	if c.Append && c.Resume {
+		// A checkpoint counts the file's rows, not those the table already had
+		return fmt.Errorf("appending to tables cannot be combined with resuming imports")
+	}
+	if c.Append && c.VersionTables {
+		return fmt.Errorf("appending to tables cannot be combined with versioning them, which replaces them")
+	}
+	if c.InferTypes < 0 {
+		return fmt.Errorf("infer-types row count must not be negative, got %d", c.InferTypes)
+	}
+	if c.InferTypes > 0 && c.Resume {
+		// Values an interrupted run stored may not fit the inferred types
+		return fmt.Errorf("inferring column types cannot be combined with resuming imports")
+	}
+	if c.InferTypes > 0 && c.BinarySafe {
+		return fmt.Errorf("inferring column types cannot be combined with --binary-safe, which stores every value as a BLOB")
+	}
+	if c.FailOnTypeMismatch && c.InferTypes == 0 && !c.Append {
+		return fmt.Errorf("failing on type mismatches requires --infer-types or --append, which give columns types")
+	}
+
+	switch c.ColumnCase {
+	case "", "lower", "upper":
+	default:
+		return fmt.Errorf("invalid column case: %s (use 'lower' or 'upper')", c.ColumnCase)
+	}
 
-	// If outputs are provided, they must match query count
-	if len(c.OutputFiles) > 0 && len(c.SQLQueries) > 0 {
+	switch c.ExtraColumns {
+	case "", "error", "ignore", "capture":
+	default:
+		return fmt.Errorf("invalid extra columns policy: %s (use 'ignore', 'error', or 'capture')", c.ExtraColumns)
+	}
+
+	if c.OutputDelimiter != "" {
+		if _, err := ParseDelimiter(c.OutputDelimiter); err != nil {
+			return fmt.Errorf("invalid output delimiter: %w", err)
+		}
+	}
+
+	if err := query.ValidateDialect(c.Compat); err != nil {
+		return err
+	}
+	if err := query.ValidateNullsOrder(c.NullsOrder); err != nil {
+		return err
+	}
+	if err := database.ValidateTempStore(c.TempStore); err != nil {
+		return err
+	}
+	if err := database.ValidateOnConflict(c.OnConflict); err != nil {
+		return err
+	}
+	if err := database.ValidateJournalMode(c.JournalMode); err != nil {
+		return err
+	}
+	if err := database.ValidateSynchronous(c.Synchronous); err != nil {
+		return err
+	}
+	if err := exporter.ValidateFloatFormat(c.FloatFormat); err != nil {
+		return err
+	}
+	if err := exporter.ValidateBinaryEncoding(c.BinaryEncoding); err != nil {
+		return err
+	}
+
+	// Encodings apply to all inputs (single value) or positionally per input
+	if inputCount := len(c.InputFiles) + len(c.Commands); len(c.Encodings) > 1 && len(c.Encodings) != inputCount {
+		return fmt.Errorf("number of encodings (%d) must be 1 or match number of inputs (%d)", len(c.Encodings), inputCount)
+	}
+
+	if c.CountOnly && len(c.OutputFiles) > 0 {
+		return fmt.Errorf("output files cannot be used with count-only queries (no results are written)")
+	}
+
+	if c.Scalar && (c.CountOnly || len(c.OutputFiles) > 0) {
+		return fmt.Errorf("scalar output is written to stdout and cannot be combined with count-only or output files")
+	}
+
+	if c.RotateBytes < 0 {
+		return fmt.Errorf("rotate-bytes size must not be negative, got %d", c.RotateBytes)
+	}
+	if c.RotateBytes > 0 && len(c.OutputFiles) == 0 {
+		return fmt.Errorf("rotating outputs requires output files (stdout is never split)")
+	}
+	if c.RotateBytes > 0 && c.AppendOutput {
+		return fmt.Errorf("rotating outputs cannot be combined with appending to them")
+	}
+
+	if c.MaxRows < 0 {
+		return fmt.Errorf("max rows must not be negative, got %d", c.MaxRows)
+	}
+
+	if c.OutputFormat != "" {
+		if c.OutputFormat != exporter.FormatTable {
+			return fmt.Errorf("invalid output format: %s (must be 'table')", c.OutputFormat)
+		}
+		if len(c.OutputFiles) > 0 {
+			return fmt.Errorf("the table format is only written to stdout, not to output files")
+		}
+	}
+
+	if c.JSONKey != "" {
+		hasJSON := false
+		for _, outputFile := range c.OutputFiles {
+			hasJSON = hasJSON || exporter.DetectOutputFormat(outputFile) == exporter.FormatJSON
+		}
+		if !hasJSON {
+			return fmt.Errorf("a JSON key requires a .json output file")
+		}
+	}
+
+	// If outputs are provided, they must match query count.
+	// A single query may write to several outputs (e.g. CSV and JSON).
+	if len(c.OutputFiles) > 0 && len(c.SQLQueries) > 1 {
 		if len(c.OutputFiles) != len(c.SQLQueries) {
 			return fmt.Errorf("number of output files (%d) must match number of queries (%d)", len(c.OutputFiles), len(c.SQLQueries))
 		}
@@ -63,3 +562,41 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// ExportDelimiter returns the field delimiter for query outputs. An explicit
+// OutputDelimiter wins ("auto" = detect from each output's extension);
+// otherwise the input Delimiter is used.
+func (c *Config) ExportDelimiter() rune {
+	if c.OutputDelimiter == "" {
+		return c.Delimiter
+	}
+	delimiter, _ := ParseDelimiter(c.OutputDelimiter)
+	return delimiter
+}
+
+// EncodingFor returns the input encoding for the input file at index i.
+// A single encoding applies to every input; an empty result means UTF-8.
+func (c *Config) EncodingFor(i int) string {
+	switch {
+	case len(c.Encodings) == 1:
+		return c.Encodings[0]
+	case i < len(c.Encodings):
+		return c.Encodings[i]
+	default:
+		return ""
+	}
+}
+
+// OutputsFor returns the output files for the query at index i.
+// A single query writes to every output file; otherwise outputs map one per query.
+// An empty string means stdout.
+func (c *Config) OutputsFor(i int) []string {
+	switch {
+	case len(c.OutputFiles) == 0:
+		return []string{""}
+	case len(c.SQLQueries) == 1:
+		return c.OutputFiles
+	default:
+		return []string{c.OutputFiles[i]}
+	}
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -19,7 +22,17 @@ func TestParseDelimiter(t *testing.T) {
 		{"tsv", "tsv", '\t', false},
 		{"auto lowercase", "auto", 0, false},
 		{"auto uppercase", "AUTO", 0, false},
-		{"invalid", "semicolon", 0, true},
+		{"semicolon", "semicolon", ';', false},
+		{"pipe", "Pipe", '|', false},
+		{"char", "char:^", '^', false},
+		{"char non-ASCII", "char:¦", '¦', false},
+		{"char tab", "char:\t", '\t', false},
+		{"char too long", "char:::", 0, true},
+		{"char empty", "char:", 0, true},
+		{"char quote", `char:"`, 0, true},
+		{"char newline", "char:\n", 0, true},
+		{"char control", "char:\x1f", 0, true},
+		{"invalid", "colon", 0, true},
 		{"empty", "", 0, true},
 	}
 
@@ -37,6 +50,86 @@ func TestParseDelimiter(t *testing.T) {
 	}
 }
 
+func TestParseSeparator(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{`\x1e`, "\x1e", false},
+		{`\t`, "\t", false},
+		{`::`, "::", false},
+		{`"|"`, `"|"`, false},
+		{`\u241e`, "\u241e", false},
+		{``, "", true},
+		{`\q`, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSeparator(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSeparator(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSeparator(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseDelimiterList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{`,;|\t`, ",;|\t", false},
+		{`;;,`, ";,", false},
+		{``, "", true},
+		{`,"`, "", true},
+		{`,\n`, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDelimiterList(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDelimiterList(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ParseDelimiterList(%q) = %q, want %q", tt.input, string(got), tt.want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"4096", 4096, false},
+		{"100MB", 100 << 20, false},
+		{"1.5g", 3 << 29, false},
+		{"64 KiB", 64 << 10, false},
+		{"", 0, true},
+		{"0MB", 0, true},
+		{"10TB", 0, true},
+		{"MB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
 func TestConfigValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -65,6 +158,71 @@ func TestConfigValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "invalid column case",
+			config: Config{
+				InputFiles: []string{"data.csv"},
+				ColumnCase: "title",
+			},
+			wantErr: true,
+		},
+		{
+			name: "replace db without path",
+			config: Config{
+				InputFiles: []string{"data.csv"},
+				ReplaceDB:  true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid extra columns policy",
+			config: Config{
+				InputFiles:   []string{"data.csv"},
+				ExtraColumns: "keep",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid nulls order",
+			config: Config{
+				InputFiles: []string{"data.csv"},
+				NullsOrder: "middle",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid compat dialect",
+			config: Config{
+				InputFiles: []string{"data.csv"},
+				Compat:     "oracle",
+			},
+			wantErr: true,
+		},
+		{
+			name: "table format",
+			config: Config{
+				SQLQueries:   []string{"SELECT * FROM data"},
+				OutputFormat: "table",
+			},
+			wantErr: false,
+		},
+		{
+			name: "table format with output file",
+			config: Config{
+				SQLQueries:   []string{"SELECT * FROM data"},
+				OutputFiles:  []string{"out.csv"},
+				OutputFormat: "table",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid output format",
+			config: Config{
+				SQLQueries:   []string{"SELECT * FROM data"},
+				OutputFormat: "xml",
+			},
+			wantErr: true,
+		},
 		{
 			name:    "invalid empty",
 			config:  Config{},
@@ -81,3 +239,153 @@ func TestConfigValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigEncodings(t *testing.T) {
+	cfg := &Config{
+		InputFiles: []string{"a.csv", "b.csv", "c.csv"},
+		Encodings:  []string{"utf-8", "latin1"},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for mismatched encoding count, got nil")
+	}
+
+	cfg.Encodings = []string{"utf-8", "latin1", ""}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.EncodingFor(1); got != "latin1" {
+		t.Errorf("EncodingFor(1) = %q, want %q", got, "latin1")
+	}
+
+	cfg.Encodings = []string{"latin1"}
+	if got := cfg.EncodingFor(2); got != "latin1" {
+		t.Errorf("EncodingFor(2) with single encoding = %q, want %q", got, "latin1")
+	}
+}
+
+func TestConfigOutputsFor(t *testing.T) {
+	single := &Config{
+		InputFiles:  []string{"data.csv"},
+		SQLQueries:  []string{"SELECT * FROM data"},
+		OutputFiles: []string{"out.csv", "out.json"},
+	}
+	if err := single.Validate(); err != nil {
+		t.Fatalf("Validate() single query with two outputs error = %v", err)
+	}
+	if got := single.OutputsFor(0); len(got) != 2 {
+		t.Errorf("OutputsFor(0) = %v, want both outputs", got)
+	}
+
+	multi := &Config{
+		SQLQueries:  []string{"SELECT 1", "SELECT 2"},
+		OutputFiles: []string{"one.csv", "two.csv"},
+	}
+	if got := multi.OutputsFor(1); len(got) != 1 || got[0] != "two.csv" {
+		t.Errorf("OutputsFor(1) = %v, want [two.csv]", got)
+	}
+
+	stdout := &Config{SQLQueries: []string{"SELECT 1"}}
+	if got := stdout.OutputsFor(0); len(got) != 1 || got[0] != "" {
+		t.Errorf("OutputsFor(0) without outputs = %v, want stdout", got)
+	}
+}
+
+func TestConfigExportDelimiter(t *testing.T) {
+	tests := []struct {
+		delimiter rune
+		output    string
+		want      rune
+	}{
+		{delimiter: '\t', output: "", want: '\t'},
+		{delimiter: '\t', output: "comma", want: ','},
+		{delimiter: ',', output: "tab", want: '\t'},
+		{delimiter: '\t', output: "auto", want: 0},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Delimiter: tt.delimiter, OutputDelimiter: tt.output}
+		if got := cfg.ExportDelimiter(); got != tt.want {
+			t.Errorf("ExportDelimiter() with delimiter %q and output %q = %q, want %q", tt.delimiter, tt.output, got, tt.want)
+		}
+	}
+
+	invalid := &Config{InputFiles: []string{"data.tsv"}, OutputDelimiter: "colon"}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate() with invalid output delimiter: expected error, got nil")
+	}
+}
+
+func TestParseIndexSpecs(t *testing.T) {
+	columns, tables, err := ParseIndexSpecs([]string{"created_at", "users:id, email", "orders:user_id", "Users:name"})
+	if err != nil {
+		t.Fatalf("ParseIndexSpecs() error = %v", err)
+	}
+	if strings.Join(columns, ",") != "created_at" {
+		t.Errorf("columns = %v, want [created_at]", columns)
+	}
+	if strings.Join(tables["users"], ",") != "id,email" || strings.Join(tables["orders"], ",") != "user_id" {
+		t.Errorf("tables = %v, want users: id,email and orders: user_id", tables)
+	}
+
+	cfg := &Config{IndexColumns: columns, TableIndexes: tables}
+	if got := strings.Join(cfg.IndexColumnsFor("USERS"), ","); got != "created_at,id,email,name" && got != "created_at,name,id,email" {
+		t.Errorf("IndexColumnsFor(USERS) = %s, want created_at plus id, email and name", got)
+	}
+	if got := strings.Join(cfg.IndexColumnsFor("products"), ","); got != "created_at" {
+		t.Errorf("IndexColumnsFor(products) = %s, want created_at", got)
+	}
+
+	columns, tables, err = ParseIndexSpecs([]string{"user_id + created_at", "orders:user_id+total,id"})
+	if err != nil {
+		t.Fatalf("ParseIndexSpecs() error = %v", err)
+	}
+	if strings.Join(columns, ",") != "user_id+created_at" || strings.Join(tables["orders"], ",") != "user_id+total,id" {
+		t.Errorf("composite indexes = %v, %v, want user_id+created_at and orders: user_id+total,id", columns, tables)
+	}
+
+	for _, spec := range []string{":id", "users:", "users: , ", "user_id+", "orders:+id"} {
+		if _, _, err := ParseIndexSpecs([]string{spec}); err == nil {
+			t.Errorf("ParseIndexSpecs(%q) expected error, got nil", spec)
+		}
+	}
+}
+
+func TestParseValueMap(t *testing.T) {
+	maps := make(map[string]map[string]string)
+	if err := ParseValueMap("country:U.S.A.=USA;United States=USA", maps); err != nil {
+		t.Fatalf("ParseValueMap() error = %v", err)
+	}
+	if err := ParseValueMap("status:=unknown", maps); err != nil {
+		t.Fatalf("ParseValueMap() with empty source error = %v", err)
+	}
+	if got := maps["country"]["United States"]; got != "USA" {
+		t.Errorf("country[United States] = %q, want USA", got)
+	}
+	if got, ok := maps["status"][""]; !ok || got != "unknown" {
+		t.Errorf("status[\"\"] = %q, %v; want unknown", got, ok)
+	}
+
+	for _, spec := range []string{"no-column", ":a=b", "country:USA"} {
+		if err := ParseValueMap(spec, maps); err == nil {
+			t.Errorf("ParseValueMap(%q) expected error, got nil", spec)
+		}
+	}
+}
+
+func TestReadValueMapFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.csv")
+	content := "column,from,to\ncountry,U.S.A.,USA\ncountry,\"United States, The\",USA\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	maps := make(map[string]map[string]string)
+	if err := ReadValueMapFile(path, maps); err != nil {
+		t.Fatalf("ReadValueMapFile() error = %v", err)
+	}
+	if len(maps["country"]) != 2 || maps["country"]["United States, The"] != "USA" {
+		t.Errorf("maps = %v, want two country mappings", maps)
+	}
+	if _, ok := maps["column"]; ok {
+		t.Error("Header row was read as a mapping")
+	}
+}
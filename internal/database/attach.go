@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// Attachment is a database file attached to every connection under a schema
+// name, so queries can read its tables as name.table.
+type Attachment struct {
+	Name string // Schema name, e.g. "sales"
+	Path string // Database file
+}
+
+// attachNamePattern matches schema names that need no quoting in SQL.
+var attachNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseAttachment parses an attachment of the form "name=path.db".
+func ParseAttachment(spec string) (Attachment, error) {
+	name, path, ok := strings.Cut(spec, "=")
+	name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+	if !ok || name == "" || path == "" {
+		return Attachment{}, fmt.Errorf("invalid attachment %q (use 'name=path.db')", spec)
+	}
+	if !attachNamePattern.MatchString(name) {
+		return Attachment{}, fmt.Errorf("invalid attachment name %q: use letters, digits and underscores, not starting with a digit", name)
+	}
+	if strings.EqualFold(name, "main") || strings.EqualFold(name, "temp") {
+		return Attachment{}, fmt.Errorf("invalid attachment name %q: reserved by SQLite", name)
+	}
+	return Attachment{Name: name, Path: path}, nil
+}
+
+// validateAttachments checks that every attached database exists, since
+// ATTACH would otherwise create an empty one, and that no name is repeated.
+func validateAttachments(attachments []Attachment) error {
+	names := make(map[string]bool, len(attachments))
+	for _, attachment := range attachments {
+		if names[strings.ToLower(attachment.Name)] {
+			return fmt.Errorf("database attached as %s more than once", attachment.Name)
+		}
+		names[strings.ToLower(attachment.Name)] = true
+
+		info, err := os.Stat(attachment.Path)
+		if err != nil {
+			return fmt.Errorf("cannot attach %s: %w", attachment.Path, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("cannot attach %s: it is a directory", attachment.Path)
+		}
+	}
+	return nil
+}
+
+// attach attaches databases to a connection. They are detached when the
+// connection closes.
+func attach(conn *sqlite3.SQLiteConn, attachments []Attachment) error {
+	for _, attachment := range attachments {
+		if _, err := conn.Exec(fmt.Sprintf("ATTACH DATABASE ? AS %s", attachment.Name), []driver.Value{attachment.Path}); err != nil {
+			return fmt.Errorf("failed to attach %s as %s: %w", attachment.Path, attachment.Name, err)
+		}
+	}
+	return nil
+}
+
+// AttachDatabases attaches the Options.Attach files to every connection.
+// Imports must run before it: an unqualified statement such as the import's
+// DROP TABLE IF EXISTS falls through to an attached database when this one
+// has no table of that name, which would destroy the attached table.
+//
+// Connections opened from now on are attached by the connect hook, and the
+// idle ones opened earlier are attached here, so it must be called while no
+// connection is in use.
+func (d *DB) AttachDatabases() error {
+	if len(d.attachments) == 0 || d.attached.Swap(true) {
+		return nil
+	}
+
+	// The idle connections are held together so that each is taken once
+	ctx := context.Background()
+	idle := d.DB.Stats().Idle
+	var conns []*sql.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < idle; i++ {
+		conn, err := d.DB.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to attach databases: %w", err)
+		}
+		conns = append(conns, conn)
+
+		// A connection opened since the flag was set is already attached
+		var count int
+		if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_database_list WHERE name = ?", d.attachments[0].Name).Scan(&count); err != nil {
+			return fmt.Errorf("failed to attach databases: %w", err)
+		}
+		if count > 0 {
+			continue
+		}
+		if err := conn.Raw(func(driverConn any) error {
+			return attach(driverConn.(*sqlite3.SQLiteConn), d.attachments)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// CheckpointsTable is the metadata table that records the progress of
+// resumable imports, one row per table.
+const CheckpointsTable = "_yatisql_checkpoints"
+
+// Checkpoint records how many rows of a file a resumable import has
+// committed to a table, so that a later run can continue after them.
+type Checkpoint struct {
+	Table  string
+	Source string // File the rows are read from
+	Rows   int64  // Data rows of the file committed to the table
+}
+
+// SaveCheckpoint creates CheckpointsTable if needed and records cp,
+// replacing any earlier checkpoint of the table.
+func SaveCheckpoint(db *sql.DB, cp Checkpoint) error {
+	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (table_name TEXT NOT NULL PRIMARY KEY COLLATE NOCASE, source TEXT NOT NULL, rows INTEGER NOT NULL)", CheckpointsTable)
+	if err := execWithRetry(db, createSQL); err != nil {
+		return fmt.Errorf("failed to create %s: %w", CheckpointsTable, err)
+	}
+	return retryOnLock(func() error {
+		_, err := db.Exec(checkpointSQL(), cp.Table, cp.Source, cp.Rows)
+		return err
+	})
+}
+
+// checkpointSQL returns the statement that records a checkpoint.
+func checkpointSQL() string {
+	return fmt.Sprintf("INSERT OR REPLACE INTO %s (table_name, source, rows) VALUES (?, ?, ?)", CheckpointsTable)
+}
+
+// LoadCheckpoint returns the checkpoint recorded for a table, or nil if
+// there is none.
+func LoadCheckpoint(db *sql.DB, tableName string) (*Checkpoint, error) {
+	exists, err := hasCheckpoints(db)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	cp := Checkpoint{Table: tableName}
+	err = db.QueryRow(fmt.Sprintf("SELECT source, rows FROM %s WHERE table_name = ?", CheckpointsTable), tableName).Scan(&cp.Source, &cp.Rows)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint of %s: %w", tableName, err)
+	}
+	return &cp, nil
+}
+
+// ClearCheckpoint removes the checkpoint of a table, if any, so that a
+// table imported from scratch is not later resumed from a stale offset.
+func ClearCheckpoint(db *sql.DB, tableName string) error {
+	exists, err := hasCheckpoints(db)
+	if err != nil || !exists {
+		return err
+	}
+	err = retryOnLock(func() error {
+		_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE table_name = ?", CheckpointsTable), tableName)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear checkpoint of %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// hasCheckpoints reports whether the database has a CheckpointsTable.
+func hasCheckpoints(db *sql.DB) (bool, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", CheckpointsTable).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", CheckpointsTable, err)
+	}
+	return count > 0, nil
+}
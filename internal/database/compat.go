@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// registerCompatFunctions registers functions common in MySQL and PostgreSQL
+// that SQLite does not provide.
+func registerCompatFunctions(conn *sqlite3.SQLiteConn) error {
+	functions := map[string]interface{}{
+		"left":  compatLeft,
+		"right": compatRight,
+	}
+	for name, impl := range functions {
+		if err := conn.RegisterFunc(name, impl, true); err != nil {
+			return fmt.Errorf("failed to register function %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// compatLeft returns the first n characters of s, or NULL if s is NULL.
+func compatLeft(s interface{}, n int64) interface{} {
+	if isNullArg(s) {
+		return nil
+	}
+	runes := []rune(compatString(s))
+	if n < 0 {
+		n = 0
+	}
+	if n > int64(len(runes)) {
+		n = int64(len(runes))
+	}
+	return string(runes[:n])
+}
+
+// compatRight returns the last n characters of s, or NULL if s is NULL.
+func compatRight(s interface{}, n int64) interface{} {
+	if isNullArg(s) {
+		return nil
+	}
+	runes := []rune(compatString(s))
+	if n < 0 {
+		n = 0
+	}
+	if n > int64(len(runes)) {
+		n = int64(len(runes))
+	}
+	return string(runes[int64(len(runes))-n:])
+}
+
+// isNullArg reports whether a function argument is SQL NULL, which the
+// driver passes to interface{} parameters as a nil []byte.
+func isNullArg(v interface{}) bool {
+	b, ok := v.([]byte)
+	return v == nil || (ok && b == nil)
+}
+
+// compatString converts a SQLite function argument to text.
+func compatString(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -2,12 +2,19 @@
 package database
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
 // DB wraps a SQLite database connection with additional metadata.
@@ -16,12 +23,174 @@ type DB struct {
 	Path          string
 	IsTemp        bool
 	ShouldCleanup bool
+
+	attachments []Attachment
+	attached    *atomic.Bool // Set by AttachDatabases
+}
+
+// Options configures how a database is opened.
+type Options struct {
+	// BusyTimeout is how long a connection waits for a lock held by another
+	// connection before failing with SQLITE_BUSY. Zero keeps the driver default (5s).
+	BusyTimeout time.Duration
+
+	// CompatFunctions registers MySQL/PostgreSQL functions SQLite lacks
+	// (LEFT, RIGHT) on every connection.
+	CompatFunctions bool
+
+	// Replace deletes an existing database file (and its WAL/journal files)
+	// before opening, so a fresh database is created. Files that are not
+	// SQLite databases are never deleted.
+	Replace bool
+
+	// TempStore is where SQLite keeps temporary tables and indexes, such as
+	// those built by large ORDER BY and GROUP BY queries: TempStoreFile,
+	// TempStoreMemory, or "" for the compiled-in default (usually files).
+	TempStore string
+
+	// JournalMode is the journal_mode of every connection (default:
+	// JournalWAL). WAL lets imports write different tables concurrently;
+	// the other modes serialize them.
+	JournalMode string
+
+	// Synchronous is how often SQLite waits for writes to reach the disk
+	// (default: SynchronousNormal). In WAL mode, NORMAL cannot corrupt the
+	// database, but a power loss may undo the last transactions; FULL avoids
+	// that at the cost of slower imports.
+	Synchronous string
+
+	// Attach lists database files to attach to every connection, so that
+	// queries can join their tables, as name.table, with this database's.
+	// Each file must exist. They are only attached once AttachDatabases is
+	// called, after imports.
+	Attach []Attachment
+}
+
+// Locations for SQLite temporary data (Options.TempStore).
+const (
+	TempStoreFile   = "file"
+	TempStoreMemory = "memory"
+)
+
+// SQLite journal modes (Options.JournalMode).
+const (
+	JournalWAL      = "wal"
+	JournalDelete   = "delete"
+	JournalTruncate = "truncate"
+	JournalMemory   = "memory"
+	JournalOff      = "off"
+)
+
+// SQLite synchronous settings (Options.Synchronous).
+const (
+	SynchronousOff    = "off"
+	SynchronousNormal = "normal"
+	SynchronousFull   = "full"
+	SynchronousExtra  = "extra"
+)
+
+// ValidateTempStore checks that store is empty or a supported temp_store location.
+func ValidateTempStore(store string) error {
+	switch store {
+	case "", TempStoreFile, TempStoreMemory:
+		return nil
+	default:
+		return fmt.Errorf("invalid temp store: %s (use '%s' or '%s')", store, TempStoreMemory, TempStoreFile)
+	}
 }
 
-// Open opens or creates a SQLite database.
-// If dbPath is empty, a temporary database is created.
+// ValidateJournalMode checks that mode is empty or a supported journal_mode.
+func ValidateJournalMode(mode string) error {
+	switch mode {
+	case "", JournalWAL, JournalDelete, JournalTruncate, JournalMemory, JournalOff:
+		return nil
+	default:
+		return fmt.Errorf("invalid journal mode: %s (use '%s', '%s', '%s', '%s' or '%s')", mode, JournalWAL, JournalDelete, JournalTruncate, JournalMemory, JournalOff)
+	}
+}
+
+// ValidateSynchronous checks that setting is empty or a supported synchronous
+// setting.
+func ValidateSynchronous(setting string) error {
+	switch setting {
+	case "", SynchronousOff, SynchronousNormal, SynchronousFull, SynchronousExtra:
+		return nil
+	default:
+		return fmt.Errorf("invalid synchronous setting: %s (use '%s', '%s', '%s' or '%s')", setting, SynchronousOff, SynchronousNormal, SynchronousFull, SynchronousExtra)
+	}
+}
+
+// sqliteHeader is the magic string every SQLite 3 database file starts with.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// pragmas returns the per-connection PRAGMA statements for these options.
+// The busy timeout comes first so that it applies to switching the journal
+// mode, which needs a lock. The journal mode and synchronous defaults are
+// left to a DSN, which may set them itself.
+func (o Options) pragmas(dsn bool) []string {
+	var pragmas []string
+	if o.BusyTimeout > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA busy_timeout=%d", o.BusyTimeout.Milliseconds()))
+	}
+	journalMode, synchronous := o.JournalMode, o.Synchronous
+	if journalMode == "" && !dsn {
+		journalMode = JournalWAL
+	}
+	if synchronous == "" && !dsn {
+		synchronous = SynchronousNormal
+	}
+	if journalMode != "" {
+		pragmas = append(pragmas, "PRAGMA journal_mode="+journalMode)
+	}
+	if synchronous != "" {
+		pragmas = append(pragmas, "PRAGMA synchronous="+synchronous)
+	}
+	if o.TempStore != "" {
+		pragmas = append(pragmas, "PRAGMA temp_store="+o.TempStore)
+	}
+	return pragmas
+}
+
+// IsDSN reports whether a database path is a go-sqlite3 connection string,
+// such as "file:test.db?_busy_timeout=5000", rather than a file path. DSNs
+// are passed to the driver unchanged.
+func IsDSN(dbPath string) bool {
+	return strings.HasPrefix(dbPath, "file:") || strings.Contains(dbPath, "?")
+}
+
+// dsnFile returns the file a DSN opens, or "" for an in-memory database.
+func dsnFile(dsn string) string {
+	file, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if file == ":memory:" {
+		return ""
+	}
+	return file
+}
+
+// Open opens or creates a SQLite database with default options.
+// If dbPath is empty, a temporary database is created. dbPath may also be a
+// DSN (see IsDSN).
 // Returns a DB wrapper that tracks whether cleanup is needed.
 func Open(dbPath string) (*DB, error) {
+	return OpenWithOptions(dbPath, Options{})
+}
+
+// OpenWithOptions opens or creates a SQLite database like Open, applying opts
+// to every connection in the pool.
+func OpenWithOptions(dbPath string, opts Options) (*DB, error) {
+	if err := ValidateTempStore(opts.TempStore); err != nil {
+		return nil, err
+	}
+	if err := ValidateJournalMode(opts.JournalMode); err != nil {
+		return nil, err
+	}
+	if err := ValidateSynchronous(opts.Synchronous); err != nil {
+		return nil, err
+	}
+	if err := validateAttachments(opts.Attach); err != nil {
+		return nil, err
+	}
+
 	var path string
 	var isTemp bool
 	var shouldCleanup bool
@@ -41,31 +210,62 @@ func Open(dbPath string) (*DB, error) {
 		isTemp = false
 		shouldCleanup = false
 
+		// The directory and any replaced database are those of the file a
+		// DSN opens
+		file := path
+		if IsDSN(path) {
+			file = dsnFile(path)
+		}
+
 		// Create directory for database file if it doesn't exist
-		dbDir := filepath.Dir(path)
-		if dbDir != "." && dbDir != "" {
+		dbDir := filepath.Dir(file)
+		if file != "" && dbDir != "." && dbDir != "" {
 			if err := os.MkdirAll(dbDir, 0o755); err != nil {
 				return nil, fmt.Errorf("failed to create database directory %s: %w", dbDir, err)
 			}
 		}
-	}
 
-	db, err := sql.Open("sqlite3", path)
-	if err != nil {
-		if shouldCleanup {
-			os.Remove(path)
+		if opts.Replace && file != "" {
+			if err := removeDatabase(file); err != nil {
+				return nil, err
+			}
 		}
-		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Enable WAL mode for better concurrent write performance
-	// This allows concurrent writes to different tables
-	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+	// Per-connection pragmas must run on every connection the pool opens,
+	// not just the first one, so they are applied from a connect hook.
+	pragmas := opts.pragmas(IsDSN(path))
+	attached := new(atomic.Bool)
+	db := sql.OpenDB(&connector{
+		dsn: path,
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, pragma := range pragmas {
+					if _, err := conn.Exec(pragma, nil); err != nil {
+						return fmt.Errorf("failed to apply %q: %w", pragma, err)
+					}
+				}
+				if attached.Load() {
+					if err := attach(conn, opts.Attach); err != nil {
+						return err
+					}
+				}
+				if opts.CompatFunctions {
+					return registerCompatFunctions(conn)
+				}
+				return nil
+			},
+		},
+	})
+
+	// Connect now so that a journal mode that cannot be enabled is reported
+	// here rather than by the first query
+	if err := db.Ping(); err != nil {
 		db.Close()
 		if shouldCleanup {
 			os.Remove(path)
 		}
-		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	return &DB{
@@ -73,9 +273,53 @@ func Open(dbPath string) (*DB, error) {
 		Path:          path,
 		IsTemp:        isTemp,
 		ShouldCleanup: shouldCleanup,
+		attachments:   opts.Attach,
+		attached:      attached,
 	}, nil
 }
 
+// removeDatabase deletes the SQLite database at path along with its WAL,
+// shared-memory and rollback journal files. A missing file is not an error;
+// a file that is not a SQLite database is refused.
+func removeDatabase(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open existing database %s: %w", path, err)
+	}
+	header := make([]byte, len(sqliteHeader))
+	n, err := io.ReadFull(f, header)
+	f.Close()
+	// An empty file is what SQLite creates before the first write
+	if n > 0 && (err != nil || !bytes.Equal(header, sqliteHeader)) {
+		return fmt.Errorf("refusing to replace %s: not a SQLite database", path)
+	}
+
+	for _, file := range []string{path, path + "-wal", path + "-shm", path + "-journal"} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove existing database %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// connector opens connections to a single DSN using its own driver instance,
+// so connect hooks are scoped to one database rather than registered globally.
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c *connector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
 // Cleanup removes the temporary database file if applicable.
 // Returns any error that occurred during removal.
 func (d *DB) Cleanup() error {
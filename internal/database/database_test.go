@@ -1,9 +1,15 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSanitizeColumnName(t *testing.T) {
@@ -33,6 +39,49 @@ func TestSanitizeColumnName(t *testing.T) {
 	}
 }
 
+func TestApplyColumnCase(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		want string
+	}{
+		{"lower", "lower", "firstname"},
+		{"upper", "upper", "FIRSTNAME"},
+		{"unchanged", "", "FirstName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplyColumnCase("FirstName", tt.mode)
+			if got != tt.want {
+				t.Errorf("ApplyColumnCase(%q, %q) = %q, want %q", "FirstName", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    []string
+	}{
+		{"unique", []string{"id", "name"}, []string{"id", "name"}},
+		{"repeated", []string{"id", "id", "Name", "name"}, []string{"id", "id_2", "Name", "name_2"}},
+		{"sanitized", []string{"first name", "first_name", "first-name"}, []string{"first name", "first_name_2", "first_name_3"}},
+		{"suffix taken", []string{"id", "id", "id_2"}, []string{"id", "id_3", "id_2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DedupeHeaders(tt.headers)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("DedupeHeaders(%q) = %q, want %q", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestOpenTempDatabase(t *testing.T) {
 	db, err := Open("")
 	if err != nil {
@@ -89,6 +138,56 @@ func TestOpenPersistentDatabase(t *testing.T) {
 	}
 }
 
+func TestOpenReplaceDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := CreateTable(db.DB, "old", []string{"id"}); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	db.Close()
+
+	db, err = OpenWithOptions(dbPath, Options{Replace: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&count); err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if count != 0 {
+		t.Errorf("replaced database has %d tables, want 0", count)
+	}
+
+	// Replacing a path that does not exist yet just creates the database
+	newPath := filepath.Join(t.TempDir(), "new.db")
+	newDB, err := OpenWithOptions(newPath, Options{Replace: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() on a new path error = %v", err)
+	}
+	newDB.Close()
+}
+
+func TestOpenReplaceRefusesNonDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("important notes"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if _, err := OpenWithOptions(path, Options{Replace: true}); err == nil {
+		t.Fatal("OpenWithOptions() expected error for a non-database file, got nil")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "important notes" {
+		t.Errorf("file content = %q, %v; want it untouched", content, err)
+	}
+}
+
 func TestOpenDatabaseWithSubdirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "subdir", "nested", "test.db")
@@ -157,6 +256,121 @@ func TestInsertBatchEmpty(t *testing.T) {
 	}
 }
 
+func TestInsertBatchSpansStatements(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name"}
+	if err := CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	// More rows than one statement binds, with a shorter last statement
+	limit, err := parameterLimit(db.DB)
+	if err != nil {
+		t.Fatalf("parameterLimit() error = %v", err)
+	}
+	rows := 2*min(maxStatementRows, limit/len(headers)) + 7
+	batch := make([][]string, rows)
+	for i := range batch {
+		batch[i] = []string{fmt.Sprint(i), fmt.Sprintf("name%d", i)}
+	}
+	if err := InsertBatch(db.DB, "test", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	var count, sum int
+	if err := db.DB.QueryRow("SELECT COUNT(*), SUM(id) FROM test").Scan(&count, &sum); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if count != rows || sum != rows*(rows-1)/2 {
+		t.Errorf("got %d rows summing to %d, want %d summing to %d", count, sum, rows, rows*(rows-1)/2)
+	}
+}
+
+func TestInsertBatchNullStrings(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "note"}
+	if err := CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	batch := [][]string{{"1", "NULL"}, {"2", `\N`}, {"3", ""}, {"4", "null"}}
+	if err := InsertBatchWithOptions(db.DB, "test", headers, batch, InsertOptions{NullStrings: []string{"NULL", `\N`}}); err != nil {
+		t.Fatalf("InsertBatchWithOptions() error = %v", err)
+	}
+
+	// Matching is exact, so the empty and lowercase values stay text
+	var ids string
+	if err := db.QueryRow("SELECT group_concat(id, ',') FROM test WHERE note IS NULL").Scan(&ids); err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if ids != "1,2" {
+		t.Errorf("ids with NULL notes = %s, want 1,2", ids)
+	}
+}
+
+func TestInsertBatchOnConflict(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name"}
+	existing := [][]string{{"1", "Alice"}, {"2", "Bob"}}
+	batch := [][]string{{"2", "Bobby"}, {"3", "Charlie"}}
+
+	tests := []struct {
+		policy  string
+		want    string
+		wantErr bool
+	}{
+		{policy: "", want: "1=Alice,2=Bob", wantErr: true},
+		{policy: ConflictAbort, want: "1=Alice,2=Bob", wantErr: true},
+		{policy: ConflictIgnore, want: "1=Alice,2=Bob,3=Charlie"},
+		{policy: ConflictReplace, want: "1=Alice,2=Bobby,3=Charlie"},
+	}
+
+	for _, tt := range tests {
+		t.Run("policy_"+tt.policy, func(t *testing.T) {
+			if _, err := db.DB.Exec("DROP TABLE IF EXISTS keyed"); err != nil {
+				t.Fatalf("Exec() error = %v", err)
+			}
+			if _, err := db.DB.Exec("CREATE TABLE keyed (id TEXT PRIMARY KEY, name TEXT)"); err != nil {
+				t.Fatalf("Exec() error = %v", err)
+			}
+			if err := InsertBatch(db.DB, "keyed", headers, existing); err != nil {
+				t.Fatalf("InsertBatch() error = %v", err)
+			}
+
+			err := InsertBatchWithOptions(db.DB, "keyed", headers, batch, InsertOptions{OnConflict: tt.policy})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InsertBatchWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got string
+			if err := db.DB.QueryRow("SELECT group_concat(id || '=' || name, ',') FROM (SELECT * FROM keyed ORDER BY id)").Scan(&got); err != nil {
+				t.Fatalf("QueryRow() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if err := InsertBatchWithOptions(db.DB, "keyed", headers, batch, InsertOptions{OnConflict: "merge"}); err == nil {
+		t.Error("InsertBatchWithOptions() with an unknown policy succeeded, want error")
+	}
+}
+
 func TestGetTableColumns(t *testing.T) {
 	db, err := Open("")
 	if err != nil {
@@ -286,3 +500,669 @@ func TestCreateIndexes(t *testing.T) {
 		t.Errorf("Expected 2 indexes, got %d", indexCount)
 	}
 }
+
+func TestCreateCompositeIndex(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "user_id", "created_at"}
+	if err := CreateTable(db.DB, "orders", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	if err := CreateIndexes(db.DB, "orders", []string{"id", "user_id+created_at"}); err != nil {
+		t.Fatalf("CreateIndexes() error = %v", err)
+	}
+
+	// The composite index covers both columns, in order
+	var columns []string
+	rows, err := db.DB.Query("SELECT name FROM pragma_index_info('idx_orders_user_id_created_at') ORDER BY seqno")
+	if err != nil {
+		t.Fatalf("Query index info error = %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		columns = append(columns, name)
+	}
+	if got := strings.Join(columns, ","); got != "user_id,created_at" {
+		t.Errorf("composite index columns = %s, want user_id,created_at", got)
+	}
+
+	if err := CreateIndexes(db.DB, "orders", []string{"user_id+missing"}); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("CreateIndexes() error = %v, want missing column", err)
+	}
+}
+
+func TestCreateUniqueIndex(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "email"}
+	if err := CreateTable(db.DB, "users", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	batch := [][]string{{"1", "a@example.com"}, {"2", "b@example.com"}, {"3", "a@example.com"}}
+	if err := InsertBatch(db.DB, "users", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	if err := CreateUniqueIndex(db.DB, "users", []string{"id"}); err != nil {
+		t.Fatalf("CreateUniqueIndex(id) error = %v", err)
+	}
+	var unique int
+	if err := db.DB.QueryRow("SELECT \"unique\" FROM pragma_index_list('users') WHERE name = 'uidx_users_id'").Scan(&unique); err != nil || unique != 1 {
+		t.Errorf("uidx_users_id unique = %d (error %v), want 1", unique, err)
+	}
+
+	err = CreateUniqueIndex(db.DB, "users", []string{"email"})
+	if err == nil || !strings.Contains(err.Error(), "users (email): 'a@example.com' appears 2 times") {
+		t.Errorf("CreateUniqueIndex(email) error = %v, want the duplicated email", err)
+	}
+
+	// NULLs never collide
+	if _, err := db.DB.Exec("UPDATE users SET email = NULL WHERE id = '3'"); err != nil {
+		t.Fatalf("UPDATE error = %v", err)
+	}
+	if _, err := db.DB.Exec("INSERT INTO users (id, email) VALUES ('4', NULL)"); err != nil {
+		t.Fatalf("INSERT error = %v", err)
+	}
+	if err := CreateUniqueIndex(db.DB, "users", []string{"email"}); err != nil {
+		t.Errorf("CreateUniqueIndex(email) with NULLs error = %v", err)
+	}
+}
+
+func TestOpenWithBusyTimeout(t *testing.T) {
+	db, err := OpenWithOptions("", Options{BusyTimeout: 12 * time.Second})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	defer db.Close()
+
+	// Hold several connections so the pragma is checked on more than one of them
+	var timeouts []int
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := db.DB.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("Conn() error = %v", err)
+		}
+		conns = append(conns, conn)
+
+		var timeout int
+		if err := conn.QueryRowContext(context.Background(), "PRAGMA busy_timeout").Scan(&timeout); err != nil {
+			t.Fatalf("PRAGMA busy_timeout error = %v", err)
+		}
+		timeouts = append(timeouts, timeout)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	for i, timeout := range timeouts {
+		if timeout != 12000 {
+			t.Errorf("connection %d busy_timeout = %d, want 12000", i, timeout)
+		}
+	}
+}
+
+func TestOpenWithTempStore(t *testing.T) {
+	db, err := OpenWithOptions("", Options{TempStore: TempStoreMemory})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	defer db.Close()
+
+	// 2 is MEMORY; check several connections, as for busy_timeout
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := db.DB.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("Conn() error = %v", err)
+		}
+		conns = append(conns, conn)
+
+		var store int
+		if err := conn.QueryRowContext(context.Background(), "PRAGMA temp_store").Scan(&store); err != nil {
+			t.Fatalf("PRAGMA temp_store error = %v", err)
+		}
+		if store != 2 {
+			t.Errorf("connection %d temp_store = %d, want 2 (MEMORY)", i, store)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	// A sort too large for the page cache builds a temporary b-tree
+	var count, first int
+	sortQuery := `WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 200000)
+		SELECT COUNT(*), MIN(x) FROM (SELECT x, printf('%0100d', x) AS pad FROM n ORDER BY pad DESC)`
+	if err := db.DB.QueryRow(sortQuery).Scan(&count, &first); err != nil {
+		t.Fatalf("sort query error = %v", err)
+	}
+	if count != 200000 || first != 1 {
+		t.Errorf("sort query = (%d, %d), want (200000, 1)", count, first)
+	}
+
+	if _, err := OpenWithOptions("", Options{TempStore: "tmpfs"}); err == nil {
+		t.Error("OpenWithOptions() with an invalid temp store succeeded, want error")
+	}
+}
+
+func TestOpenWithAttach(t *testing.T) {
+	salesPath := filepath.Join(t.TempDir(), "sales.db")
+	sales, err := Open(salesPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := CreateTable(sales.DB, "orders", []string{"user_id", "total"}); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := InsertBatch(sales.DB, "orders", []string{"user_id", "total"}, [][]string{{"1", "10"}, {"1", "5"}}); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+	// A table named like the one imported below must survive the import
+	if err := CreateTable(sales.DB, "users", []string{"id"}); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := InsertBatch(sales.DB, "users", []string{"id"}, [][]string{{"7"}}); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+	sales.Close()
+
+	attachment, err := ParseAttachment("sales=" + salesPath)
+	if err != nil {
+		t.Fatalf("ParseAttachment() error = %v", err)
+	}
+	db, err := OpenWithOptions("", Options{Attach: []Attachment{attachment}})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	defer db.Close()
+	if err := CreateTable(db.DB, "users", []string{"id", "name"}); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := InsertBatch(db.DB, "users", []string{"id", "name"}, [][]string{{"1", "Alice"}}); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	// Leave more idle connections than database/sql keeps by default; they
+	// are attached in place, without closing any
+	db.DB.SetMaxIdleConns(4)
+	var idle []*sql.Conn
+	for i := 0; i < 4; i++ {
+		conn, err := db.DB.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("Conn() error = %v", err)
+		}
+		idle = append(idle, conn)
+	}
+	for _, conn := range idle {
+		conn.Close()
+	}
+	if err := db.AttachDatabases(); err != nil {
+		t.Fatalf("AttachDatabases() error = %v", err)
+	}
+	if stats := db.DB.Stats(); stats.Idle != 4 || stats.MaxIdleClosed != 0 {
+		t.Errorf("after AttachDatabases() %d connections are idle and %d were closed, want 4 and 0", stats.Idle, stats.MaxIdleClosed)
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM sales.users").Scan(&id); err != nil || id != 7 {
+		t.Errorf("attached sales.users after import = (%d, %v), want (7, nil)", id, err)
+	}
+
+	// Every connection has the attachment, as for busy_timeout
+	var conns []*sql.Conn
+	for i := 0; i < 5; i++ {
+		conn, err := db.DB.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("Conn() error = %v", err)
+		}
+		conns = append(conns, conn)
+
+		var name string
+		var total int
+		query := "SELECT u.name, SUM(o.total) FROM users u JOIN sales.orders o ON o.user_id = u.id GROUP BY u.name"
+		if err := conn.QueryRowContext(context.Background(), query).Scan(&name, &total); err != nil {
+			t.Fatalf("connection %d join error = %v", i, err)
+		}
+		if name != "Alice" || total != 15 {
+			t.Errorf("connection %d join = (%s, %d), want (Alice, 15)", i, name, total)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	missing := Attachment{Name: "missing", Path: filepath.Join(t.TempDir(), "missing.db")}
+	if _, err := OpenWithOptions("", Options{Attach: []Attachment{missing}}); err == nil {
+		t.Error("OpenWithOptions() attaching a missing file succeeded, want error")
+	}
+	if _, err := os.Stat(missing.Path); !os.IsNotExist(err) {
+		t.Errorf("attaching a missing file created it: Stat() error = %v", err)
+	}
+}
+
+func TestParseAttachment(t *testing.T) {
+	attachment, err := ParseAttachment(" archive = data/old.db ")
+	if err != nil {
+		t.Fatalf("ParseAttachment() error = %v", err)
+	}
+	if attachment.Name != "archive" || attachment.Path != "data/old.db" {
+		t.Errorf("ParseAttachment() = %+v, want archive=data/old.db", attachment)
+	}
+
+	for _, spec := range []string{"archive", "=old.db", "archive=", "1st=old.db", "a-b=old.db", "x; DROP TABLE t=old.db", "main=old.db", "TEMP=old.db"} {
+		if _, err := ParseAttachment(spec); err == nil {
+			t.Errorf("ParseAttachment(%q) expected error, got nil", spec)
+		}
+	}
+}
+
+func TestOpenJournalMode(t *testing.T) {
+	tests := []struct {
+		opts        Options
+		journalMode string
+		synchronous int
+	}{
+		{Options{}, "wal", 1},
+		{Options{JournalMode: JournalDelete, Synchronous: SynchronousFull}, "delete", 2},
+	}
+
+	for _, tt := range tests {
+		db, err := OpenWithOptions("", tt.opts)
+		if err != nil {
+			t.Fatalf("OpenWithOptions(%+v) error = %v", tt.opts, err)
+		}
+		var journalMode string
+		var synchronous int
+		if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+			t.Fatalf("PRAGMA journal_mode error = %v", err)
+		}
+		if err := db.QueryRow("PRAGMA synchronous").Scan(&synchronous); err != nil {
+			t.Fatalf("PRAGMA synchronous error = %v", err)
+		}
+		db.Close()
+		if journalMode != tt.journalMode || synchronous != tt.synchronous {
+			t.Errorf("OpenWithOptions(%+v) journal_mode = %s, synchronous = %d; want %s, %d", tt.opts, journalMode, synchronous, tt.journalMode, tt.synchronous)
+		}
+	}
+
+	if _, err := OpenWithOptions("", Options{JournalMode: "rollback"}); err == nil {
+		t.Error("OpenWithOptions() with an invalid journal mode succeeded, want error")
+	}
+	if _, err := OpenWithOptions("", Options{Synchronous: "sometimes"}); err == nil {
+		t.Error("OpenWithOptions() with an invalid synchronous setting succeeded, want error")
+	}
+}
+
+func TestOpenDSN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dsn.db")
+	dsn := "file:" + path + "?_journal=DELETE&_busy_timeout=7000&_sync=FULL"
+	if !IsDSN(dsn) || IsDSN(path) {
+		t.Fatalf("IsDSN() misclassified %q or %q", dsn, path)
+	}
+
+	db, err := Open(dsn)
+	if err != nil {
+		t.Fatalf("Open(%q) error = %v", dsn, err)
+	}
+	defer db.Close()
+	if db.Path != dsn || db.IsTemp {
+		t.Errorf("Open() Path = %q, IsTemp = %v; want the DSN, not temporary", db.Path, db.IsTemp)
+	}
+
+	// The DSN's pragmas win over the defaults
+	var journalMode string
+	var busyTimeout, synchronous int
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		t.Fatalf("PRAGMA journal_mode error = %v", err)
+	}
+	if err := db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+		t.Fatalf("PRAGMA busy_timeout error = %v", err)
+	}
+	if err := db.QueryRow("PRAGMA synchronous").Scan(&synchronous); err != nil {
+		t.Fatalf("PRAGMA synchronous error = %v", err)
+	}
+	if journalMode != "delete" || busyTimeout != 7000 || synchronous != 2 {
+		t.Errorf("journal_mode = %s, busy_timeout = %d, synchronous = %d; want delete, 7000, 2", journalMode, busyTimeout, synchronous)
+	}
+
+	if err := CreateTable(db.DB, "t", []string{"a"}); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the DSN's file to be created: %v", err)
+	}
+}
+
+func TestEffectiveBatchSize(t *testing.T) {
+	tests := []struct {
+		rows, columns, want int
+	}{
+		{0, 5, BatchSize},
+		{500, 5, 500},
+		{0, 400, MaxBatchValues / 400},
+		{100000, 20, MaxBatchValues / 20},
+		{10, MaxBatchValues * 2, 1},
+	}
+	for _, tt := range tests {
+		if got := EffectiveBatchSize(tt.rows, tt.columns); got != tt.want {
+			t.Errorf("EffectiveBatchSize(%d, %d) = %d, want %d", tt.rows, tt.columns, got, tt.want)
+		}
+	}
+}
+
+func TestInsertBatchConcurrentContention(t *testing.T) {
+	db, err := OpenWithOptions("", Options{BusyTimeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	defer db.Close()
+
+	const writers = 16
+	const batches = 20
+	headers := []string{"id", "value"}
+
+	for w := 0; w < writers; w++ {
+		if err := CreateTable(db.DB, fmt.Sprintf("t%d", w), headers); err != nil {
+			t.Fatalf("CreateTable() error = %v", err)
+		}
+	}
+
+	batch := make([][]string, 100)
+	for i := range batch {
+		batch[i] = []string{fmt.Sprint(i), "x"}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*batches)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(table string) {
+			defer wg.Done()
+			for b := 0; b < batches; b++ {
+				if err := InsertBatch(db.DB, table, headers, batch); err != nil {
+					errs <- err
+				}
+			}
+		}(fmt.Sprintf("t%d", w))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("InsertBatch() under contention error = %v", err)
+	}
+
+	for w := 0; w < writers; w++ {
+		var count int
+		if err := db.DB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM t%d", w)).Scan(&count); err != nil {
+			t.Fatalf("QueryRow() error = %v", err)
+		}
+		if count != batches*len(batch) {
+			t.Errorf("table t%d has %d rows, want %d", w, count, batches*len(batch))
+		}
+	}
+}
+
+func TestOpenWithCompatFunctions(t *testing.T) {
+	db, err := OpenWithOptions("", Options{CompatFunctions: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	defer db.Close()
+
+	var left, right string
+	var leftNull sql.NullString
+	err = db.QueryRow("SELECT LEFT('héllo', 2), RIGHT('héllo', 3), LEFT(NULL, 1)").Scan(&left, &right, &leftNull)
+	if err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if left != "hé" || right != "llo" || leftNull.Valid {
+		t.Errorf("LEFT/RIGHT = %q, %q, %v; want \"hé\", \"llo\", NULL", left, right, leftNull)
+	}
+
+	// Also usable in a LEFT JOIN query, where LEFT is a keyword
+	if _, err := db.Exec("CREATE TABLE a (x TEXT); CREATE TABLE b (x TEXT)"); err != nil {
+		t.Fatalf("CREATE TABLE error = %v", err)
+	}
+	if _, err := db.Exec("SELECT LEFT(a.x, 1) FROM a LEFT JOIN b ON a.x = b.x"); err != nil {
+		t.Errorf("LEFT() with LEFT JOIN error = %v", err)
+	}
+}
+
+func TestJSONColumns(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "payload"}
+	if err := CreateTable(db.DB, "events", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	batch := [][]string{
+		{"1", `{"user": {"id": 7, "tags": ["a", "b"]}, "type": "click"}`},
+		{"2", `{"user": {"id": 9, "tags": []}, "type": "view"}`},
+		{"3", `not json`},
+	}
+	if err := InsertBatch(db.DB, "events", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	// JSON1 functions are built into the driver's SQLite
+	var userID int
+	var tag string
+	err = db.QueryRow("SELECT json_extract(payload, '$.user.id'), json_extract(payload, '$.user.tags[1]') FROM events WHERE json_valid(payload) AND json_extract(payload, '$.type') = 'click'").Scan(&userID, &tag)
+	if err != nil {
+		t.Fatalf("json_extract query error = %v", err)
+	}
+	if userID != 7 || tag != "b" {
+		t.Errorf("json_extract = %d, %q; want 7, \"b\"", userID, tag)
+	}
+
+	index, err := ParseJSONIndex("payload:$.user.id")
+	if err != nil {
+		t.Fatalf("ParseJSONIndex() error = %v", err)
+	}
+
+	// Every row must hold valid JSON for the index expression to be computed
+	if err := CreateJSONIndex(db.DB, "events", index); err == nil {
+		t.Fatal("CreateJSONIndex() with a malformed JSON row: expected error, got nil")
+	}
+	if _, err := db.Exec("DELETE FROM events WHERE NOT json_valid(payload)"); err != nil {
+		t.Fatalf("DELETE error = %v", err)
+	}
+	if err := CreateJSONIndex(db.DB, "events", index); err != nil {
+		t.Fatalf("CreateJSONIndex() error = %v", err)
+	}
+
+	var plan strings.Builder
+	rows, err := db.Query("EXPLAIN QUERY PLAN SELECT id FROM events WHERE json_extract(payload, '$.user.id') = 9")
+	if err != nil {
+		t.Fatalf("EXPLAIN error = %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		plan.WriteString(detail)
+	}
+	if !strings.Contains(plan.String(), "idx_events_payload_user_id") {
+		t.Errorf("query plan = %q, want it to use idx_events_payload_user_id", plan.String())
+	}
+
+	if err := CreateJSONIndex(db.DB, "events", JSONIndex{Column: "missing", Path: "$.a"}); err == nil {
+		t.Error("CreateJSONIndex() on a missing column: expected error, got nil")
+	}
+	for _, spec := range []string{"payload", "payload:user.id", ":$.a"} {
+		if _, err := ParseJSONIndex(spec); err == nil {
+			t.Errorf("ParseJSONIndex(%q): expected error, got nil", spec)
+		}
+	}
+}
+
+func TestVersionTable(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	if name, err := VersionTable(db.DB, "data", now); err != nil || name != "" {
+		t.Fatalf("VersionTable() without a table = %q, %v; want no version", name, err)
+	}
+
+	// Version the same table twice within one second
+	var versions []string
+	for i := 0; i < 2; i++ {
+		if err := CreateTable(db.DB, "data", []string{"id", "name"}); err != nil {
+			t.Fatalf("CreateTable() error = %v", err)
+		}
+		if err := CreateIndex(db.DB, "data", "id"); err != nil {
+			t.Fatalf("CreateIndex() error = %v", err)
+		}
+		name, err := VersionTable(db.DB, "data", now)
+		if err != nil {
+			t.Fatalf("VersionTable() error = %v", err)
+		}
+		versions = append(versions, name)
+	}
+	if want := []string{"data_20240301_093000", "data_20240301_093000_2"}; strings.Join(versions, ",") != strings.Join(want, ",") {
+		t.Errorf("versions = %v, want %v", versions, want)
+	}
+
+	// Each version keeps its index, leaving idx_data_id free for a new table
+	var indexes []string
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'index' ORDER BY name")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		indexes = append(indexes, name)
+	}
+	if want := "idx_data_20240301_093000_2_id,idx_data_20240301_093000_id"; strings.Join(indexes, ",") != want {
+		t.Errorf("indexes = %v, want %s", indexes, want)
+	}
+}
+
+func TestConvertColumnsToText(t *testing.T) {
+	db, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "amount", "code"}
+	if err := CreateTableWithTypes(db.DB, "test", headers, []string{TypeInteger, TypeReal, TypeInteger}); err != nil {
+		t.Fatalf("CreateTableWithTypes() error = %v", err)
+	}
+	opts := InsertOptions{ColumnTypes: []string{TypeInteger, TypeReal, TypeInteger}}
+	if err := InsertBatchWithOptions(db.DB, "test", headers, [][]string{{"1", "2.5", "10"}, {"2", "", ""}, {"3", "4", "X1"}}, opts); err != nil {
+		t.Fatalf("InsertBatchWithOptions() error = %v", err)
+	}
+
+	if err := ConvertColumnsToText(db.DB, "test", []string{"code"}); err != nil {
+		t.Fatalf("ConvertColumnsToText() error = %v", err)
+	}
+
+	var types string
+	if err := db.QueryRow("SELECT group_concat(type, ',') FROM pragma_table_info('test')").Scan(&types); err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if types != "INTEGER,REAL,TEXT" {
+		t.Errorf("Column types = %s, want INTEGER,REAL,TEXT", types)
+	}
+
+	// The empty amount stays NULL; the empty code is text again
+	var nullAmounts int
+	var codes string
+	if err := db.QueryRow("SELECT COUNT(*) - COUNT(amount), group_concat(typeof(code) || ':' || code, ',') FROM test").Scan(&nullAmounts, &codes); err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if nullAmounts != 1 || codes != "text:10,text:,text:X1" {
+		t.Errorf("NULL amounts = %d, codes = %s; want 1 and text:10,text:,text:X1", nullAmounts, codes)
+	}
+}
+
+// insertRowByRow inserts a batch with one statement execution per row, as
+// InsertBatch did before it bound many rows per statement.
+func insertRowByRow(db *sql.DB, tableName string, headers []string, batch [][]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(headers)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, strings.Join(headers, ", "), placeholders))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	values := make([]interface{}, len(headers))
+	for _, row := range batch {
+		for i := range values {
+			values[i] = row[i]
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func BenchmarkInsertBatch(b *testing.B) {
+	headers := []string{"id", "name", "email", "city"}
+	batch := make([][]string, 100000)
+	for i := range batch {
+		batch[i] = []string{fmt.Sprint(i), fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i), "Springfield"}
+	}
+
+	inserts := []struct {
+		name   string
+		insert func(db *sql.DB, tableName string, headers []string, batch [][]string) error
+	}{
+		{"row-by-row", insertRowByRow},
+		{"multi-row", InsertBatch},
+	}
+	for _, ins := range inserts {
+		b.Run(ins.name, func(b *testing.B) {
+			db, err := Open(filepath.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatalf("Open() error = %v", err)
+			}
+			defer db.Close()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if err := CreateTable(db.DB, "bench", headers); err != nil {
+					b.Fatalf("CreateTable() error = %v", err)
+				}
+				b.StartTimer()
+				if err := ins.insert(db.DB, "bench", headers, batch); err != nil {
+					b.Fatalf("insert error = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// JSONIndex is an index on a value inside a JSON column, such as
+// json_extract(payload, '$.user.id'). SQLite only uses it for queries that
+// repeat the same json_extract expression.
+type JSONIndex struct {
+	Column string // Column holding JSON text
+	Path   string // JSON path, e.g. "$.user.id"
+}
+
+// ParseJSONIndex parses a JSON index of the form "column:$.path".
+func ParseJSONIndex(spec string) (JSONIndex, error) {
+	column, path, ok := strings.Cut(spec, ":")
+	column, path = strings.TrimSpace(column), strings.TrimSpace(path)
+	if !ok || column == "" || !strings.HasPrefix(path, "$") {
+		return JSONIndex{}, fmt.Errorf("invalid JSON index %q (use 'column:$.path')", spec)
+	}
+	return JSONIndex{Column: column, Path: path}, nil
+}
+
+// Expression returns the json_extract expression the index covers.
+func (j JSONIndex) Expression() string {
+	return fmt.Sprintf("json_extract(%s, '%s')", SanitizeColumnName(j.Column), strings.ReplaceAll(j.Path, "'", "''"))
+}
+
+// String returns the index in "column:$.path" form.
+func (j JSONIndex) String() string {
+	return j.Column + ":" + j.Path
+}
+
+// CreateJSONIndex creates an index on a json_extract expression for a table.
+// Returns an error if the column doesn't exist.
+func CreateJSONIndex(db *sql.DB, tableName string, index JSONIndex) error {
+	if err := ValidateColumns(db, tableName, []string{index.Column}); err != nil {
+		return err
+	}
+
+	indexName := fmt.Sprintf("idx_%s_%s_%s", tableName, SanitizeColumnName(index.Column), strings.Trim(SanitizeColumnName(index.Path), "_"))
+
+	createSQL := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName, tableName, index.Expression())
+	if err := execWithRetry(db, createSQL); err != nil {
+		return fmt.Errorf("failed to create JSON index on %s.%s: %w", tableName, index, err)
+	}
+
+	return nil
+}
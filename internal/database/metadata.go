@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ColumnsTable is the metadata table that maps sanitized column names back to
+// the headers they were created from.
+const ColumnsTable = "_yatisql_columns"
+
+// SaveOriginalHeaders records the original header of each column of a table
+// in ColumnsTable, replacing any earlier entries for the table. headers are
+// the headers the table was created with and originals the file's headers
+// they came from, in the same order; headers without an original are skipped.
+func SaveOriginalHeaders(db *sql.DB, tableName string, headers, originals []string) error {
+	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (table_name TEXT NOT NULL, column_name TEXT NOT NULL, original_name TEXT NOT NULL, position INTEGER NOT NULL, PRIMARY KEY (table_name, column_name))", ColumnsTable)
+	if err := execWithRetry(db, createSQL); err != nil {
+		return fmt.Errorf("failed to create %s: %w", ColumnsTable, err)
+	}
+
+	return retryOnLock(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE table_name = ?", ColumnsTable), tableName); err != nil {
+			return fmt.Errorf("failed to clear original headers: %w", err)
+		}
+		stmt, err := tx.Prepare(fmt.Sprintf("INSERT OR REPLACE INTO %s (table_name, column_name, original_name, position) VALUES (?, ?, ?, ?)", ColumnsTable))
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for i, original := range originals {
+			if i >= len(headers) {
+				break
+			}
+			if _, err := stmt.Exec(tableName, SanitizeColumnName(headers[i]), original, i+1); err != nil {
+				return fmt.Errorf("failed to save original header %q: %w", original, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	})
+}
+
+// OriginalHeaders returns the original headers recorded for a table by
+// SaveOriginalHeaders, keyed by column name. The result is empty if none
+// were recorded.
+func OriginalHeaders(db *sql.DB, tableName string) (map[string]string, error) {
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", ColumnsTable).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", ColumnsTable, err)
+	}
+	headers := make(map[string]string)
+	if exists == 0 {
+		return headers, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT column_name, original_name FROM %s WHERE table_name = ?", ColumnsTable), tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original headers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column, original string
+		if err := rows.Scan(&column, &original); err != nil {
+			return nil, fmt.Errorf("failed to scan original header: %w", err)
+		}
+		headers[column] = original
+	}
+	return headers, rows.Err()
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TableScan is a table that a query reads in full rather than through an index.
+type TableScan struct {
+	Table string
+	Rows  int64 // Approximate number of rows in the table
+}
+
+// tableAliasRe matches a table named after FROM or JOIN and its alias, if any.
+var tableAliasRe = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+("[^"]+"|\w+)(?:\s+(?:AS\s+)?("[^"]+"|\w+))?`)
+
+// FullScans returns the tables that EXPLAIN QUERY PLAN reports query would
+// scan without an index, with their approximate row counts. Scans of
+// subqueries, CTEs and views are not reported, since their size is unknown.
+func FullScans(db *sql.DB, query string) ([]TableScan, error) {
+	rows, err := db.Query("EXPLAIN QUERY PLAN " + query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain query: %w", err)
+	}
+	var scanned []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read query plan: %w", err)
+		}
+		// e.g. "SCAN data", but not "SCAN data USING COVERING INDEX ..."
+		fields := strings.Fields(detail)
+		if len(fields) == 2 && fields[0] == "SCAN" {
+			scanned = append(scanned, fields[1])
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query plan: %w", err)
+	}
+
+	// The plan names tables by their alias in the query
+	tables := make(map[string]string)
+	for _, match := range tableAliasRe.FindAllStringSubmatch(query, -1) {
+		table := strings.Trim(match[1], `"`)
+		tables[strings.ToLower(table)] = table
+		if alias := strings.Trim(match[2], `"`); alias != "" {
+			tables[strings.ToLower(alias)] = table
+		}
+	}
+
+	var scans []TableScan
+	for _, name := range scanned {
+		table, ok := tables[strings.ToLower(name)]
+		if !ok {
+			table = name
+		}
+		// MAX(rowid) avoids counting the rows; it fails for views and CTEs
+		var count sql.NullInt64
+		if err := db.QueryRow(fmt.Sprintf("SELECT MAX(rowid) FROM %s", quoteIdentifier(table))).Scan(&count); err != nil {
+			continue
+		}
+		scans = append(scans, TableScan{Table: table, Rows: count.Int64})
+	}
+	return scans, nil
+}
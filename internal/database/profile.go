@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ColumnProfile summarizes the values stored in one column of a table.
+type ColumnProfile struct {
+	Name          string `json:"name"`
+	EmptyCount    int64  `json:"empty_count"` // NULL or empty string values
+	DistinctCount int64  `json:"distinct_count"`
+	MinLength     int64  `json:"min_length"` // Over non-NULL values
+	MaxLength     int64  `json:"max_length"`
+}
+
+// ProfileColumns computes a ColumnProfile for every column of a table
+// using a single aggregate query.
+func ProfileColumns(db *sql.DB, tableName string) ([]ColumnProfile, error) {
+	columns, err := GetTableColumns(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table '%s' not found or has no columns", tableName)
+	}
+
+	const aggregatesPerColumn = 4
+	exprs := make([]string, 0, len(columns)*aggregatesPerColumn)
+	for _, col := range columns {
+		quoted := quoteIdentifier(col)
+		exprs = append(exprs,
+			fmt.Sprintf("COALESCE(SUM(CASE WHEN %s IS NULL OR %s = '' THEN 1 ELSE 0 END), 0)", quoted, quoted),
+			fmt.Sprintf("COUNT(DISTINCT %s)", quoted),
+			fmt.Sprintf("COALESCE(MIN(LENGTH(%s)), 0)", quoted),
+			fmt.Sprintf("COALESCE(MAX(LENGTH(%s)), 0)", quoted),
+		)
+	}
+
+	profiles := make([]ColumnProfile, len(columns))
+	dest := make([]interface{}, 0, len(exprs))
+	for i, col := range columns {
+		profiles[i].Name = col
+		dest = append(dest, &profiles[i].EmptyCount, &profiles[i].DistinctCount, &profiles[i].MinLength, &profiles[i].MaxLength)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(exprs, ", "), tableName)
+	if err := db.QueryRow(query).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to profile table '%s': %w", tableName, err)
+	}
+
+	return profiles, nil
+}
+
+// DropEmptyColumns drops the columns of a table in which every value is NULL
+// or empty, except those named in keep, and returns the names of the dropped
+// columns, along with their original headers in ColumnsTable. Nothing is
+// dropped from a table without rows, or when every column is empty, since a
+// table must keep at least one column.
+func DropEmptyColumns(db *sql.DB, tableName string, keep []string) ([]string, error) {
+	var rowCount int64
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", tableName)).Scan(&rowCount); err != nil {
+		return nil, fmt.Errorf("failed to count rows of %s: %w", tableName, err)
+	}
+	if rowCount == 0 {
+		return nil, nil
+	}
+
+	profiles, err := ProfileColumns(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var empty []string
+	for _, profile := range profiles {
+		kept := false
+		for _, k := range keep {
+			kept = kept || strings.EqualFold(SanitizeColumnName(k), profile.Name)
+		}
+		if profile.EmptyCount == rowCount && !kept {
+			empty = append(empty, profile.Name)
+		}
+	}
+	if len(empty) == 0 || len(empty) == len(profiles) {
+		return nil, nil
+	}
+
+	err = retryOnLock(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		for _, column := range empty {
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, quoteIdentifier(column))); err != nil {
+				return fmt.Errorf("failed to drop column %s.%s: %w", tableName, column, err)
+			}
+		}
+
+		var hasColumns int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", ColumnsTable).Scan(&hasColumns); err != nil {
+			return fmt.Errorf("failed to look up %s: %w", ColumnsTable, err)
+		}
+		for _, column := range empty {
+			if hasColumns == 0 {
+				break
+			}
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE table_name = ? AND column_name = ?", ColumnsTable), tableName, column); err != nil {
+				return fmt.Errorf("failed to remove original header of %s.%s: %w", tableName, column, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return empty, nil
+}
+
+// DistinctValues returns the number of distinct non-NULL values in a column
+// of a table and, if list is set, those values in ascending order.
+func DistinctValues(db *sql.DB, tableName, column string, list bool) (int64, []string, error) {
+	if err := ValidateColumns(db, tableName, []string{column}); err != nil {
+		return 0, nil, err
+	}
+	quoted := quoteIdentifier(SanitizeColumnName(column))
+
+	var count int64
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(DISTINCT %s) FROM %s", quoted, tableName)).Scan(&count); err != nil {
+		return 0, nil, fmt.Errorf("failed to count distinct values of %s.%s: %w", tableName, column, err)
+	}
+	if !list {
+		return count, nil, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL ORDER BY %s", quoted, tableName, quoted, quoted))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to list distinct values of %s.%s: %w", tableName, column, err)
+	}
+	defer rows.Close()
+
+	values := make([]string, 0, count)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return 0, nil, fmt.Errorf("failed to read distinct value: %w", err)
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to list distinct values of %s.%s: %w", tableName, column, err)
+	}
+	return count, values, nil
+}
+
+// quoteIdentifier quotes a column name for use in generated SQL.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -1,6 +1,9 @@
 package database
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // SanitizeColumnName sanitizes a column name for SQL compatibility.
 // - Replaces invalid characters with underscores
@@ -28,3 +31,49 @@ func SanitizeColumnName(name string) string {
 
 	return sanitized
 }
+
+// DedupeHeaders returns headers with repeated column names made unique. SQLite
+// compares column names case-insensitively, so "Name" repeats "name". Each
+// repeat is replaced by its sanitized name with "_2", "_3", ... appended,
+// skipping suffixes that another header already uses; the first occurrence
+// and headers that do not repeat are returned as given.
+func DedupeHeaders(headers []string) []string {
+	taken := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		taken[strings.ToLower(SanitizeColumnName(h))] = true
+	}
+
+	deduped := make([]string, len(headers))
+	seen := make(map[string]bool, len(headers))
+	for i, h := range headers {
+		deduped[i] = h
+		sanitized := SanitizeColumnName(h)
+		if key := strings.ToLower(sanitized); !seen[key] {
+			seen[key] = true
+			continue
+		}
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s_%d", sanitized, n)
+			key := strings.ToLower(candidate)
+			if !taken[key] && !seen[key] {
+				deduped[i] = candidate
+				seen[key] = true
+				break
+			}
+		}
+	}
+	return deduped
+}
+
+// ApplyColumnCase converts a sanitized column name to the requested case.
+// Valid modes are "lower" and "upper"; any other value keeps the name as is.
+func ApplyColumnCase(name, mode string) string {
+	switch mode {
+	case "lower":
+		return strings.ToLower(name)
+	case "upper":
+		return strings.ToUpper(name)
+	default:
+		return name
+	}
+}
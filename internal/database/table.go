@@ -1,85 +1,359 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
 const (
 	// BatchSize is the number of rows to insert in a single transaction.
 	BatchSize = 10000
+
+	// MaxBatchValues is the most values a batch holds; batches of wide
+	// tables get fewer rows (see EffectiveBatchSize).
+	MaxBatchValues = 1000000
+
+	// maxStatementRows is the most rows one INSERT statement binds. Larger
+	// statements are no faster, but hold more values in memory at once.
+	maxStatementRows = 500
+
+	// maxLockRetries is how many times a batch is retried when the database is locked.
+	maxLockRetries = 5
+
+	// minColumnLimit is the lowest column/host parameter limit of any SQLite
+	// build; tables at or below it never need the limit checked.
+	minColumnLimit = 999
 )
 
+// EffectiveBatchSize returns the number of rows to insert per transaction
+// into a table of the given number of columns: rows (or BatchSize if rows is
+// not positive), reduced if needed so that a batch holds at most
+// MaxBatchValues values. InsertBatch splits a batch into statements that
+// stay within SQLite's bound parameter limit, so it does not bound the
+// batch size.
+func EffectiveBatchSize(rows, columns int) int {
+	if rows <= 0 {
+		rows = BatchSize
+	}
+	if columns > 0 && rows*columns > MaxBatchValues {
+		rows = max(1, MaxBatchValues/columns)
+	}
+	return rows
+}
+
 // CreateTable creates a new table with the given name and column headers.
 // All columns are created as TEXT type.
 // Drops the table first if it already exists.
 func CreateTable(db *sql.DB, tableName string, headers []string) error {
+	return CreateTableWithTypes(db, tableName, headers, nil)
+}
+
+// CreateTableWithTypes creates a table like CreateTable, declaring each column
+// with the type at its position in types (TypeText if types is shorter or the
+// type is empty).
+func CreateTableWithTypes(db *sql.DB, tableName string, headers []string, types []string) error {
+	// Check before dropping so a too-wide file does not destroy an existing table
+	if err := checkColumnLimit(db, tableName, len(headers)); err != nil {
+		return err
+	}
+
 	dropSQL := fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName)
-	if _, err := db.Exec(dropSQL); err != nil {
+	if err := execWithRetry(db, dropSQL); err != nil {
 		return fmt.Errorf("failed to drop table: %w", err)
 	}
 
 	columns := make([]string, len(headers))
 	for i, header := range headers {
 		sanitized := SanitizeColumnName(header)
-		columns[i] = fmt.Sprintf("%s TEXT", sanitized)
+		columns[i] = fmt.Sprintf("%s %s", sanitized, columnType(types, i))
 	}
 
 	createSQL := fmt.Sprintf("CREATE TABLE %s (%s)", tableName, strings.Join(columns, ", "))
-	if _, err := db.Exec(createSQL); err != nil {
+	if err := execWithRetry(db, createSQL); err != nil {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
 
 	return nil
 }
 
+// checkColumnLimit returns an error if a table with the given number of
+// columns cannot be created or inserted into with a single statement.
+// SQLite's limits (2000 columns by default) are fixed when it is compiled.
+func checkColumnLimit(db *sql.DB, tableName string, columns int) error {
+	if columns <= minColumnLimit {
+		return nil
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	limit := 0
+	err = conn.Raw(func(driverConn interface{}) error {
+		// Other drivers report the limit themselves when the table is created
+		if c, ok := driverConn.(*sqlite3.SQLiteConn); ok {
+			limit = min(c.GetLimit(sqlite3.SQLITE_LIMIT_COLUMN), c.GetLimit(sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read SQLite limits: %w", err)
+	}
+
+	if limit > 0 && columns > limit {
+		return fmt.Errorf("table %s has %d columns, but SQLite supports at most %d (build with CGO_CFLAGS=-DSQLITE_MAX_COLUMN=N to raise the limit)", tableName, columns, limit)
+	}
+	return nil
+}
+
+// Policies for rows that violate a PRIMARY KEY or UNIQUE constraint
+// (InsertOptions.OnConflict).
+const (
+	ConflictAbort   = "abort"   // Fail the batch, inserting none of its rows
+	ConflictIgnore  = "ignore"  // Skip the conflicting row, keeping the existing one
+	ConflictReplace = "replace" // Delete the existing row and insert the new one
+)
+
+// ValidateOnConflict checks that policy is empty or a supported conflict policy.
+func ValidateOnConflict(policy string) error {
+	switch policy {
+	case "", ConflictAbort, ConflictIgnore, ConflictReplace:
+		return nil
+	default:
+		return fmt.Errorf("invalid conflict policy: %s (use '%s', '%s' or '%s')", policy, ConflictAbort, ConflictIgnore, ConflictReplace)
+	}
+}
+
+// InsertOptions configures how InsertBatchWithOptions transforms values.
+type InsertOptions struct {
+	// ValueMaps replaces values before they are inserted, keyed by column name
+	// and then by original value. Column names are matched after sanitization,
+	// ignoring case; columns not in the table are ignored.
+	ValueMaps map[string]map[string]string
+	// Binary stores values as BLOBs instead of TEXT, so their bytes are kept
+	// exactly even if they are not valid UTF-8.
+	Binary bool
+	// OnConflict is the policy for rows that violate a PRIMARY KEY or UNIQUE
+	// constraint of the table: ConflictAbort (the default), ConflictIgnore or
+	// ConflictReplace, used as INSERT OR <policy>.
+	OnConflict string
+	// Checkpoint, if set, is recorded in the same transaction as the batch,
+	// so it always agrees with the committed rows. Its Rows must include the
+	// batch, and SaveCheckpoint must have created CheckpointsTable.
+	Checkpoint *Checkpoint
+	// ColumnTypes are the types the table was created with, by header
+	// position. Empty values of INTEGER and REAL columns are inserted as NULL,
+	// since SQLite would otherwise keep them as text that sorts after numbers.
+	ColumnTypes []string
+	// NullStrings are values, such as "NULL" or "\N", inserted as SQL NULL.
+	// They are matched before ValueMaps are applied.
+	NullStrings []string
+}
+
+// columnMaps returns the value map for each header position, or nil if no
+// header has one.
+func (o InsertOptions) columnMaps(headers []string) []map[string]string {
+	if len(o.ValueMaps) == 0 {
+		return nil
+	}
+
+	var maps []map[string]string
+	for column, values := range o.ValueMaps {
+		for i, h := range headers {
+			if !strings.EqualFold(SanitizeColumnName(column), SanitizeColumnName(h)) {
+				continue
+			}
+			if maps == nil {
+				maps = make([]map[string]string, len(headers))
+			}
+			maps[i] = values
+		}
+	}
+	return maps
+}
+
 // InsertBatch inserts a batch of rows into the specified table within a transaction.
 func InsertBatch(db *sql.DB, tableName string, headers []string, batch [][]string) error {
+	return InsertBatchWithOptions(db, tableName, headers, batch, InsertOptions{})
+}
+
+// InsertBatchWithOptions inserts a batch of rows like InsertBatch, transforming
+// values and resolving constraint conflicts as configured by opts.
+func InsertBatchWithOptions(db *sql.DB, tableName string, headers []string, batch [][]string, opts InsertOptions) error {
 	if len(batch) == 0 {
 		return nil
 	}
+	if err := ValidateOnConflict(opts.OnConflict); err != nil {
+		return err
+	}
 
 	placeholders := make([]string, len(headers))
 	for i := range placeholders {
 		placeholders[i] = "?"
 	}
-	placeholderStr := "(" + strings.Join(placeholders, ", ") + ")"
+	rowSQL := "(" + strings.Join(placeholders, ", ") + ")"
 
 	sanitizedHeaders := make([]string, len(headers))
 	for i, h := range headers {
 		sanitizedHeaders[i] = SanitizeColumnName(h)
 	}
 
-	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+	insert := "INSERT"
+	if opts.OnConflict != "" {
+		insert += " OR " + strings.ToUpper(opts.OnConflict)
+	}
+	insertSQL := fmt.Sprintf("%s INTO %s (%s) VALUES ",
+		insert,
 		tableName,
-		strings.Join(sanitizedHeaders, ", "),
-		placeholderStr)
+		strings.Join(sanitizedHeaders, ", "))
+	valueMaps := opts.columnMaps(headers)
+
+	limit, err := parameterLimit(db)
+	if err != nil {
+		return err
+	}
+	statementRows := min(maxStatementRows, max(1, limit/len(headers)))
+
+	// The failed transaction is rolled back, so the whole batch is safe to retry.
+	return retryOnLock(func() error {
+		return insertBatchTx(db, insertSQL, rowSQL, statementRows, len(headers), batch, valueMaps, opts)
+	})
+}
 
+// parameterLimit returns the most values one statement can bind: SQLite's
+// host parameter limit (32766 since SQLite 3.32), or 999, the lowest limit
+// of any build, for other drivers.
+func parameterLimit(db *sql.DB) (int, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	limit := minColumnLimit
+	err = conn.Raw(func(driverConn interface{}) error {
+		if c, ok := driverConn.(*sqlite3.SQLiteConn); ok {
+			limit = c.GetLimit(sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read SQLite limits: %w", err)
+	}
+	return limit, nil
+}
+
+// retryOnLock calls fn until it succeeds, fails with a non-lock error, or
+// maxLockRetries is exhausted. A busy timeout covers most contention, but
+// statements can still fail with SQLITE_BUSY/SQLITE_LOCKED under heavy
+// concurrent writes, or when the caller opened the database without one.
+func retryOnLock(fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= maxLockRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 50 * time.Millisecond)
+		}
+		err = fn()
+		if !isLockError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// execWithRetry executes a single statement, retrying while the database is locked.
+func execWithRetry(db *sql.DB, statement string) error {
+	return retryOnLock(func() error {
+		_, err := db.Exec(statement)
+		return err
+	})
+}
+
+// insertBatchTx inserts a batch of rows in a single transaction, with
+// statements of insertSQL followed by rowSQL for each of up to statementRows rows.
+// valueMaps, if not nil, holds the value replacements for each column.
+// opts.Binary binds values as BLOBs, and opts.Checkpoint is recorded with the rows.
+func insertBatchTx(db *sql.DB, insertSQL, rowSQL string, statementRows, columnCount int, batch [][]string, valueMaps []map[string]string, opts InsertOptions) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(insertSQL)
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
+	// Each statement inserts statementRows rows, except a shorter last one,
+	// so at most two are prepared per batch
+	var stmt *sql.Stmt
+	stmtRows := 0
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}()
+
+	nulls := make(map[string]bool, len(opts.NullStrings))
+	for _, null := range opts.NullStrings {
+		nulls[null] = true
 	}
-	defer stmt.Close()
 
-	for _, row := range batch {
-		values := make([]interface{}, len(headers))
-		for i := range headers {
-			if i < len(row) {
-				values[i] = row[i]
-			} else {
-				values[i] = ""
+	// Exec copies its arguments, so one slice serves every statement
+	values := make([]interface{}, 0, min(len(batch), statementRows)*columnCount)
+	for start := 0; start < len(batch); start += statementRows {
+		rows := batch[start:min(start+statementRows, len(batch))]
+		if len(rows) != stmtRows {
+			if stmt != nil {
+				stmt.Close()
+			}
+			stmt, err = tx.Prepare(insertSQL + strings.TrimSuffix(strings.Repeat(rowSQL+", ", len(rows)), ", "))
+			if err != nil {
+				stmt = nil
+				return fmt.Errorf("failed to prepare statement: %w", err)
+			}
+			stmtRows = len(rows)
+		}
+
+		values = values[:0]
+		for _, row := range rows {
+			for i := 0; i < columnCount; i++ {
+				value := ""
+				if i < len(row) {
+					value = row[i]
+				}
+				if nulls[value] {
+					values = append(values, nil)
+					continue
+				}
+				if valueMaps != nil && valueMaps[i] != nil {
+					if mapped, ok := valueMaps[i][value]; ok {
+						value = mapped
+					}
+				}
+				switch {
+				case opts.Binary:
+					values = append(values, []byte(value))
+				case value == "" && columnType(opts.ColumnTypes, i) != TypeText:
+					values = append(values, nil)
+				default:
+					values = append(values, value)
+				}
 			}
 		}
 
 		if _, err := stmt.Exec(values...); err != nil {
-			return fmt.Errorf("failed to insert row: %w", err)
+			return fmt.Errorf("failed to insert rows: %w", err)
+		}
+	}
+
+	if cp := opts.Checkpoint; cp != nil {
+		if _, err := tx.Exec(checkpointSQL(), cp.Table, cp.Source, cp.Rows); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
 		}
 	}
 
@@ -90,31 +364,131 @@ func InsertBatch(db *sql.DB, tableName string, headers []string, batch [][]strin
 	return nil
 }
 
+// isLockError reports whether err was caused by another connection holding a lock.
+func isLockError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
 // GetTableColumns returns the column names for a table.
 func GetTableColumns(db *sql.DB, tableName string) ([]string, error) {
+	columns, _, err := tableInfo(db, tableName)
+	return columns, err
+}
+
+// tableInfo returns the names and declared types of the columns of a table.
+// Both are empty if the table does not exist.
+func tableInfo(db *sql.DB, tableName string) ([]string, []string, error) {
 	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get table info: %w", err)
+		return nil, nil, fmt.Errorf("failed to get table info: %w", err)
 	}
 	defer rows.Close()
 
-	var columns []string
+	var columns, types []string
 	for rows.Next() {
 		var cid int
 		var name, ctype string
 		var notnull, pk int
 		var dfltValue interface{}
 		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dfltValue, &pk); err != nil {
-			return nil, fmt.Errorf("failed to scan column info: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan column info: %w", err)
 		}
 		columns = append(columns, name)
+		types = append(types, ctype)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error reading columns: %w", err)
+		return nil, nil, fmt.Errorf("error reading columns: %w", err)
+	}
+
+	return columns, types, nil
+}
+
+// MatchColumns checks that an existing table has exactly the columns that
+// headers are created as, in any order, so that rows can be appended to it,
+// and returns the declared type of each header's column.
+func MatchColumns(db *sql.DB, tableName string, headers []string) ([]string, error) {
+	columns, types, err := tableInfo(db, tableName)
+	if err != nil {
+		return nil, err
 	}
 
-	return columns, nil
+	existing := make(map[string]string, len(columns))
+	for i, column := range columns {
+		existing[strings.ToLower(column)] = types[i]
+	}
+	matched := len(headers) == len(columns)
+	sanitized := make([]string, len(headers))
+	headerTypes := make([]string, len(headers))
+	for i, header := range headers {
+		sanitized[i] = SanitizeColumnName(header)
+		typ, ok := existing[strings.ToLower(sanitized[i])]
+		matched = matched && ok
+		headerTypes[i] = typ
+	}
+	if !matched {
+		return nil, fmt.Errorf("cannot append to table %s: its columns (%s) do not match the input's (%s)", tableName, strings.Join(columns, ", "), strings.Join(sanitized, ", "))
+	}
+	return headerTypes, nil
+}
+
+// ColumnDiff is how the columns of an input differ from those of an existing
+// table, compared case-insensitively after sanitizing the input's headers.
+type ColumnDiff struct {
+	Columns   []string // The table's columns
+	Headers   []string // The input's sanitized headers
+	Added     []string // Headers the table has no column for
+	Removed   []string // Columns of the table the input has no header for
+	Reordered bool     // The columns both have are in a different order
+}
+
+// Matches reports whether the input has the same columns as the table, in
+// any order, so that it can be appended (see MatchColumns).
+func (d *ColumnDiff) Matches() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// DiffColumns compares the columns that headers are created as with those of
+// an existing table. It returns nil if the table does not exist.
+func DiffColumns(db *sql.DB, tableName string, headers []string) (*ColumnDiff, error) {
+	columns, _, err := tableInfo(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	diff := &ColumnDiff{Columns: columns, Headers: make([]string, len(headers))}
+	inHeaders := make(map[string]bool, len(headers))
+	for i, header := range headers {
+		diff.Headers[i] = SanitizeColumnName(header)
+		inHeaders[strings.ToLower(diff.Headers[i])] = true
+	}
+	inColumns := make(map[string]bool, len(columns))
+	var kept []string
+	for _, column := range columns {
+		inColumns[strings.ToLower(column)] = true
+		if inHeaders[strings.ToLower(column)] {
+			kept = append(kept, strings.ToLower(column))
+		} else {
+			diff.Removed = append(diff.Removed, column)
+		}
+	}
+	n := 0
+	for _, header := range diff.Headers {
+		if !inColumns[strings.ToLower(header)] {
+			diff.Added = append(diff.Added, header)
+			continue
+		}
+		diff.Reordered = diff.Reordered || n >= len(kept) || kept[n] != strings.ToLower(header)
+		n++
+	}
+	return diff, nil
 }
 
 // ValidateColumns checks if all specified columns exist in the table.
@@ -159,28 +533,129 @@ func CreateIndex(db *sql.DB, tableName, column string) error {
 	indexName := fmt.Sprintf("idx_%s_%s", tableName, sanitizedColumn)
 
 	createSQL := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName, tableName, sanitizedColumn)
-	if _, err := db.Exec(createSQL); err != nil {
+	if err := execWithRetry(db, createSQL); err != nil {
 		return fmt.Errorf("failed to create index on %s.%s: %w", tableName, column, err)
 	}
 
 	return nil
 }
 
-// CreateIndexes creates indexes on multiple columns for a table.
-// Validates all columns exist before creating any indexes.
+// CompositeIndexSeparator joins the columns of a composite index in an index
+// column entry, e.g. "user_id+created_at".
+const CompositeIndexSeparator = "+"
+
+// SplitIndexColumns returns the columns of an index column entry: a single
+// column, or several joined with CompositeIndexSeparator.
+func SplitIndexColumns(entry string) []string {
+	columns := strings.Split(entry, CompositeIndexSeparator)
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+	}
+	return columns
+}
+
+// CreateCompositeIndex creates one index on several columns of a table, in
+// order, named after the table and every column, e.g.
+// idx_orders_user_id_created_at. Returns an error if a column doesn't exist.
+func CreateCompositeIndex(db *sql.DB, tableName string, columns []string) error {
+	if err := ValidateColumns(db, tableName, columns); err != nil {
+		return err
+	}
+
+	sanitized := make([]string, len(columns))
+	for i, column := range columns {
+		sanitized[i] = SanitizeColumnName(column)
+	}
+	indexName := fmt.Sprintf("idx_%s_%s", tableName, strings.Join(sanitized, "_"))
+
+	createSQL := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName, tableName, strings.Join(sanitized, ", "))
+	if err := execWithRetry(db, createSQL); err != nil {
+		return fmt.Errorf("failed to create index on %s (%s): %w", tableName, strings.Join(columns, ", "), err)
+	}
+
+	return nil
+}
+
+// CreateUniqueIndex creates a UNIQUE index on one or more columns of a table,
+// named like CreateCompositeIndex's but with a uidx_ prefix. It fails if the
+// table already holds the same values in those columns twice; the error then
+// names one of the duplicated values. Rows with a NULL in them never collide.
+func CreateUniqueIndex(db *sql.DB, tableName string, columns []string) error {
+	if err := ValidateColumns(db, tableName, columns); err != nil {
+		return err
+	}
+
+	sanitized := make([]string, len(columns))
+	for i, column := range columns {
+		sanitized[i] = SanitizeColumnName(column)
+	}
+	indexName := fmt.Sprintf("uidx_%s_%s", tableName, strings.Join(sanitized, "_"))
+
+	createSQL := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)", indexName, tableName, strings.Join(sanitized, ", "))
+	if err := execWithRetry(db, createSQL); err != nil {
+		if duplicate, count, ok := findDuplicate(db, tableName, sanitized); ok {
+			return fmt.Errorf("failed to create unique index on %s (%s): %s appears %d times", tableName, strings.Join(columns, ", "), duplicate, count)
+		}
+		return fmt.Errorf("failed to create unique index on %s (%s): %w", tableName, strings.Join(columns, ", "), err)
+	}
+
+	return nil
+}
+
+// findDuplicate returns one combination of values that more than one row of
+// a table has in columns, formatted as 'a', 'b', and how many rows have it.
+func findDuplicate(db *sql.DB, tableName string, columns []string) (string, int, bool) {
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = column + " IS NOT NULL"
+	}
+	list := strings.Join(columns, ", ")
+	query := fmt.Sprintf("SELECT %s, COUNT(*) FROM %s WHERE %s GROUP BY %s HAVING COUNT(*) > 1 LIMIT 1", list, tableName, strings.Join(conditions, " AND "), list)
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns)+1)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var count int
+	dest[len(columns)] = &count
+	if err := db.QueryRow(query).Scan(dest...); err != nil {
+		return "", 0, false
+	}
+
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("'%s'", value.String)
+	}
+	return strings.Join(quoted, ", "), count, true
+}
+
+// CreateIndexes creates indexes on multiple columns for a table. An entry
+// joining several columns with CompositeIndexSeparator creates one composite
+// index on them. Validates all columns exist before creating any indexes.
 func CreateIndexes(db *sql.DB, tableName string, columns []string) error {
 	if len(columns) == 0 {
 		return nil
 	}
 
 	// Validate all columns exist first (fail early)
-	if err := ValidateColumns(db, tableName, columns); err != nil {
+	var all []string
+	for _, entry := range columns {
+		all = append(all, SplitIndexColumns(entry)...)
+	}
+	if err := ValidateColumns(db, tableName, all); err != nil {
 		return err
 	}
 
 	// Create indexes
-	for _, column := range columns {
-		if err := CreateIndex(db, tableName, column); err != nil {
+	for _, entry := range columns {
+		var err error
+		if group := SplitIndexColumns(entry); len(group) > 1 {
+			err = CreateCompositeIndex(db, tableName, group)
+		} else {
+			err = CreateIndex(db, tableName, entry)
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Column types of imported tables. Columns are TEXT unless their types are
+// inferred on import.
+const (
+	TypeText    = "TEXT"
+	TypeInteger = "INTEGER"
+	TypeReal    = "REAL"
+)
+
+// columnType returns the type at position i of types, or TypeText.
+func columnType(types []string, i int) string {
+	if i < len(types) && types[i] != "" {
+		return types[i]
+	}
+	return TypeText
+}
+
+// ConvertColumnsToText changes the type of the named columns of a table to
+// TEXT. SQLite cannot change the type of a column, so the table is rebuilt
+// with its columns in the same order. NULL values of the converted columns
+// become empty strings, as a TEXT import would have stored them. Indexes of
+// the table are not kept, so it must be converted before they are created.
+func ConvertColumnsToText(db *sql.DB, tableName string, columns []string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	convert := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		convert[strings.ToLower(SanitizeColumnName(column))] = true
+	}
+
+	names, types, err := tableInfo(db, tableName)
+	if err != nil {
+		return err
+	}
+	definitions := make([]string, len(names))
+	values := make([]string, len(names))
+	for i, name := range names {
+		quoted := quoteIdentifier(name)
+		typ := types[i]
+		values[i] = quoted
+		if convert[strings.ToLower(name)] {
+			typ = TypeText
+			values[i] = fmt.Sprintf("COALESCE(CAST(%s AS TEXT), '')", quoted)
+		}
+		definitions[i] = fmt.Sprintf("%s %s", quoted, typ)
+	}
+
+	rebuilt := tableName + "_yatisql_retype"
+	return retryOnLock(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		statements := []string{
+			fmt.Sprintf("CREATE TABLE %s (%s)", rebuilt, strings.Join(definitions, ", ")),
+			fmt.Sprintf("INSERT INTO %s SELECT %s FROM %s", rebuilt, strings.Join(values, ", "), tableName),
+			fmt.Sprintf("DROP TABLE %s", tableName),
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuilt, tableName),
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("failed to convert columns of %s to TEXT: %w", tableName, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	})
+}
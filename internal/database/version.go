@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// versionTimeFormat is the timestamp suffix of versioned table names.
+const versionTimeFormat = "20060102_150405"
+
+// VersionTable renames an existing table to <table>_<timestamp>, so that
+// CreateTable can replace it without losing its rows. It returns the new name,
+// or "" if there is no table to version. The table's indexes and any original
+// headers recorded in ColumnsTable move with it, leaving their names free for
+// the new table.
+func VersionTable(db *sql.DB, tableName string, now time.Time) (string, error) {
+	var existing string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ? COLLATE NOCASE", tableName).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up table %s: %w", tableName, err)
+	}
+
+	versioned, err := versionName(db, tableName, now)
+	if err != nil {
+		return "", err
+	}
+
+	err = retryOnLock(func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", existing, versioned)); err != nil {
+			return fmt.Errorf("failed to rename table %s to %s: %w", existing, versioned, err)
+		}
+		if err := renameIndexes(tx, tableName, versioned); err != nil {
+			return err
+		}
+
+		var hasColumns int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", ColumnsTable).Scan(&hasColumns); err != nil {
+			return fmt.Errorf("failed to look up %s: %w", ColumnsTable, err)
+		}
+		if hasColumns > 0 {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET table_name = ? WHERE table_name = ?", ColumnsTable), versioned, tableName); err != nil {
+				return fmt.Errorf("failed to move original headers to %s: %w", versioned, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return versioned, nil
+}
+
+// versionName returns an unused name for a version of tableName made at now.
+func versionName(db *sql.DB, tableName string, now time.Time) (string, error) {
+	base := fmt.Sprintf("%s_%s", tableName, now.Format(versionTimeFormat))
+	name := base
+	for n := 2; ; n++ {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ? COLLATE NOCASE", name).Scan(&count); err != nil {
+			return "", fmt.Errorf("failed to look up table %s: %w", name, err)
+		}
+		if count == 0 {
+			return name, nil
+		}
+		// Imports within the same second get a counter
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+}
+
+// renameIndexes recreates the indexes of a table renamed from oldName to
+// newName under names derived from newName. SQLite keeps index names when a
+// table is renamed, which would stop a new oldName table from creating its
+// own indexes with CREATE INDEX IF NOT EXISTS.
+func renameIndexes(tx *sql.Tx, oldName, newName string) error {
+	rows, err := tx.Query("SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", newName)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes of %s: %w", newName, err)
+	}
+	type index struct{ name, sql string }
+	var indexes []index
+	for rows.Next() {
+		var idx index
+		if err := rows.Scan(&idx.name, &idx.sql); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+		indexes = append(indexes, idx)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list indexes of %s: %w", newName, err)
+	}
+
+	for _, idx := range indexes {
+		renamed := newName + "_" + idx.name
+		// idx_ and uidx_ names from CreateIndex and CreateUniqueIndex
+		for _, kind := range []string{"idx_", "uidx_"} {
+			oldPrefix := kind + oldName
+			if strings.HasPrefix(strings.ToLower(idx.name), strings.ToLower(oldPrefix)) {
+				renamed = kind + newName + idx.name[len(oldPrefix):]
+				break
+			}
+		}
+		// The name is the first identifier in CREATE [UNIQUE] INDEX name ON ...
+		createSQL := strings.Replace(idx.sql, idx.name, renamed, 1)
+		if _, err := tx.Exec(fmt.Sprintf("DROP INDEX %s", quoteIdentifier(idx.name))); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", idx.name, err)
+		}
+		if _, err := tx.Exec(createSQL); err != nil {
+			return fmt.Errorf("failed to recreate index %s as %s: %w", idx.name, renamed, err)
+		}
+	}
+	return nil
+}
@@ -1,22 +1,132 @@
 package exporter
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
+// DefaultFlushRows is how many rows are written between flushes of the
+// outputs when Options.FlushRows is not set.
+const DefaultFlushRows = 10000
+
 // Result contains the result of a query export operation.
 type Result struct {
-	RowCount int
+	RowCount     int
+	Truncated    bool  // The query had more rows than Options.MaxRows, which were not written
+	BytesWritten int64 // Bytes written to all destinations, after compression
+	Outputs      []OutputResult
+	Columns      []string // Result column names, as in the header
+	// SQLite type of each result column, such as "TEXT" or "INTEGER": the
+	// declared type of a table column, or for expressions the storage class
+	// of the column's first non-NULL value ("" if every value is NULL).
+	ColumnTypes []string
+}
+
+// OutputResult describes one destination written by a query.
+type OutputResult struct {
+	Path         string // Output file path ("" for stdout)
+	Format       string
+	Delimiter    rune   // Field delimiter of CSV/TSV output (0 for JSON)
+	Compression  string // "gzip", "bzip2", or "" if the output is not compressed
+	BytesWritten int64
+}
+
+// querier is satisfied by both *sql.DB and *sql.Conn.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Options controls how a query is executed and its results are written.
+type Options struct {
+	Delimiter  rune // Output field delimiter (0 = detect from each output's extension)
+	QueryOnly  bool // Reject statements that modify the database
+	QueryIndex int  // 1-based position of the query in the run, used to label trace regions
+	Append     bool // Append to existing CSV/TSV outputs; the header is only written to new or empty files
+	NoHeader   bool // Omit the header row from CSV/TSV outputs
+	// Write JSON outputs as one object whose members are the rows, named by
+	// their value in this column, instead of an array. Duplicate or NULL
+	// names are an error.
+	JSONKey string
+	// Write BLOB values as BinaryBase64 or BinaryHex text so that any bytes
+	// can be recovered exactly (default: written as is)
+	BinaryEncoding string
+	// Write NaN and infinite REAL values as NaNToken instead of NaN, +Inf
+	// or -Inf, which strict CSV and JSON consumers reject
+	ReplaceNaN bool
+	NaNToken   string
+	// Write finite REAL values with this printf verb, e.g. "%.2f", instead
+	// of as their shortest exact decimal (see ValidateFloatFormat)
+	FloatFormat string
+	// Text written for NULL values in CSV/TSV outputs and scalar results
+	// (default: empty). JSON outputs always write null.
+	NullOutput string
+	// Flush the outputs every this many rows, so that buffered rows do not
+	// pile up and a failed write, such as to a closed pipe, stops the query
+	// early (default: DefaultFlushRows)
+	FlushRows int
+	// Write the outputs in this format instead of the one detected from
+	// their extension. Only FormatTable is supported, and only for stdout.
+	Format string
+	// Stop after writing this many rows, setting Result.Truncated if the
+	// query had more (0 = write every row). Unlike a LIMIT in the query,
+	// the truncation is reported.
+	MaxRows int
+	// Write each output file in parts named by PartPath, starting the next
+	// part once one has reached this many bytes (0 = one file). Parts can
+	// exceed it by up to a row and the output's buffered bytes. Every part
+	// of a CSV/TSV output has the header, and every JSON part is a complete
+	// document. Stdout is never split.
+	RotateBytes int64
+}
+
+// PartPath returns the path of part n of an output split by
+// Options.RotateBytes: the part number goes before the format extension,
+// e.g. out.csv.gz becomes out.0.csv.gz.
+func PartPath(outputFile string, n int) string {
+	base := stripCompressionExt(outputFile)
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s.%d%s%s", strings.TrimSuffix(base, ext), n, ext, outputFile[len(base):])
 }
 
 // Execute executes a SQL query and exports results to the specified output file.
 // If outputFile is empty, outputs to stdout.
 func Execute(db *sql.DB, query, outputFile string, delimiter rune) (*Result, error) {
-	rows, err := db.Query(query)
+	return ExecuteWithOptions(db, query, outputFile, Options{Delimiter: delimiter})
+}
+
+// ExecuteWithOptions executes a SQL query like Execute, configured by opts.
+func ExecuteWithOptions(db *sql.DB, query, outputFile string, opts Options) (*Result, error) {
+	return ExecuteToFiles(db, query, []string{outputFile}, opts)
+}
+
+// ExecuteToFiles executes a SQL query once and writes its results to every
+// output file in a single pass. Each output's format is detected from its
+// extension, so one query can produce e.g. both CSV and JSON.
+func ExecuteToFiles(db *sql.DB, query string, outputFiles []string, opts Options) (*Result, error) {
+	ctx, task := trace.NewTask(context.Background(), fmt.Sprintf("query_%d", opts.QueryIndex))
+	defer task.End()
+	trace.Log(ctx, "query", query)
+
+	q, release, err := openQuerier(ctx, db, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return nil, err
+	}
+	defer release()
+
+	region := trace.StartRegion(ctx, fmt.Sprintf("execute_query_%d", opts.QueryIndex))
+	rows, err := q.QueryContext(ctx, query)
+	region.End()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", explainReadOnly(err))
 	}
 	defer rows.Close()
 
@@ -24,19 +134,29 @@ func Execute(db *sql.DB, query, outputFile string, delimiter rune) (*Result, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
-
-	output, err := OpenOutputFile(outputFile)
+	columnTypes, err := declaredTypes(rows)
 	if err != nil {
 		return nil, err
 	}
-	defer output.Close()
-
-	writer := csv.NewWriter(output)
-	writer.Comma = delimiter
-	defer writer.Flush()
+	untyped := 0
+	for _, typ := range columnTypes {
+		if typ == "" {
+			untyped++
+		}
+	}
 
-	if err := writer.Write(columns); err != nil {
-		return nil, fmt.Errorf("failed to write header: %w", err)
+	outputs := make([]*output, 0, len(outputFiles))
+	defer func() {
+		for _, out := range outputs {
+			out.file.Close()
+		}
+	}()
+	for _, outputFile := range outputFiles {
+		out, err := openOutputPart(outputFile, 0, columns, opts)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, out)
 	}
 
 	values := make([]interface{}, len(columns))
@@ -45,30 +165,342 @@ func Execute(db *sql.DB, query, outputFile string, delimiter rune) (*Result, err
 		valuePtrs[i] = &values[i]
 	}
 
+	region = trace.StartRegion(ctx, fmt.Sprintf("write_rows_%d", opts.QueryIndex))
+	defer region.End()
+
+	flushRows := opts.FlushRows
+	if flushRows <= 0 {
+		flushRows = DefaultFlushRows
+	}
 	rowCount := 0
+	result := &Result{Columns: columns, ColumnTypes: columnTypes}
 	for rows.Next() {
+		// The statement is finalized by the deferred rows.Close
+		if opts.MaxRows > 0 && rowCount == opts.MaxRows {
+			result.Truncated = true
+			break
+		}
 		if err := rows.Scan(valuePtrs...); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		record := make([]string, len(columns))
-		for i, val := range values {
-			if val == nil {
-				record[i] = ""
-			} else {
-				record[i] = fmt.Sprintf("%v", val)
-			}
+		if untyped > 0 {
+			untyped -= inferTypes(columnTypes, values)
+		}
+		if opts.BinaryEncoding != "" {
+			encodeBinary(values, opts.BinaryEncoding)
+		}
+		if opts.ReplaceNaN {
+			replaceNonFinite(values, opts.NaNToken)
+		}
+		if opts.FloatFormat != "" {
+			formatFloats(values, opts.FloatFormat)
 		}
+		for i, out := range outputs {
+			if err := out.writer.WriteRow(values); err != nil {
+				return nil, fmt.Errorf("failed to write row: %w", err)
+			}
 
-		if err := writer.Write(record); err != nil {
-			return nil, fmt.Errorf("failed to write row: %w", err)
+			// Finish a full part and continue in the next
+			if opts.RotateBytes > 0 && out.base != "" && out.counter.count >= opts.RotateBytes {
+				if err := finishOutput(out, result); err != nil {
+					return nil, err
+				}
+				next, err := openOutputPart(out.base, out.part+1, columns, opts)
+				if err != nil {
+					return nil, err
+				}
+				outputs[i] = next
+			}
 		}
 		rowCount++
+
+		if rowCount%flushRows == 0 {
+			for _, out := range outputs {
+				if err := out.writer.Flush(); err != nil {
+					return nil, fmt.Errorf("failed to write output: %w", err)
+				}
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", explainReadOnly(err))
+	}
+
+	result.RowCount = rowCount
+	for _, out := range outputs {
+		if err := finishOutput(out, result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// finishOutput finishes and closes an output and adds it to result. It is
+// closed before reading its byte count so compressed trailers are included.
+func finishOutput(out *output, result *Result) error {
+	if err := out.writer.Finish(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := out.file.Close(); err != nil {
+		return fmt.Errorf("failed to close output: %w", err)
+	}
+	result.BytesWritten += out.counter.count
+	result.Outputs = append(result.Outputs, OutputResult{
+		Path:         out.path,
+		Format:       out.format,
+		Delimiter:    out.delimiter,
+		Compression:  out.compression,
+		BytesWritten: out.counter.count,
+	})
+	return nil
+}
+
+// CountRows runs a query and returns only the number of rows it produces,
+// without writing any output. The query is wrapped in SELECT COUNT(*) so
+// SQLite can count without materializing the rows.
+func CountRows(db *sql.DB, query string, opts Options) (int, error) {
+	ctx, task := trace.NewTask(context.Background(), fmt.Sprintf("count_%d", opts.QueryIndex))
+	defer task.End()
+	trace.Log(ctx, "query", query)
+
+	q, release, err := openQuerier(ctx, db, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	inner := strings.TrimRight(strings.TrimSpace(query), "; \t\n")
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM (%s\n)", inner))
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute query: %w", explainReadOnly(err))
+	}
+	defer rows.Close()
+
+	var count int
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, fmt.Errorf("failed to scan count: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error counting rows: %w", explainReadOnly(err))
+	}
+	return count, nil
+}
+
+// QueryScalar runs a query that must produce exactly one row with one column
+// and returns that value as text, formatted as in CSV output (NULL is
+// opts.NullOutput).
+func QueryScalar(db *sql.DB, query string, opts Options) (string, error) {
+	ctx, task := trace.NewTask(context.Background(), fmt.Sprintf("scalar_%d", opts.QueryIndex))
+	defer task.End()
+	trace.Log(ctx, "query", query)
+
+	q, release, err := openQuerier(ctx, db, opts)
+	if err != nil {
+		return "", err
 	}
+	defer release()
 
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute query: %w", explainReadOnly(err))
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", fmt.Errorf("failed to get columns: %w", err)
+	}
+	if len(columns) != 1 {
+		return "", fmt.Errorf("query returned %d columns, expected a single value", len(columns))
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", fmt.Errorf("error iterating rows: %w", explainReadOnly(err))
+		}
+		return "", fmt.Errorf("query returned no rows, expected a single value")
+	}
+	var value interface{}
+	if err := rows.Scan(&value); err != nil {
+		return "", fmt.Errorf("failed to scan row: %w", err)
+	}
+	if rows.Next() {
+		return "", fmt.Errorf("query returned more than one row, expected a single value")
+	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+		return "", fmt.Errorf("error iterating rows: %w", explainReadOnly(err))
+	}
+	if value == nil {
+		return opts.NullOutput, nil
+	}
+	if f, ok := value.(float64); ok {
+		return formatFloat(f, opts.FloatFormat), nil
+	}
+	return formatValue(value), nil
+}
+
+// openQuerier returns what a query should run on, and a function to call
+// when done with it. query_only is a per-connection setting, so read-only
+// queries run on a dedicated connection that is restored before returning
+// to the pool.
+func openQuerier(ctx context.Context, db *sql.DB, opts Options) (querier, func(), error) {
+	if !opts.QueryOnly {
+		return db, func() {}, nil
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only=ON"); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to enable read-only queries: %w", err)
+	}
+	return conn, func() {
+		conn.ExecContext(ctx, "PRAGMA query_only=OFF") //nolint:errcheck // best effort reset before reuse
+		conn.Close()
+	}, nil
+}
+
+// output is an open destination for query results.
+type output struct {
+	path        string
+	base        string // Output file split into parts ("" = not split)
+	part        int    // Number of the part path is, if split
+	format      string
+	delimiter   rune
+	compression string
+	file        io.WriteCloser
+	counter     *countingWriter
+	writer      rowWriter
+}
+
+// openOutputPart opens an output file, or part n of it if it is split by
+// opts.RotateBytes, and writes the header.
+func openOutputPart(outputFile string, n int, columns []string, opts Options) (*output, error) {
+	path := outputFile
+	if opts.RotateBytes > 0 && outputFile != "" {
+		path = PartPath(outputFile, n)
+	}
+	out, err := openFormattedOutput(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if path != outputFile {
+		out.base = outputFile
+		out.part = n
 	}
 
-	return &Result{RowCount: rowCount}, nil
+	if err := out.writer.WriteHeader(columns); err != nil {
+		out.file.Close()
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return out, nil
+}
+
+// openFormattedOutput opens an output file with a row writer for its format.
+func openFormattedOutput(outputFile string, opts Options) (*output, error) {
+	format := DetectOutputFormat(outputFile)
+	if opts.Format != "" {
+		if opts.Format != FormatTable {
+			return nil, fmt.Errorf("unsupported output format: %s", opts.Format)
+		}
+		if outputFile != "" {
+			return nil, fmt.Errorf("table format can only be written to stdout, not %s", outputFile)
+		}
+		format = opts.Format
+	}
+	appendMode := opts.Append && outputFile != ""
+	noHeader := opts.NoHeader
+	if appendMode {
+		// A JSON array cannot be extended by writing another one after it
+		if format == FormatJSON {
+			return nil, fmt.Errorf("cannot append to JSON output %s", outputFile)
+		}
+		if info, err := os.Stat(outputFile); err == nil && info.Size() > 0 {
+			noHeader = true
+		}
+	}
+
+	file, counter, err := openOutput(outputFile, appendMode)
+	if err != nil {
+		return nil, err
+	}
+
+	delimiter := opts.Delimiter
+	if delimiter == 0 {
+		delimiter = DetectOutputDelimiter(outputFile)
+	}
+
+	out := &output{
+		path:      outputFile,
+		format:    format,
+		delimiter: delimiter,
+		file:      file,
+		counter:   counter,
+		writer:    newRowWriter(file, format, delimiter, noHeader, opts.NullOutput, opts.JSONKey),
+	}
+	if format != FormatCSV {
+		out.delimiter = 0
+	}
+	switch strings.ToLower(filepath.Ext(outputFile)) {
+	case ".gz":
+		out.compression = "gzip"
+	case ".bz2":
+		out.compression = "bzip2"
+	}
+	return out, nil
+}
+
+// declaredTypes returns the declared type of each result column, or "" for
+// columns that are not taken directly from a table.
+func declaredTypes(rows *sql.Rows) ([]string, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column types: %w", err)
+	}
+	types := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		types[i] = ct.DatabaseTypeName()
+	}
+	return types, nil
+}
+
+// inferTypes fills the untyped columns of types from the storage class of a
+// row's values and returns how many it filled. NULL values leave a column untyped.
+func inferTypes(types []string, values []interface{}) int {
+	filled := 0
+	for i, val := range values {
+		if types[i] != "" {
+			continue
+		}
+		switch val.(type) {
+		case int64:
+			types[i] = "INTEGER"
+		case float64:
+			types[i] = "REAL"
+		case string:
+			types[i] = "TEXT"
+		case []byte:
+			types[i] = "BLOB"
+		default:
+			continue
+		}
+		filled++
+	}
+	return filled
+}
+
+// explainReadOnly adds context to errors caused by writes rejected in read-only mode.
+func explainReadOnly(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly {
+		return fmt.Errorf("query attempted to modify the database in read-only mode: %w", err)
+	}
+	return err
 }
@@ -1,8 +1,16 @@
 package exporter
 
 import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime/trace"
 	"strings"
 	"testing"
 
@@ -33,6 +41,29 @@ func TestDetectOutputDelimiter(t *testing.T) {
 	}
 }
 
+func TestDetectOutputFormat(t *testing.T) {
+	tests := []struct {
+		filePath string
+		want     string
+	}{
+		{"", FormatCSV},
+		{"output.csv", FormatCSV},
+		{"output.tsv", FormatCSV},
+		{"output.json", FormatJSON},
+		{"output.JSON", FormatJSON},
+		{"output.json.gz", FormatJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filePath, func(t *testing.T) {
+			got := DetectOutputFormat(tt.filePath)
+			if got != tt.want {
+				t.Errorf("DetectOutputFormat(%q) = %q, want %q", tt.filePath, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestExecuteQuery(t *testing.T) {
 	db, err := database.Open("")
 	if err != nil {
@@ -155,3 +186,853 @@ func TestExecuteQueryToGzip(t *testing.T) {
 		t.Error("Expected non-empty gzip file")
 	}
 }
+
+func TestExecuteQueryToBzip2(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name"}
+	if err := database.CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	batch := [][]string{{"1", "Alice"}, {"2", "Bob"}}
+	if err := database.InsertBatch(db.DB, "test", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "output.csv.bz2")
+	result, err := Execute(db.DB, "SELECT * FROM test", outputPath, ',')
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got := result.Outputs[0].Compression; got != "bzip2" {
+		t.Errorf("Compression = %q, want bzip2", got)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(bzip2.NewReader(file))
+	if err != nil {
+		t.Fatalf("reading bzip2 output: %v", err)
+	}
+	if want := "id,name\n1,Alice\n2,Bob\n"; string(content) != want {
+		t.Errorf("decompressed output = %q, want %q", content, want)
+	}
+}
+
+func TestTableRowWriter(t *testing.T) {
+	columns := []string{"id", "name", "note"}
+	rows := [][]interface{}{
+		{int64(1), "Zoë", nil},
+		{int64(22), []byte("Bob"), "two\nlines"},
+	}
+	tests := []struct {
+		name     string
+		noHeader bool
+		want     string
+	}{
+		{"with header", false, `┌────┬──────┬────────────┐
+│ id │ name │ note       │
+├────┼──────┼────────────┤
+│ 1  │ Zoë  │ NULL       │
+│ 22 │ Bob  │ two\nlines │
+└────┴──────┴────────────┘
+`},
+		{"without header", true, `┌────┬─────┬────────────┐
+│ 1  │ Zoë │ NULL       │
+│ 22 │ Bob │ two\nlines │
+└────┴─────┴────────────┘
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer := newRowWriter(&buf, FormatTable, ',', tt.noHeader, "NULL", "")
+			if err := writer.WriteHeader(columns); err != nil {
+				t.Fatalf("WriteHeader() error = %v", err)
+			}
+			for _, row := range rows {
+				if err := writer.WriteRow(row); err != nil {
+					t.Fatalf("WriteRow() error = %v", err)
+				}
+			}
+			if err := writer.Finish(); err != nil {
+				t.Fatalf("Finish() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("table =\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteMaxRows(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id"}
+	if err := database.CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := database.InsertBatch(db.DB, "test", headers, [][]string{{"1"}, {"2"}, {"3"}}); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	tests := []struct {
+		maxRows       int
+		wantRows      int
+		wantTruncated bool
+	}{
+		{0, 3, false},
+		{2, 2, true},
+		{3, 3, false},
+	}
+	for _, tt := range tests {
+		outputPath := filepath.Join(t.TempDir(), "out.csv")
+		result, err := ExecuteWithOptions(db.DB, "SELECT id FROM test ORDER BY id", outputPath, Options{MaxRows: tt.maxRows})
+		if err != nil {
+			t.Fatalf("ExecuteWithOptions(MaxRows %d) error = %v", tt.maxRows, err)
+		}
+		if result.RowCount != tt.wantRows || result.Truncated != tt.wantTruncated {
+			t.Errorf("MaxRows %d: RowCount = %d, Truncated = %v, want %d, %v", tt.maxRows, result.RowCount, result.Truncated, tt.wantRows, tt.wantTruncated)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != tt.wantRows+1 {
+			t.Errorf("MaxRows %d: output has %d lines, want %d", tt.maxRows, lines, tt.wantRows+1)
+		}
+	}
+
+	// A statement left open by the early stop would lock the table
+	if _, err := db.DB.Exec("DROP TABLE test"); err != nil {
+		t.Errorf("DROP TABLE after a truncated query: %v", err)
+	}
+}
+
+func TestExecuteTableFormatToFile(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	_, err = ExecuteWithOptions(db.DB, "SELECT 1", filepath.Join(t.TempDir(), "out.csv"), Options{Format: FormatTable})
+	if err == nil || !strings.Contains(err.Error(), "only be written to stdout") {
+		t.Errorf("ExecuteWithOptions() error = %v, want a stdout-only error", err)
+	}
+}
+
+func TestExecuteBytesWrittenCompressed(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name"}
+	if err := database.CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	batch := make([][]string, 1000)
+	for i := range batch {
+		batch[i] = []string{"1", "the same highly compressible value"}
+	}
+	if err := database.InsertBatch(db.DB, "test", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	plainPath := filepath.Join(tmpDir, "output.csv")
+	gzPath := filepath.Join(tmpDir, "output.csv.gz")
+
+	plain, err := Execute(db.DB, "SELECT * FROM test", plainPath, ',')
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	compressed, err := Execute(db.DB, "SELECT * FROM test", gzPath, ',')
+	if err != nil {
+		t.Fatalf("Execute() gzip error = %v", err)
+	}
+
+	info, err := os.Stat(plainPath)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if plain.BytesWritten != info.Size() {
+		t.Errorf("BytesWritten = %d, want file size %d", plain.BytesWritten, info.Size())
+	}
+
+	gzInfo, err := os.Stat(gzPath)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if compressed.BytesWritten == 0 {
+		t.Error("Expected non-zero BytesWritten for gzip output")
+	}
+	if compressed.BytesWritten != gzInfo.Size() {
+		t.Errorf("gzip BytesWritten = %d, want file size %d", compressed.BytesWritten, gzInfo.Size())
+	}
+	if compressed.BytesWritten >= plain.BytesWritten {
+		t.Errorf("gzip BytesWritten = %d, want less than uncompressed %d", compressed.BytesWritten, plain.BytesWritten)
+	}
+}
+
+func TestExecuteQueryOnly(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name"}
+	if err := database.CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := database.InsertBatch(db.DB, "test", headers, [][]string{{"1", "Alice"}, {"2", "Bob"}}); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	opts := Options{Delimiter: ',', QueryOnly: true}
+
+	_, err = ExecuteWithOptions(db.DB, "DELETE FROM test", filepath.Join(tmpDir, "delete.csv"), opts)
+	if err == nil {
+		t.Fatal("Expected error for DELETE in read-only mode, got nil")
+	}
+	if !strings.Contains(err.Error(), "read-only mode") {
+		t.Errorf("Expected read-only error, got: %v", err)
+	}
+
+	result, err := ExecuteWithOptions(db.DB, "SELECT * FROM test", filepath.Join(tmpDir, "select.csv"), opts)
+	if err != nil {
+		t.Fatalf("ExecuteWithOptions() SELECT error = %v", err)
+	}
+	if result.RowCount != 2 {
+		t.Errorf("RowCount = %d, want 2 (rows must survive the rejected DELETE)", result.RowCount)
+	}
+
+	// The connection is restored, so later writes outside read-only mode still work
+	if _, err := db.DB.Exec("DELETE FROM test WHERE id = '1'"); err != nil {
+		t.Errorf("Exec() after read-only query error = %v", err)
+	}
+}
+
+func TestExecuteToFilesCSVAndJSON(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name", "city"}
+	if err := database.CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	batch := [][]string{
+		{"1", "Alice", "New York"},
+		{"2", "Bob", "Los Angeles"},
+		{"3", "Charlie", "Chicago"},
+	}
+	if err := database.InsertBatch(db.DB, "test", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	csvPath := filepath.Join(tmpDir, "results.csv")
+	jsonPath := filepath.Join(tmpDir, "results.json")
+
+	result, err := ExecuteToFiles(db.DB, "SELECT * FROM test ORDER BY id", []string{csvPath, jsonPath}, Options{})
+	if err != nil {
+		t.Fatalf("ExecuteToFiles() error = %v", err)
+	}
+	if result.RowCount != 3 {
+		t.Errorf("RowCount = %d, want 3", result.RowCount)
+	}
+	if len(result.Outputs) != 2 {
+		t.Fatalf("Expected 2 outputs, got %d", len(result.Outputs))
+	}
+
+	csvFile, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer csvFile.Close()
+	records, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	content, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var objects []map[string]string
+	if err := json.Unmarshal(content, &objects); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v\n%s", err, content)
+	}
+
+	if len(records) != len(objects)+1 {
+		t.Fatalf("CSV has %d data rows, JSON has %d objects", len(records)-1, len(objects))
+	}
+	for i, obj := range objects {
+		for j, col := range records[0] {
+			if obj[col] != records[i+1][j] {
+				t.Errorf("row %d column %s: JSON %q, CSV %q", i, col, obj[col], records[i+1][j])
+			}
+		}
+	}
+}
+
+func TestExecuteWithTracing(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name", "age"}
+	if err := database.CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	batch := [][]string{
+		{"1", "Alice", "30"},
+		{"2", "Bob", "25"},
+		{"3", "Charlie", "35"},
+	}
+	if err := database.InsertBatch(db.DB, "test", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	query := "SELECT * FROM test ORDER BY id"
+
+	plainPath := filepath.Join(tmpDir, "plain.csv")
+	if _, err := Execute(db.DB, query, plainPath, ','); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	var traceBuf bytes.Buffer
+	if err := trace.Start(&traceBuf); err != nil {
+		t.Fatalf("trace.Start() error = %v", err)
+	}
+	tracedPath := filepath.Join(tmpDir, "traced.csv")
+	result, err := ExecuteWithOptions(db.DB, query, tracedPath, Options{Delimiter: ',', QueryIndex: 1})
+	trace.Stop()
+	if err != nil {
+		t.Fatalf("ExecuteWithOptions() with tracing error = %v", err)
+	}
+	if result.RowCount != 3 {
+		t.Errorf("RowCount = %d, want 3", result.RowCount)
+	}
+	if traceBuf.Len() == 0 {
+		t.Error("Expected trace data to be written")
+	}
+
+	plain, err := os.ReadFile(plainPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	traced, err := os.ReadFile(tracedPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !bytes.Equal(plain, traced) {
+		t.Errorf("Traced output differs:\n%s\nwant:\n%s", traced, plain)
+	}
+}
+
+func TestExecuteCreatesOutputDirectory(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "results", "2024", "out.csv.gz")
+	result, err := Execute(db.DB, "SELECT 1 AS one", outputPath, ',')
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if result.RowCount != 1 {
+		t.Errorf("RowCount = %d, want 1", result.RowCount)
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Errorf("Output file not created: %v", err)
+	}
+}
+
+func TestExecuteAppend(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	dir := t.TempDir()
+	appendOpts := Options{Append: true}
+
+	t.Run("csv", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "out.csv")
+		for _, query := range []string{"SELECT 1 AS id, 'a' AS name", "SELECT 2 AS id, 'b' AS name"} {
+			if _, err := ExecuteWithOptions(db.DB, query, outputPath, appendOpts); err != nil {
+				t.Fatalf("ExecuteWithOptions(%q) error = %v", query, err)
+			}
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		if want := "id,name\n1,a\n2,b\n"; string(data) != want {
+			t.Errorf("Output = %q, want %q", data, want)
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "out.csv.gz")
+		for _, query := range []string{"SELECT 1 AS id", "SELECT 2 AS id"} {
+			if _, err := ExecuteWithOptions(db.DB, query, outputPath, appendOpts); err != nil {
+				t.Fatalf("ExecuteWithOptions(%q) error = %v", query, err)
+			}
+		}
+		f, err := os.Open(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to open output: %v", err)
+		}
+		defer f.Close()
+		// Each append adds a gzip member; readers decompress them as one stream
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader() error = %v", err)
+		}
+		data, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatalf("Failed to decompress output: %v", err)
+		}
+		if want := "id\n1\n2\n"; string(data) != want {
+			t.Errorf("Output = %q, want %q", data, want)
+		}
+	})
+
+	t.Run("no header", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "noheader.tsv")
+		if _, err := ExecuteWithOptions(db.DB, "SELECT 1 AS id, 'a' AS name", outputPath, Options{NoHeader: true}); err != nil {
+			t.Fatalf("ExecuteWithOptions() error = %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		if want := "1\ta\n"; string(data) != want {
+			t.Errorf("Output = %q, want %q", data, want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		outputPath := filepath.Join(dir, "out.json")
+		_, err := ExecuteWithOptions(db.DB, "SELECT 1 AS id", outputPath, appendOpts)
+		if err == nil || !strings.Contains(err.Error(), "cannot append to JSON") {
+			t.Errorf("ExecuteWithOptions() error = %v, want JSON append error", err)
+		}
+	})
+}
+
+func TestExecuteColumnTypes(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE people (id INTEGER, name TEXT, age TEXT)"); err != nil {
+		t.Fatalf("CREATE TABLE error = %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO people VALUES (1, 'Alice', '30'), (2, 'Bob', NULL)"); err != nil {
+		t.Fatalf("INSERT error = %v", err)
+	}
+
+	// Expressions take the type of their first non-NULL value
+	query := "SELECT id, name, CAST(age AS INTEGER) AS age, id * 1.5 AS score, NULL AS missing FROM people ORDER BY id DESC"
+	result, err := ExecuteWithOptions(db.DB, query, filepath.Join(t.TempDir(), "out.csv"), Options{})
+	if err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	want := []string{"INTEGER", "TEXT", "INTEGER", "REAL", ""}
+	if strings.Join(result.ColumnTypes, ",") != strings.Join(want, ",") {
+		t.Errorf("ColumnTypes = %q, want %q", result.ColumnTypes, want)
+	}
+}
+
+func TestExecuteJSONKey(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+
+	outputPath := filepath.Join(dir, "lookup.json")
+	query := "SELECT 'a' AS code, 1 AS n UNION ALL SELECT 'b', 2"
+	if _, err := ExecuteWithOptions(db.DB, query, outputPath, Options{JSONKey: "code"}); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	want := "{\n  \"a\": {\"code\": \"a\", \"n\": 1},\n  \"b\": {\"code\": \"b\", \"n\": 2}\n}\n"
+	if string(data) != want {
+		t.Errorf("Output = %q, want %q", data, want)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		key     string
+		wantErr string
+	}{
+		{"duplicate", "SELECT 'a' AS code UNION ALL SELECT 'a'", "code", `duplicate JSON key "a"`},
+		{"null", "SELECT NULL AS code", "code", "is NULL in row 1"},
+		{"missing column", "SELECT 1 AS n", "code", "JSON key column 'code' is not in the query results"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteWithOptions(db.DB, tt.query, filepath.Join(dir, tt.name+".json"), Options{JSONKey: tt.key})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecuteWithOptions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecuteJSONNullAndEmpty(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+
+	// Empty text and BLOBs are values; only SQL NULL is null
+	query := "SELECT '' AS empty, NULL AS missing, X'' AS blob, CAST(NULL AS TEXT) AS typed"
+	for _, encoding := range []string{"", BinaryBase64} {
+		outputPath := filepath.Join(dir, "values"+encoding+".json")
+		if _, err := ExecuteWithOptions(db.DB, query, outputPath, Options{BinaryEncoding: encoding}); err != nil {
+			t.Fatalf("ExecuteWithOptions() error = %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		want := `{"empty": "", "missing": null, "blob": "", "typed": null}`
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Output with encoding %q = %s, want it to contain %s", encoding, data, want)
+		}
+	}
+}
+
+func TestExecuteNullOutput(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+
+	query := "SELECT 1 AS id, NULL AS note, '' AS empty"
+	csvPath := filepath.Join(dir, "out.csv")
+	jsonPath := filepath.Join(dir, "out.json")
+	if _, err := ExecuteToFiles(db.DB, query, []string{csvPath, jsonPath}, Options{NullOutput: `\N`}); err != nil {
+		t.Fatalf("ExecuteToFiles() error = %v", err)
+	}
+
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if want := "id,note,empty\n1,\\N,\n"; string(data) != want {
+		t.Errorf("CSV output = %q, want %q", data, want)
+	}
+	data, err = os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if want := `{"id": 1, "note": null, "empty": ""}`; !strings.Contains(string(data), want) {
+		t.Errorf("JSON output = %s, want it to contain %s", data, want)
+	}
+
+	value, err := QueryScalar(db.DB, "SELECT NULL", Options{NullOutput: "NULL"})
+	if err != nil || value != "NULL" {
+		t.Errorf("QueryScalar() = %q, %v; want NULL", value, err)
+	}
+}
+
+func TestExecuteFlushRowsBrokenPipe(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// Stdout is a pipe whose reader has gone away, as with "| head"
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	r.Close()
+	defer w.Close()
+	oldStdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	query := "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 1000000) SELECT i FROM n"
+	_, err = ExecuteWithOptions(db.DB, query, "", Options{FlushRows: 100})
+	if err == nil || !strings.Contains(err.Error(), "failed to write") {
+		t.Errorf("ExecuteWithOptions() error = %v, want a write error", err)
+	}
+}
+
+func TestExecuteRotateBytes(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "out.csv")
+
+	query := "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 20000) SELECT i, 'row ' || i AS label FROM n"
+	result, err := ExecuteWithOptions(db.DB, query, outputPath, Options{RotateBytes: 50000})
+	if err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	if len(result.Outputs) < 3 {
+		t.Fatalf("Expected several parts, got %+v", result.Outputs)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no unsplit output, Stat() error = %v", err)
+	}
+
+	// Every part has the header, and together they hold every row once
+	rows := 0
+	for i, out := range result.Outputs {
+		if want := filepath.Join(dir, fmt.Sprintf("out.%d.csv", i)); out.Path != want {
+			t.Errorf("Part %d path = %s, want %s", i, out.Path, want)
+		}
+		data, err := os.ReadFile(out.Path)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", out.Path, err)
+		}
+		if records[0][0] != "i" {
+			t.Errorf("Part %d header = %v, want i,label", i, records[0])
+		}
+		rows += len(records) - 1
+	}
+	if rows != 20000 || result.RowCount != 20000 {
+		t.Errorf("Parts hold %d rows (result %d), want 20000", rows, result.RowCount)
+	}
+
+	if got := PartPath("out/data.csv.gz", 2); got != "out/data.2.csv.gz" {
+		t.Errorf("PartPath() = %s, want out/data.2.csv.gz", got)
+	}
+}
+
+func TestExecuteReplaceNaN(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+
+	// SQLite returns NULL for a division by zero, so infinities come from
+	// floats that overflow, as in sums and products of large values
+	query := "SELECT 1e308 * 10 AS overflow, -1e999 AS negative, 1.0 / 0 AS div, 2.5 AS finite"
+
+	csvPath := filepath.Join(dir, "out.csv")
+	if _, err := ExecuteWithOptions(db.DB, query, csvPath, Options{}); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "overflow,negative,div,finite\n+Inf,-Inf,,2.5\n"; string(data) != want {
+		t.Errorf("Output without ReplaceNaN = %q, want %q", data, want)
+	}
+
+	if _, err := ExecuteWithOptions(db.DB, query, csvPath, Options{ReplaceNaN: true, NaNToken: "NA"}); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	if data, err = os.ReadFile(csvPath); err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "overflow,negative,div,finite\nNA,NA,,2.5\n"; string(data) != want {
+		t.Errorf("Output = %q, want %q", data, want)
+	}
+
+	jsonPath := filepath.Join(dir, "out.json")
+	if _, err := ExecuteWithOptions(db.DB, query, jsonPath, Options{ReplaceNaN: true}); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	if data, err = os.ReadFile(jsonPath); err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := `{"overflow": "", "negative": "", "div": null, "finite": 2.5}`; !strings.Contains(string(data), want) {
+		t.Errorf("JSON output = %s, want row %s", data, want)
+	}
+}
+
+func TestExecuteFloatFormat(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+
+	query := "SELECT AVG(x) AS avg, SUM(x) * 1000000 AS big, 0.00001 AS small, CAST('hi' AS BLOB) AS blob " +
+		"FROM (SELECT 1.0 AS x UNION ALL SELECT 2.0 UNION ALL SELECT 2.0)"
+
+	// Without a format, floats are written in full, without an exponent
+	csvPath := filepath.Join(dir, "out.csv")
+	if _, err := ExecuteWithOptions(db.DB, query, csvPath, Options{}); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "avg,big,small,blob\n1.6666666666666667,5000000,0.00001,hi\n"; string(data) != want {
+		t.Errorf("Output = %q, want %q", data, want)
+	}
+
+	opts := Options{FloatFormat: "%.2f"}
+	if _, err := ExecuteWithOptions(db.DB, query, csvPath, opts); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	if data, err = os.ReadFile(csvPath); err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "avg,big,small,blob\n1.67,5000000.00,0.00,hi\n"; string(data) != want {
+		t.Errorf("Output with %%.2f = %q, want %q", data, want)
+	}
+
+	// Formatted floats stay numbers in JSON
+	jsonPath := filepath.Join(dir, "out.json")
+	if _, err := ExecuteWithOptions(db.DB, query, jsonPath, opts); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	if data, err = os.ReadFile(jsonPath); err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := `{"avg": 1.67, "big": 5000000.00, "small": 0.00, "blob": "hi"}`; !strings.Contains(string(data), want) {
+		t.Errorf("JSON output = %s, want row %s", data, want)
+	}
+
+	if value, err := QueryScalar(db.DB, "SELECT SUM(x) * 1000000 FROM (SELECT 2.5 AS x)", Options{}); err != nil || value != "2500000" {
+		t.Errorf("QueryScalar() = %q, %v, want 2500000", value, err)
+	}
+
+	for _, format := range []string{"%d", "%8.2f", "%.2f%%", "%s"} {
+		if err := ValidateFloatFormat(format); err == nil {
+			t.Errorf("ValidateFloatFormat(%q) error = nil, want an error", format)
+		}
+	}
+}
+
+func TestExecuteTimeAndTextValues(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// The driver scans DATETIME columns as times, and BLOBs as byte slices
+	if _, err := db.Exec(`CREATE TABLE events (at DATETIME, precise TIMESTAMP, note BLOB, missing TEXT)`); err != nil {
+		t.Fatalf("CREATE TABLE error = %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO events VALUES ('2024-01-02 03:04:05', '2024-01-02T03:04:05.25Z', CAST('Hello' AS BLOB), NULL)`); err != nil {
+		t.Fatalf("INSERT error = %v", err)
+	}
+
+	csvPath := filepath.Join(t.TempDir(), "events.csv")
+	if _, err := ExecuteWithOptions(db.DB, "SELECT * FROM events", csvPath, Options{NullOutput: "NULL"}); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := "at,precise,note,missing\n2024-01-02T03:04:05Z,2024-01-02T03:04:05.25Z,Hello,NULL\n"; string(data) != want {
+		t.Errorf("Output = %q, want %q", data, want)
+	}
+
+	jsonPath := filepath.Join(t.TempDir(), "events.json")
+	if _, err := ExecuteWithOptions(db.DB, "SELECT at, note FROM events", jsonPath, Options{}); err != nil {
+		t.Fatalf("ExecuteWithOptions() error = %v", err)
+	}
+	if data, err = os.ReadFile(jsonPath); err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := `{"at": "2024-01-02T03:04:05Z", "note": "Hello"}`; !strings.Contains(string(data), want) {
+		t.Errorf("JSON output = %s, want row %s", data, want)
+	}
+}
+
+func TestCountRows(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	headers := []string{"id", "name", "age"}
+	if err := database.CreateTable(db.DB, "test", headers); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	batch := [][]string{
+		{"1", "Alice", "30"},
+		{"2", "Bob", "25"},
+		{"3", "Charlie", "35"},
+	}
+	if err := database.InsertBatch(db.DB, "test", headers, batch); err != nil {
+		t.Fatalf("InsertBatch() error = %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"SELECT * FROM test", 3},
+		{"SELECT name FROM test WHERE age > 28;", 2},
+		{"SELECT * FROM test -- trailing comment", 3},
+		{"SELECT * FROM test WHERE 0", 0},
+	}
+	for _, tt := range tests {
+		got, err := CountRows(db.DB, tt.query, Options{QueryOnly: true})
+		if err != nil {
+			t.Fatalf("CountRows(%q) error = %v", tt.query, err)
+		}
+		if got != tt.want {
+			t.Errorf("CountRows(%q) = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
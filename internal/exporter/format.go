@@ -0,0 +1,446 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Output formats
+const (
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+	FormatTable = "table" // Aligned box-drawing table, for terminals (see Options.Format)
+)
+
+// tableSampleRows is how many rows a table output buffers to size its
+// columns. Later rows are padded to the same widths, and a longer value
+// widens only its own row.
+const tableSampleRows = 1000
+
+// DetectOutputFormat detects the output format based on file extension.
+// Returns FormatJSON for .json files and FormatCSV for everything else (including TSV).
+func DetectOutputFormat(filePath string) string {
+	if strings.ToLower(filepath.Ext(stripCompressionExt(filePath))) == ".json" {
+		return FormatJSON
+	}
+	return FormatCSV
+}
+
+// rowWriter writes query results in a specific output format.
+type rowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	// Flush writes buffered rows and returns any error writing them.
+	Flush() error
+	// Finish writes any trailing output and flushes buffered data.
+	Finish() error
+}
+
+// newRowWriter creates a row writer for the given format. noHeader omits the
+// header row of delimited text, and nullText is written there for NULL; JSON
+// always names its fields and writes null. A non-empty jsonKey writes JSON as
+// an object keyed by that column instead of an array.
+func newRowWriter(w io.Writer, format string, delimiter rune, noHeader bool, nullText, jsonKey string) rowWriter {
+	switch format {
+	case FormatJSON:
+		return &jsonRowWriter{writer: bufio.NewWriter(w), keyColumn: jsonKey}
+	case FormatTable:
+		return &tableRowWriter{writer: bufio.NewWriter(w), noHeader: noHeader, nullText: nullText}
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	return &csvRowWriter{writer: writer, noHeader: noHeader, nullText: nullText}
+}
+
+// csvRowWriter writes delimited text with an optional header row.
+type csvRowWriter struct {
+	writer   *csv.Writer
+	record   []string
+	noHeader bool
+	nullText string
+}
+
+func (c *csvRowWriter) WriteHeader(columns []string) error {
+	c.record = make([]string, len(columns))
+	if c.noHeader {
+		return nil
+	}
+	return c.writer.Write(columns)
+}
+
+func (c *csvRowWriter) WriteRow(values []interface{}) error {
+	for i, val := range values {
+		c.record[i] = formatValue(val)
+		if val == nil {
+			c.record[i] = c.nullText
+		}
+	}
+	return c.writer.Write(c.record)
+}
+
+func (c *csvRowWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvRowWriter) Finish() error {
+	return c.Flush()
+}
+
+// jsonRowWriter writes a JSON array with one object per row, keeping column order.
+// SQL NULL is written as null, so it stays distinct from an empty string.
+// With a key column, rows are written as the members of one object instead,
+// named by their value in that column.
+type jsonRowWriter struct {
+	writer    *bufio.Writer
+	keys      [][]byte
+	rows      int
+	keyColumn string          // Column whose values name the rows ("" = write an array)
+	keyIndex  int             // Position of keyColumn in the results
+	seen      map[string]bool // Row names written so far, to reject duplicates
+}
+
+func (j *jsonRowWriter) WriteHeader(columns []string) error {
+	j.keys = make([][]byte, len(columns))
+	for i, col := range columns {
+		key, err := json.Marshal(col)
+		if err != nil {
+			return err
+		}
+		j.keys[i] = key
+	}
+
+	if j.keyColumn == "" {
+		_, err := j.writer.WriteString("[")
+		return err
+	}
+	j.keyIndex = -1
+	for i, col := range columns {
+		if strings.EqualFold(col, j.keyColumn) {
+			j.keyIndex = i
+			break
+		}
+	}
+	if j.keyIndex < 0 {
+		return fmt.Errorf("JSON key column '%s' is not in the query results (columns: %s)", j.keyColumn, strings.Join(columns, ", "))
+	}
+	j.seen = make(map[string]bool)
+	_, err := j.writer.WriteString("{")
+	return err
+}
+
+// WriteRow writes one object. bufio.Writer errors are sticky, so only the
+// final write's error is checked; earlier failures surface there or in Finish.
+func (j *jsonRowWriter) WriteRow(values []interface{}) error {
+	if j.rows > 0 {
+		j.writer.WriteString(",")
+	}
+	j.rows++
+
+	j.writer.WriteString("\n  ")
+	if j.keyColumn != "" {
+		if err := j.writeRowName(values[j.keyIndex]); err != nil {
+			return err
+		}
+	}
+	j.writer.WriteString("{")
+	for i, val := range values {
+		if i > 0 {
+			j.writer.WriteString(", ")
+		}
+		j.writer.Write(j.keys[i])
+		j.writer.WriteString(": ")
+
+		encoded, err := json.Marshal(jsonValue(val))
+		if err != nil {
+			return fmt.Errorf("failed to encode value: %w", err)
+		}
+		if _, err := j.writer.Write(encoded); err != nil {
+			return err
+		}
+	}
+	_, err := j.writer.WriteString("}")
+	return err
+}
+
+// writeRowName writes the member name of a row in a keyed object.
+func (j *jsonRowWriter) writeRowName(val interface{}) error {
+	if val == nil {
+		return fmt.Errorf("JSON key column '%s' is NULL in row %d", j.keyColumn, j.rows)
+	}
+	name := formatValue(val)
+	if j.seen[name] {
+		return fmt.Errorf("duplicate JSON key %q in column '%s' (row %d)", name, j.keyColumn, j.rows)
+	}
+	j.seen[name] = true
+
+	encoded, err := json.Marshal(name)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	j.writer.Write(encoded)
+	j.writer.WriteString(": ")
+	return nil
+}
+
+func (j *jsonRowWriter) Flush() error {
+	return j.writer.Flush()
+}
+
+func (j *jsonRowWriter) Finish() error {
+	if j.rows > 0 {
+		j.writer.WriteString("\n")
+	}
+	if j.keyColumn != "" {
+		j.writer.WriteString("}\n")
+	} else {
+		j.writer.WriteString("]\n")
+	}
+	return j.writer.Flush()
+}
+
+// tableRowWriter writes an aligned table drawn with box-drawing characters,
+// like the sqlite3 shell's box mode. Column widths are taken from the header
+// and the first tableSampleRows rows, which are held until they are known.
+type tableRowWriter struct {
+	writer   *bufio.Writer
+	columns  []string
+	pending  [][]string // Rows held until the widths are known
+	widths   []int      // Width of each column (nil = not known yet)
+	noHeader bool
+	nullText string
+}
+
+func (t *tableRowWriter) WriteHeader(columns []string) error {
+	t.columns = make([]string, len(columns))
+	for i, col := range columns {
+		t.columns[i] = tableCell(col)
+	}
+	return nil
+}
+
+func (t *tableRowWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, val := range values {
+		record[i] = tableCell(formatValue(val))
+		if val == nil {
+			record[i] = t.nullText
+		}
+	}
+	if t.widths != nil {
+		return t.writeLine(record)
+	}
+	t.pending = append(t.pending, record)
+	if len(t.pending) >= tableSampleRows {
+		return t.start()
+	}
+	return nil
+}
+
+// start sizes the columns from the header and the held rows, and writes
+// the top of the table followed by the held rows.
+func (t *tableRowWriter) start() error {
+	t.widths = make([]int, len(t.columns))
+	if !t.noHeader {
+		for i, col := range t.columns {
+			t.widths[i] = utf8.RuneCountInString(col)
+		}
+	}
+	for _, record := range t.pending {
+		for i, cell := range record {
+			t.widths[i] = max(t.widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	t.writeRule("┌", "┬", "┐")
+	if !t.noHeader {
+		t.writeLine(t.columns)
+		t.writeRule("├", "┼", "┤")
+	}
+	for _, record := range t.pending {
+		t.writeLine(record)
+	}
+	t.pending = nil
+	return t.writer.Flush()
+}
+
+// writeLine writes one row of cells, each padded to its column's width.
+func (t *tableRowWriter) writeLine(cells []string) error {
+	for i, cell := range cells {
+		t.writer.WriteString("│ ")
+		t.writer.WriteString(cell)
+		t.writer.WriteString(strings.Repeat(" ", max(0, t.widths[i]-utf8.RuneCountInString(cell))+1))
+	}
+	_, err := t.writer.WriteString("│\n")
+	return err
+}
+
+// writeRule writes a horizontal border of the table.
+func (t *tableRowWriter) writeRule(left, middle, right string) {
+	t.writer.WriteString(left)
+	for i, width := range t.widths {
+		if i > 0 {
+			t.writer.WriteString(middle)
+		}
+		t.writer.WriteString(strings.Repeat("─", width+2))
+	}
+	t.writer.WriteString(right + "\n")
+}
+
+// Flush writes the rows so far once the widths are known; until then rows
+// are held, so a failed write surfaces only after tableSampleRows rows.
+func (t *tableRowWriter) Flush() error {
+	if t.widths == nil {
+		return nil
+	}
+	return t.writer.Flush()
+}
+
+func (t *tableRowWriter) Finish() error {
+	if len(t.columns) == 0 {
+		return nil
+	}
+	if t.widths == nil {
+		if err := t.start(); err != nil {
+			return err
+		}
+	}
+	t.writeRule("└", "┴", "┘")
+	return t.writer.Flush()
+}
+
+// tableCell escapes the line breaks and tabs of a value so that every row
+// of a table is one aligned line.
+func tableCell(value string) string {
+	return tableEscaper.Replace(value)
+}
+
+var tableEscaper = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// formatValue renders a scanned value as delimited text. The driver scans
+// columns declared DATE, DATETIME or TIMESTAMP as times, which are written as
+// RFC 3339, with fractional seconds only if they have any.
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case float64:
+		return formatFloat(v, "")
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// formatFloat renders a float with format (see Options.FloatFormat) or, if
+// it is empty, as the shortest decimal that reads back as the same value,
+// without an exponent: 1000000 rather than 1e+06. NaN and infinities are
+// written as NaN, +Inf and -Inf.
+func formatFloat(f float64, format string) string {
+	if format != "" && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return fmt.Sprintf(format, f)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// floatFormatPattern matches the formats Options.FloatFormat accepts, which
+// always write a JSON number.
+var floatFormatPattern = regexp.MustCompile(`^%(\.[0-9]+)?[eEfgG]$`)
+
+// ValidateFloatFormat checks that format is empty or a supported float format.
+func ValidateFloatFormat(format string) error {
+	if format != "" && !floatFormatPattern.MatchString(format) {
+		return fmt.Errorf("invalid float format: %s (use a printf verb such as '%%.2f', '%%e' or '%%g')", format)
+	}
+	return nil
+}
+
+// formatFloats replaces the finite floats in values with their text in
+// format, kept a number for JSON outputs. Other values are left as they are.
+func formatFloats(values []interface{}, format string) {
+	for i, val := range values {
+		if f, ok := val.(float64); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			values[i] = json.Number(formatFloat(f, format))
+		}
+	}
+}
+
+// Encodings for BLOB values (Options.BinaryEncoding).
+const (
+	BinaryBase64 = "base64"
+	BinaryHex    = "hex"
+)
+
+// ValidateBinaryEncoding checks that encoding is empty or a supported BLOB encoding.
+func ValidateBinaryEncoding(encoding string) error {
+	switch encoding {
+	case "", BinaryBase64, BinaryHex:
+		return nil
+	default:
+		return fmt.Errorf("invalid binary encoding: %s (use '%s' or '%s')", encoding, BinaryBase64, BinaryHex)
+	}
+}
+
+// encodeBinary replaces the BLOB values of a row with their text encoding.
+// Other values are left as they are.
+func encodeBinary(values []interface{}, encoding string) {
+	for i, val := range values {
+		b, ok := val.([]byte)
+		if !ok || b == nil {
+			continue
+		}
+		if encoding == BinaryHex {
+			values[i] = hex.EncodeToString(b)
+		} else {
+			values[i] = base64.StdEncoding.EncodeToString(b)
+		}
+	}
+}
+
+// replaceNonFinite replaces NaN and infinite floats in values with token.
+func replaceNonFinite(values []interface{}, token string) {
+	for i, val := range values {
+		if f, ok := val.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			values[i] = token
+		}
+	}
+}
+
+// jsonValue converts a scanned value to its JSON representation.
+// Numbers stay numeric, NULL becomes nil, and everything else is a string.
+func jsonValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case int64:
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return formatValue(v)
+		}
+		return v
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case json.Number:
+		return v
+	default:
+		return formatValue(v)
+	}
+}
@@ -8,32 +8,102 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/dsnet/compress/bzip2"
 )
 
 // OpenOutputFile opens an output file, handling compression automatically based on extension.
-// If filePath is empty, returns os.Stdout.
+// Missing parent directories are created. If filePath is empty, returns os.Stdout.
 func OpenOutputFile(filePath string) (io.WriteCloser, error) {
+	output, _, err := openOutput(filePath, false)
+	return output, err
+}
+
+// openOutput opens an output like OpenOutputFile and also returns a counter
+// of the bytes that reach the destination (i.e. after compression). If
+// appendMode is set, an existing file is appended to instead of truncated;
+// compressed output is then added as a new gzip member or bzip2 stream, which
+// gzip and bzip2 readers decompress as one stream.
+func openOutput(filePath string, appendMode bool) (io.WriteCloser, *countingWriter, error) {
 	if filePath == "" {
-		return os.Stdout, nil
+		counter := &countingWriter{writer: os.Stdout}
+		return &stdoutWriter{counter: counter}, counter, nil
+	}
+
+	// Create directory for output file if it doesn't exist
+	outDir := filepath.Dir(filePath)
+	if outDir != "." && outDir != "" {
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create output directory %s: %w", outDir, err)
+		}
 	}
 
-	file, err := os.Create(filePath)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(filePath, flags, 0o666)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %w", err)
+		return nil, nil, fmt.Errorf("failed to create output file: %w", err)
 	}
+	counter := &countingWriter{writer: file}
 
 	ext := strings.ToLower(filepath.Ext(filePath))
 	switch ext {
 	case ".gz":
-		return &gzipWriter{file: file, writer: gzip.NewWriter(file)}, nil
+		return &gzipWriter{file: file, writer: gzip.NewWriter(counter)}, counter, nil
 	case ".bz2":
-		file.Close()
-		return nil, fmt.Errorf("bzip2 output compression not yet supported, use .gz instead")
+		writer, err := bzip2.NewWriter(counter, nil)
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to create bzip2 writer: %w", err)
+		}
+		return &bzip2Writer{file: file, writer: writer}, counter, nil
 	default:
-		return file, nil
+		return &countedFile{file: file, counter: counter}, counter, nil
 	}
 }
 
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// countedFile writes to a file through a byte counter.
+type countedFile struct {
+	file    *os.File
+	counter *countingWriter
+}
+
+func (c *countedFile) Write(p []byte) (int, error) {
+	return c.counter.Write(p)
+}
+
+func (c *countedFile) Close() error {
+	return c.file.Close()
+}
+
+// stdoutWriter writes to os.Stdout through a byte counter with a no-op Close method.
+type stdoutWriter struct {
+	counter *countingWriter
+}
+
+func (s *stdoutWriter) Write(p []byte) (int, error) {
+	return s.counter.Write(p)
+}
+
+func (s *stdoutWriter) Close() error {
+	// Stdout should not be closed
+	return nil
+}
+
 // gzipWriter wraps gzip writer and file to close both properly.
 type gzipWriter struct {
 	file   *os.File
@@ -52,6 +122,24 @@ func (g *gzipWriter) Close() error {
 	return g.file.Close()
 }
 
+// bzip2Writer wraps bzip2 writer and file to close both properly.
+type bzip2Writer struct {
+	file   *os.File
+	writer *bzip2.Writer
+}
+
+func (b *bzip2Writer) Write(p []byte) (int, error) {
+	return b.writer.Write(p)
+}
+
+func (b *bzip2Writer) Close() error {
+	if err := b.writer.Close(); err != nil {
+		b.file.Close()
+		return err
+	}
+	return b.file.Close()
+}
+
 // DetectOutputDelimiter detects the output delimiter based on file extension.
 // Returns ',' for CSV files and '\t' for TSV files.
 func DetectOutputDelimiter(filePath string) rune {
@@ -59,7 +147,15 @@ func DetectOutputDelimiter(filePath string) rune {
 		return ','
 	}
 
-	// Strip compression extensions first
+	ext := strings.ToLower(filepath.Ext(stripCompressionExt(filePath)))
+	if ext == ".tsv" {
+		return '\t'
+	}
+	return ','
+}
+
+// stripCompressionExt removes compression extensions (.gz, .bz2) from a path.
+func stripCompressionExt(filePath string) string {
 	path := filePath
 	for {
 		ext := strings.ToLower(filepath.Ext(path))
@@ -69,10 +165,5 @@ func DetectOutputDelimiter(filePath string) rune {
 		}
 		break
 	}
-
-	ext := strings.ToLower(filepath.Ext(path))
-	if ext == ".tsv" {
-		return '\t'
-	}
-	return ','
+	return path
 }
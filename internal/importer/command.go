@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// maxCommandStderr is how much of a command's stderr is kept for error messages.
+const maxCommandStderr = 4096
+
+// OpenCommand runs a shell command and returns a reader over its stdout, so
+// the output can be imported as a stream. Once stdout is exhausted, Read
+// returns an error instead of io.EOF if the command exited unsuccessfully,
+// including what it wrote to stderr. Close kills the command if it is still
+// running.
+func OpenCommand(command string) (io.ReadCloser, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	stderr := &limitedBuffer{limit: maxCommandStderr}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture command output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command %q: %w", command, err)
+	}
+
+	return &commandReader{command: command, cmd: cmd, stdout: stdout, stderr: stderr}, nil
+}
+
+// commandReader reads a running command's stdout and reports its exit status.
+type commandReader struct {
+	command  string
+	cmd      *exec.Cmd
+	stdout   io.Reader
+	stderr   *limitedBuffer
+	waitOnce sync.Once
+	waitErr  error
+	eof      bool // stdout is exhausted and closed by Wait
+}
+
+func (c *commandReader) Read(p []byte) (int, error) {
+	// Readers such as bufio's may read again after io.EOF
+	if c.eof {
+		if c.waitErr != nil {
+			return 0, c.waitErr
+		}
+		return 0, io.EOF
+	}
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		c.eof = true
+		if waitErr := c.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (c *commandReader) Close() error {
+	// Stop a command whose output was not read to the end
+	c.waitOnce.Do(func() {
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+// wait waits for the command to exit and describes a failure.
+func (c *commandReader) wait() error {
+	c.waitOnce.Do(func() {
+		if err := c.cmd.Wait(); err != nil {
+			msg := strings.TrimSpace(c.stderr.String())
+			if msg == "" {
+				c.waitErr = fmt.Errorf("command %q failed: %w", c.command, err)
+			} else {
+				c.waitErr = fmt.Errorf("command %q failed: %w: %s", c.command, err, msg)
+			}
+		}
+	})
+	return c.waitErr
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest.
+type limitedBuffer struct {
+	limit int
+	buf   []byte
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if room := l.limit - len(l.buf); room > 0 {
+		if len(p) > room {
+			l.buf = append(l.buf, p[:room]...)
+		} else {
+			l.buf = append(l.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+func (l *limitedBuffer) String() string {
+	return string(l.buf)
+}
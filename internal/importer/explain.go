@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DelimiterCandidates are the field delimiters ExplainDelimiter tries.
+var DelimiterCandidates = []rune{',', '\t', ';', '|'}
+
+// DelimiterScore describes how the sampled lines of a file split on one
+// candidate delimiter.
+type DelimiterScore struct {
+	Delimiter   rune
+	FieldCounts map[int]int // Number of lines with each field count
+	Lines       int         // Lines sampled
+	Fields      int         // Most common field count
+	Share       float64     // Fraction of lines with the most common field count
+}
+
+// ExplainDelimiter reads up to maxLines lines of an input and splits them on
+// each of DelimiterCandidates, as CSV with quoting. Candidates are returned
+// best first: those that split lines into more than one field, the most
+// consistently, into the most fields.
+func ExplainDelimiter(input FileInput, maxLines int) ([]DelimiterScore, error) {
+	return scoreDelimiters(input, DelimiterCandidates, maxLines)
+}
+
+// ChooseDelimiter returns the score of the candidate delimiter that splits up
+// to maxLines lines of an input best, as ranked by ExplainDelimiter.
+func ChooseDelimiter(input FileInput, candidates []rune, maxLines int) (DelimiterScore, error) {
+	scores, err := scoreDelimiters(input, candidates, maxLines)
+	if err != nil {
+		return DelimiterScore{}, err
+	}
+	return scores[0], nil
+}
+
+// scoreDelimiters splits up to maxLines lines of an input on each of
+// candidates, and returns their scores best first.
+func scoreDelimiters(input FileInput, candidates []rune, maxLines int) ([]DelimiterScore, error) {
+	file, err := openInput(input)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Sample whole lines so that no candidate sees a truncated last line
+	var sample strings.Builder
+	reader := bufio.NewReader(file)
+	for lines := 0; lines < maxLines; lines++ {
+		line, err := reader.ReadString('\n')
+		sample.WriteString(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scores := make([]DelimiterScore, len(candidates))
+	for i, delimiter := range candidates {
+		scores[i] = scoreDelimiter(sample.String(), delimiter)
+	}
+	sort.SliceStable(scores, func(a, b int) bool {
+		sa, sb := scores[a], scores[b]
+		if (sa.Fields > 1) != (sb.Fields > 1) {
+			return sa.Fields > 1
+		}
+		if sa.Share != sb.Share {
+			return sa.Share > sb.Share
+		}
+		return sa.Fields > sb.Fields
+	})
+	return scores, nil
+}
+
+// scoreDelimiter counts the fields of each record of sample split on delimiter.
+func scoreDelimiter(sample string, delimiter rune) DelimiterScore {
+	score := DelimiterScore{Delimiter: delimiter, FieldCounts: make(map[int]int)}
+
+	reader := csv.NewReader(strings.NewReader(sample))
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			// Stop at the end of the sample, or where it no longer parses
+			break
+		}
+		score.FieldCounts[len(record)]++
+		score.Lines++
+	}
+
+	for fields, lines := range score.FieldCounts {
+		modal := score.FieldCounts[score.Fields]
+		if lines > modal || (lines == modal && fields > score.Fields) {
+			score.Fields = fields
+		}
+	}
+	if score.Lines > 0 {
+		score.Share = float64(score.FieldCounts[score.Fields]) / float64(score.Lines)
+	}
+	return score
+}
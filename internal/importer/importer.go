@@ -3,11 +3,11 @@ package importer
 import (
 	"context"
 	"database/sql"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"runtime"
 	"runtime/trace"
 	"strings"
 	"sync"
@@ -20,6 +20,26 @@ import (
 type Result struct {
 	TableName string
 	RowCount  int
+	// Name the table's previous version was kept under ("" = none)
+	VersionedAs string
+	// Rows an earlier run of a resumed import had already committed; RowCount
+	// does not include them
+	ResumedAfter int
+	// Columns dropped because every value was empty (see FileInput.DropEmptyCols)
+	DroppedColumns []string
+	// Whether the rows were added to an existing table (see FileInput.Append)
+	Appended bool
+	// Time spent creating the table and writing rows to it, creating its
+	// indexes, and on the rest of the import, mostly reading and parsing the
+	// input. Only set by the streaming imports.
+	WriteTime time.Duration
+	IndexTime time.Duration
+	ParseTime time.Duration
+	// Rows with fewer fields than the header, padded with empty values, and
+	// rows with more, whose extra fields were dropped (see
+	// FileInput.ExtraColumns)
+	PaddedRows    int
+	TruncatedRows int
 }
 
 // ParsedFile holds the pre-parsed content of a CSV/TSV file.
@@ -30,71 +50,217 @@ type ParsedFile struct {
 	Headers   []string
 	Rows      [][]string
 	Error     error
+	ValueMaps map[string]map[string]string // Value replacements applied when writing
+	Binary    bool                         // Store values as BLOBs when writing
+	// Keep an existing table under a versioned name instead of dropping it
+	VersionTable bool
+	// Headers as read from the file, recorded in database.ColumnsTable when
+	// writing (nil = not recorded)
+	OriginalHeaders []string
+	// Type of each column, inferred if FileInput.InferTypes is set (nil = TEXT)
+	ColumnTypes []string
+	// Values inserted as NULL when writing
+	NullStrings []string
+	// Rows padded or truncated to the header's width (see Result.PaddedRows)
+	PaddedRows    int
+	TruncatedRows int
+	// Insert into an existing table with the same columns instead of
+	// replacing it
+	Append bool
+	// Rows inserted per transaction (see database.EffectiveBatchSize)
+	BatchSize int
+	// Policy for rows that violate a constraint of the table appended to
+	// (see database.InsertOptions.OnConflict)
+	OnConflict string
 }
 
 // FileInput describes a file to be imported.
 type FileInput struct {
 	FilePath     string
 	TableName    string
-	Delimiter    rune
+	Delimiter    rune // Field delimiter (0 = sniffed from the content, see SniffDelimiter)
 	HasHeader    bool
-	IndexColumns []string // Columns to create indexes on (validated early)
+	IndexColumns []string             // Columns to create indexes on, "a+b" for a composite index (validated early)
+	JSONIndexes  []database.JSONIndex // json_extract expressions to index (columns validated early)
+	Encoding     string               // Source character encoding (default: UTF-8)
+	ColumnCase   string               // Convert column names to "lower" or "upper" case (default: as is)
+	// Literal multi-character field separator (e.g. "::") used instead of
+	// CSV parsing with Delimiter. Quoting is not supported.
+	MultiDelimiter string
+	// Literal record separator (e.g. "\x1e") used instead of newlines. Fields
+	// are then split on MultiDelimiter, or on Delimiter if it is not set.
+	RecordSeparator string
+	HeaderOnly      bool // Create the table from the header without importing any rows
+	// Value replacements applied on insert, keyed by column name and then by
+	// original value. Columns the file does not have are ignored.
+	ValueMaps map[string]map[string]string
+	// Shell command whose stdout is imported instead of reading FilePath.
+	// FilePath is then only used to label progress and errors.
+	Command string
+	// How to handle rows with more fields than the header: ExtraColumnsError,
+	// ExtraColumnsIgnore or ExtraColumnsCapture. By default they are handled
+	// as ExtraColumnsIgnore, or as ExtraColumnsError if StrictColumns is set.
+	ExtraColumns string
+	// Fail on rows with fewer fields than the header instead of padding them
+	// with empty values, and on rows with more unless ExtraColumns is set.
+	StrictColumns bool
+	// Store values as BLOBs so that bytes that are not valid UTF-8 survive a
+	// round trip (see exporter.Options.BinaryEncoding)
+	BinarySafe bool
+	// Rename an existing table to <table>_<timestamp> instead of dropping it
+	// (see database.VersionTable)
+	VersionTable bool
+	// Collapse runs of whitespace within values to a single space
+	SqueezeSpaces bool
+	// Only import rows whose line is in this range (default: every row)
+	LineRange LineRange
+	// Record the unsanitized headers in database.ColumnsTable
+	PreserveHeaders bool
+	// Record a database.Checkpoint with every batch, and if an earlier run
+	// left one for the table, keep its rows and continue after them. The
+	// file must list its rows in the same order on every run.
+	Resume bool
+	// Drop the columns in which every imported value is empty, such as those
+	// created by trailing delimiters. Index columns are kept.
+	DropEmptyCols bool
+	// RowTransform, if set, is called with the table's headers and each row,
+	// with one value per header, before it is inserted, and returns the row
+	// to insert and whether to keep it. A kept row must have one value per
+	// header, or the import fails. Rows it drops are not counted as
+	// imported. It is only applied by the streaming imports (Import and
+	// ImportConcurrent), and must be safe for concurrent use if it is shared
+	// by several inputs.
+	RowTransform func(headers []string, row []string) ([]string, bool)
+	// InferTypes, if positive, is the number of rows sampled to infer whether
+	// each column is INTEGER, REAL or TEXT (see InferColumnTypes), instead of
+	// creating every column as TEXT. A column with a later value that does
+	// not fit its inferred type is converted to TEXT after the import.
+	InferTypes int
+	// NullStrings are values, such as "NULL", "\N" or "NA", imported as SQL
+	// NULL instead of as text (default: none, every value is kept).
+	NullStrings []string
+	// Append the rows to an existing table of the same name instead of
+	// replacing it. The table must have the same columns as the input, in any
+	// order (see database.MatchColumns); if there is none it is created.
+	Append bool
+	// BatchSize is the number of rows inserted per transaction (default:
+	// database.BatchSize). It is reduced for wide tables, see
+	// database.EffectiveBatchSize.
+	BatchSize int
+	// SkipLines is the number of raw lines, such as a title or export
+	// metadata, skipped before the header is read.
+	SkipLines int
+	// CommentChar, if set, skips the lines whose first non-space rune it is,
+	// wherever they occur. A line continuing a quoted field is not a comment.
+	// Skipped lines still count in line numbers.
+	CommentChar rune
+	// ColumnNames, if set, name the table's columns instead of the header
+	// row, which is still consumed if HasHeader is set, or the generated
+	// col1, col2, ... The first row must have one field per name.
+	ColumnNames []string
+	// UniqueIndexes are columns to create UNIQUE indexes on, given like
+	// IndexColumns. Rows that share a value fail the import (see
+	// database.CreateUniqueIndex).
+	UniqueIndexes []string
+	// FailOnTypeMismatch fails the import on the first value that does not
+	// fit the type of its column, inferred (see InferTypes) or that of the
+	// table appended to, instead of converting the column to TEXT.
+	FailOnTypeMismatch bool
+	// OnConflict is the policy for rows that violate a PRIMARY KEY or UNIQUE
+	// constraint of the table appended to, such as a unique index created by
+	// an earlier import: database.ConflictAbort (the default),
+	// database.ConflictIgnore or database.ConflictReplace.
+	OnConflict string
 }
 
 // ParseFile reads and parses a CSV/TSV file into memory.
 // This function is safe to call concurrently.
 // If progressCallback is provided, it will be called periodically with the number of rows read.
+//
+// Deprecated: ParseFile holds every row in memory, several times the size of
+// the file. Use Import or ImportConcurrent, which stream rows into the
+// database a batch at a time.
 func ParseFile(input FileInput, progressCallback ParseProgressCallback) *ParsedFile {
 	result := &ParsedFile{
-		FilePath:  input.FilePath,
-		TableName: input.TableName,
+		FilePath:     input.FilePath,
+		TableName:    input.TableName,
+		ValueMaps:    input.ValueMaps,
+		Binary:       input.BinarySafe,
+		VersionTable: input.VersionTable,
+		NullStrings:  input.NullStrings,
+		Append:       input.Append,
+		BatchSize:    input.BatchSize,
+		OnConflict:   input.OnConflict,
 	}
 
-	file, err := OpenFile(input.FilePath)
+	file, err := openInput(input)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to open file: %w", err)
 		return result
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.Comma = input.Delimiter
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
+	source, err := sniffInput(file, &input)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read file: %w", err)
+		return result
+	}
+	reader := newRecordReader(source, input)
 
 	// Read header row if present
-	if input.HasHeader {
-		headerRow, err := reader.Read()
-		if err != nil {
-			result.Error = fmt.Errorf("failed to read header: %w", err)
-			return result
-		}
-		result.Headers = headerRow
-	} else {
-		firstRow, err := reader.Read()
-		if err != nil {
-			result.Error = fmt.Errorf("failed to read first row: %w", err)
-			return result
-		}
-		result.Headers = make([]string, len(firstRow))
-		for i := range result.Headers {
-			result.Headers[i] = fmt.Sprintf("col%d", i+1)
-		}
+	headers, firstRow, err := readHeader(reader, input)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.Headers = headers
+	// File line of each row, for type mismatches
+	var lines []int
+	// Skipped lines may precede the first row
+	if line, _ := reader.FieldPos(0); firstRow != nil && !input.HeaderOnly && !input.LineRange.before(line) {
 		result.Rows = append(result.Rows, firstRow)
+		lines = append(lines, line)
+	}
+	width := len(result.Headers)
+	if input.PreserveHeaders && input.HasHeader {
+		result.OriginalHeaders = result.Headers
+	}
+	result.Headers, err = extraColumnHeaders(normalizeHeaders(result.Headers, input), input)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	if input.HeaderOnly {
+		return result
 	}
 
 	// Read all remaining rows
 	rowCount := int64(0)
+	var ragged raggedRows
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			result.Error = fmt.Errorf("failed to read row: %w", err)
+			result.Error = readError(err)
+			return result
+		}
+		line, _ := reader.FieldPos(0)
+		if input.LineRange.before(line) {
+			continue
+		}
+		if input.LineRange.after(line) {
+			break
+		}
+		record, err = fitRecord(record, width, line, input, &ragged)
+		if err != nil {
+			result.Error = err
 			return result
 		}
 		result.Rows = append(result.Rows, record)
+		lines = append(lines, line)
 		rowCount++
 
 		// Report progress every 1000 rows
@@ -103,37 +269,82 @@ func ParseFile(input FileInput, progressCallback ParseProgressCallback) *ParsedF
 		}
 	}
 
+	result.PaddedRows, result.TruncatedRows = ragged.padded, ragged.truncated
+
 	// Final progress update
 	if progressCallback != nil {
 		progressCallback(input.FilePath, rowCount)
 	}
 
+	// Every row is at hand, so values after the sample are checked up front
+	if input.InferTypes > 0 {
+		result.ColumnTypes = InferColumnTypes(result.Rows[:min(len(result.Rows), input.InferTypes)], len(result.Headers), input.NullStrings)
+		if input.FailOnTypeMismatch {
+			result.Error = typeMismatch(result.Rows, lines, result.Headers, result.ColumnTypes, input.NullStrings)
+			return result
+		}
+		mismatched := make(map[int]bool)
+		mismatchedColumns(result.Rows, result.ColumnTypes, input.NullStrings, mismatched)
+		for i := range mismatched {
+			result.ColumnTypes[i] = database.TypeText
+		}
+	}
+
 	return result
 }
 
 // WriteToDatabase writes a parsed file to the database.
-// This function is safe to call concurrently for different tables when WAL mode is enabled.
+//
+// Deprecated: see ParseFile.
+// This function is safe to call concurrently for different tables when the database is in WAL mode (the default, see database.Options.JournalMode).
 // If progressCallback is provided, it will be called after each batch is written.
 func WriteToDatabase(db *sql.DB, parsed *ParsedFile, progressCallback WriteProgressCallback) (*Result, error) {
 	if parsed.Error != nil {
 		return nil, parsed.Error
 	}
 
-	// Create table
-	if err := database.CreateTable(db, parsed.TableName, parsed.Headers); err != nil {
-		return nil, fmt.Errorf("failed to create table: %w", err)
+	// Create table, keeping the previous one if requested, unless the rows
+	// are appended to an existing one
+	columnTypes, appended, err := appendColumnTypes(db, parsed.TableName, parsed.Headers, parsed.Append)
+	if err != nil {
+		return nil, err
+	}
+	var versionedAs string
+	if !appended {
+		columnTypes = parsed.ColumnTypes
+		if parsed.VersionTable {
+			if versionedAs, err = database.VersionTable(db, parsed.TableName, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+		if err := database.CreateTableWithTypes(db, parsed.TableName, parsed.Headers, parsed.ColumnTypes); err != nil {
+			return nil, fmt.Errorf("failed to create table: %w", err)
+		}
+		if parsed.OriginalHeaders != nil {
+			if err := database.SaveOriginalHeaders(db, parsed.TableName, parsed.Headers, parsed.OriginalHeaders); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Insert rows in batches
+	insertOpts := database.InsertOptions{
+		ValueMaps:   parsed.ValueMaps,
+		Binary:      parsed.Binary,
+		ColumnTypes: columnTypes,
+		NullStrings: parsed.NullStrings,
+		OnConflict:  parsed.OnConflict,
+	}
 	rowCount := len(parsed.Rows)
 	rowsWritten := int64(0)
-	for i := 0; i < rowCount; i += database.BatchSize {
-		end := i + database.BatchSize
+	batchSize := database.EffectiveBatchSize(parsed.BatchSize, len(parsed.Headers))
+	for i := 0; i < rowCount; i += batchSize {
+		end := i + batchSize
 		if end > rowCount {
 			end = rowCount
 		}
 		batch := parsed.Rows[i:end]
-		if err := database.InsertBatch(db, parsed.TableName, parsed.Headers, batch); err != nil {
+		if err := database.InsertBatchWithOptions(db, parsed.TableName, parsed.Headers, batch, insertOpts); err != nil {
 			return nil, fmt.Errorf("failed to insert batch: %w", err)
 		}
 		rowsWritten += int64(len(batch))
@@ -145,11 +356,34 @@ func WriteToDatabase(db *sql.DB, parsed *ParsedFile, progressCallback WriteProgr
 	}
 
 	return &Result{
-		TableName: parsed.TableName,
-		RowCount:  rowCount,
+		TableName:     parsed.TableName,
+		RowCount:      rowCount,
+		VersionedAs:   versionedAs,
+		Appended:      appended,
+		PaddedRows:    parsed.PaddedRows,
+		TruncatedRows: parsed.TruncatedRows,
 	}, nil
 }
 
+// appendColumnTypes reports whether rows with headers are appended to an
+// existing table, which is the case if appendRows is set and the table exists,
+// and returns the declared type of each header's column. It fails if the
+// table's columns do not match the headers.
+func appendColumnTypes(db *sql.DB, tableName string, headers []string, appendRows bool) ([]string, bool, error) {
+	if !appendRows {
+		return nil, false, nil
+	}
+	existing, err := database.GetTableColumns(db, tableName)
+	if err != nil || len(existing) == 0 {
+		return nil, false, err
+	}
+	types, err := database.MatchColumns(db, tableName, headers)
+	if err != nil {
+		return nil, false, err
+	}
+	return types, true, nil
+}
+
 // ProgressCallback is called to report progress during concurrent import.
 type ProgressCallback func(event string, filePath, tableName string, details ...interface{})
 
@@ -163,6 +397,7 @@ type WriteProgressCallback func(filePath string, rowsWritten int64)
 // Files are parsed and written in parallel - batches are written as soon as they're parsed.
 // This prevents loading entire files into memory, making it suitable for very large files.
 // Returns results for successful imports and a combined error for any failures.
+// db must allow concurrent writers; see the package documentation.
 // If progressCallback is provided, it will be called with progress events:
 //   - "parse_start": when parsing starts for a file
 //   - "parse_complete": when parsing completes (details[0] = rowCount, details[1] = duration)
@@ -172,14 +407,27 @@ type WriteProgressCallback func(filePath string, rowsWritten int64)
 //
 // If parseProgressCallback is provided, it will be called periodically during parsing.
 // If writeProgressCallback is provided, it will be called after each batch is written.
+//
+// At most runtime.NumCPU() files are imported at once; see ImportConcurrentWithLimit.
 func ImportConcurrent(db *sql.DB, inputs []FileInput, debug bool, progressCallback ProgressCallback, parseProgressCallback ParseProgressCallback, writeProgressCallback WriteProgressCallback) ([]*Result, error) {
+	return ImportConcurrentWithLimit(db, inputs, 0, debug, progressCallback, parseProgressCallback, writeProgressCallback)
+}
+
+// ImportConcurrentWithLimit imports files like ImportConcurrent, but opens
+// and imports at most limit files at a time (0 = runtime.NumCPU()). The other
+// files wait for a slot, so importing thousands of files does not run out of
+// file descriptors.
+func ImportConcurrentWithLimit(db *sql.DB, inputs []FileInput, limit int, debug bool, progressCallback ProgressCallback, parseProgressCallback ParseProgressCallback, writeProgressCallback WriteProgressCallback) ([]*Result, error) {
 	if len(inputs) == 0 {
 		return nil, nil
 	}
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
 
 	startTime := time.Now()
 	if debug {
-		log.Printf("[STREAMING] Starting streaming import of %d files", len(inputs))
+		log.Printf("[STREAMING] Starting streaming import of %d files, %d at a time", len(inputs), limit)
 	}
 
 	// Create a trace region for concurrent import
@@ -190,12 +438,15 @@ func ImportConcurrent(db *sql.DB, inputs []FileInput, debug bool, progressCallba
 	var errs []error
 	var resultsMu sync.Mutex
 	var importWg sync.WaitGroup
+	slots := make(chan struct{}, limit)
 
 	// Process each file concurrently - parse and write in streaming fashion
 	for _, input := range inputs {
+		slots <- struct{}{}
 		importWg.Add(1)
 		go func(inp FileInput) {
 			defer importWg.Done()
+			defer func() { <-slots }()
 
 			trace.WithRegion(ctx, fmt.Sprintf("import_file_%s", inp.FilePath), func() {
 				if progressCallback != nil {
@@ -244,45 +495,47 @@ func ImportConcurrent(db *sql.DB, inputs []FileInput, debug bool, progressCallba
 
 // importFileStreaming streams a file: parses in batches and writes immediately.
 // This keeps memory usage low - only one batch is in memory at a time.
-func importFileStreaming(db *sql.DB, input FileInput, progressCallback ProgressCallback, parseProgressCallback ParseProgressCallback, writeProgressCallback WriteProgressCallback, _ bool, _ context.Context) (*Result, error) {
-	file, err := OpenFile(input.FilePath)
+func importFileStreaming(db *sql.DB, input FileInput, progressCallback ProgressCallback, parseProgressCallback ParseProgressCallback, writeProgressCallback WriteProgressCallback, debug bool, _ context.Context) (*Result, error) {
+	start := time.Now()
+	file, err := openInput(input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.Comma = input.Delimiter
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
+	source, err := sniffInput(file, &input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	reader := newRecordReader(source, input)
 
-	// Read header row
-	var headers []string
-	if input.HasHeader {
-		headerRow, err := reader.Read()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read header: %w", err)
-		}
-		headers = headerRow
-	} else {
-		firstRow, err := reader.Read()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read first row: %w", err)
-		}
-		headers = make([]string, len(firstRow))
-		for i := range headers {
-			headers[i] = fmt.Sprintf("col%d", i+1)
-		}
+	headers, firstRow, err := readHeader(reader, input)
+	if err != nil {
+		return nil, err
+	}
+	firstLine, _ := reader.FieldPos(0)
+	width := len(headers)
+	originalHeaders := headers
+	headers, err = extraColumnHeaders(normalizeHeaders(headers, input), input)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate index columns exist in headers (fail early)
-	if len(input.IndexColumns) > 0 {
+	var indexColumns []string
+	for _, entry := range append(append([]string{}, input.IndexColumns...), input.UniqueIndexes...) {
+		indexColumns = append(indexColumns, database.SplitIndexColumns(entry)...)
+	}
+	for _, index := range input.JSONIndexes {
+		indexColumns = append(indexColumns, index.Column)
+	}
+	if len(indexColumns) > 0 {
 		headerSet := make(map[string]bool)
 		for _, h := range headers {
 			headerSet[strings.ToLower(database.SanitizeColumnName(h))] = true
 		}
 		var missing []string
-		for _, col := range input.IndexColumns {
+		for _, col := range indexColumns {
 			sanitized := database.SanitizeColumnName(col)
 			if !headerSet[strings.ToLower(sanitized)] {
 				missing = append(missing, col)
@@ -293,9 +546,66 @@ func importFileStreaming(db *sql.DB, input FileInput, progressCallback ProgressC
 		}
 	}
 
-	// Create table first
-	if err := database.CreateTable(db, input.TableName, headers); err != nil {
-		return nil, fmt.Errorf("failed to create table: %w", err)
+	// A resumed import keeps the rows an earlier run committed
+	var checkpoint *database.Checkpoint
+	if input.Resume {
+		if checkpoint, err = database.LoadCheckpoint(db, input.TableName); err != nil {
+			return nil, err
+		}
+		if checkpoint != nil && checkpoint.Source != input.FilePath {
+			return nil, fmt.Errorf("cannot resume table %s from %s: it was imported from %s (import without resuming to start over)", input.TableName, input.FilePath, checkpoint.Source)
+		}
+	}
+
+	// Rows appended to an existing table are inserted as its columns' types
+	var columnTypes []string
+	var appended bool
+	if checkpoint == nil {
+		if columnTypes, appended, err = appendColumnTypes(db, input.TableName, headers, input.Append); err != nil {
+			return nil, err
+		}
+	}
+
+	// createTable creates the table, keeping the previous one if requested
+	var versionedAs string
+	var writeTime time.Duration
+	tableCreated := checkpoint != nil || appended
+	createTable := func() error {
+		createStart := time.Now()
+		defer func() { writeTime += time.Since(createStart) }()
+		if input.VersionTable {
+			var err error
+			if versionedAs, err = database.VersionTable(db, input.TableName, time.Now()); err != nil {
+				return err
+			}
+		}
+		if err := database.CreateTableWithTypes(db, input.TableName, headers, columnTypes); err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+		if input.PreserveHeaders && input.HasHeader {
+			if err := database.SaveOriginalHeaders(db, input.TableName, headers, originalHeaders); err != nil {
+				return err
+			}
+		}
+		tableCreated = true
+
+		if input.Resume {
+			return database.SaveCheckpoint(db, database.Checkpoint{Table: input.TableName, Source: input.FilePath})
+		}
+		return database.ClearCheckpoint(db, input.TableName)
+	}
+
+	// Create table first, unless its column types are inferred from the first
+	// rows; it is then created when they have been read
+	inferTypes := input.InferTypes > 0 && !tableCreated
+	if !tableCreated && !inferTypes {
+		if err := createTable(); err != nil {
+			return nil, err
+		}
+	}
+	resumeAfter := 0
+	if checkpoint != nil {
+		resumeAfter = int(checkpoint.Rows)
 	}
 
 	if progressCallback != nil {
@@ -303,30 +613,123 @@ func importFileStreaming(db *sql.DB, input FileInput, progressCallback ProgressC
 	}
 
 	// Stream: read batches and write immediately
-	batch := make([][]string, 0, database.BatchSize)
+	insertOpts := database.InsertOptions{ValueMaps: input.ValueMaps, Binary: input.BinarySafe, ColumnTypes: columnTypes, NullStrings: input.NullStrings, OnConflict: input.OnConflict}
+	batchSize := database.EffectiveBatchSize(input.BatchSize, len(headers))
+	if debug {
+		log.Printf("[STREAMING] Inserting %s in batches of %d rows (%d columns)", input.FilePath, batchSize, len(headers))
+	}
+	batch := make([][]string, 0, batchSize)
+	var batchLines []int // File line of each row in batch, for type mismatches
 	rowCount := 0
 	rowsWritten := int64(0)
 
-	for {
+	// keepRow adds a row to the batch unless the input's RowTransform drops
+	// it. The transform is given short rows padded to the header's width,
+	// and must return one value per header.
+	skippedRows := 0
+	keepRow := func(row []string, line int) error {
+		if input.RowTransform != nil {
+			if len(row) < len(headers) {
+				row = append(row, make([]string, len(headers)-len(row))...)
+			}
+			var keep bool
+			if row, keep = input.RowTransform(headers, row); !keep {
+				skippedRows++
+				return nil
+			}
+			if len(row) != len(headers) {
+				return fmt.Errorf("row transform of %s at line %d returned %d values, but the table has %d columns", input.FilePath, line, len(row), len(headers))
+			}
+		}
+		batch = append(batch, row)
+		batchLines = append(batchLines, line)
+		return nil
+	}
+
+	// Without a header, the row the column count was taken from is data
+	if firstRow != nil && !input.HeaderOnly && !input.LineRange.before(firstLine) {
+		rowCount++
+		if rowCount > resumeAfter {
+			if err := keepRow(firstRow, firstLine); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// prepareBatch creates the table once the rows its column types are
+	// inferred from have been read, and checks the batch against the types
+	mismatched := make(map[int]bool)
+	prepareBatch := func() error {
+		if !tableCreated {
+			columnTypes = InferColumnTypes(batch[:min(len(batch), input.InferTypes)], len(headers), input.NullStrings)
+			insertOpts.ColumnTypes = columnTypes
+			if err := createTable(); err != nil {
+				return err
+			}
+		}
+		if input.FailOnTypeMismatch && columnTypes != nil {
+			if err := typeMismatch(batch, batchLines, headers, columnTypes, input.NullStrings); err != nil {
+				return err
+			}
+		} else if inferTypes {
+			mismatchedColumns(batch, columnTypes, input.NullStrings, mismatched)
+		}
+		return nil
+	}
+
+	// insertBatch writes the batch, checkpointing the rows read so far
+	insertBatch := func() error {
+		if input.Resume {
+			insertOpts.Checkpoint = &database.Checkpoint{Table: input.TableName, Source: input.FilePath, Rows: int64(rowCount)}
+		}
+		insertStart := time.Now()
+		err := database.InsertBatchWithOptions(db, input.TableName, headers, batch, insertOpts)
+		writeTime += time.Since(insertStart)
+		return err
+	}
+
+	// Header-only imports create the table (and indexes) without reading any rows
+	var ragged raggedRows
+	for !input.HeaderOnly {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to read row: %w", err)
+			return nil, readError(err)
+		}
+		line, _ := reader.FieldPos(0)
+		if input.LineRange.before(line) {
+			continue
+		}
+		if input.LineRange.after(line) {
+			break
+		}
+		record, err = fitRecord(record, width, line, input, &ragged)
+		if err != nil {
+			return nil, err
 		}
 
-		batch = append(batch, record)
+		// Rows committed by an earlier run are read but not inserted again
 		rowCount++
+		if rowCount > resumeAfter {
+			if err := keepRow(record, line); err != nil {
+				return nil, err
+			}
+		}
 
 		// Report parse progress
 		if parseProgressCallback != nil && rowCount%1000 == 0 {
 			parseProgressCallback(input.FilePath, int64(rowCount))
 		}
 
-		// When batch is full, write it immediately
-		if len(batch) >= database.BatchSize {
-			if err := database.InsertBatch(db, input.TableName, headers, batch); err != nil {
+		// When batch is full, write it immediately (once it holds the rows
+		// column types are inferred from)
+		if len(batch) >= batchSize && (tableCreated || len(batch) >= input.InferTypes) {
+			if err := prepareBatch(); err != nil {
+				return nil, err
+			}
+			if err := insertBatch(); err != nil {
 				return nil, fmt.Errorf("failed to insert batch: %w", err)
 			}
 			rowsWritten += int64(len(batch))
@@ -337,12 +740,16 @@ func importFileStreaming(db *sql.DB, input FileInput, progressCallback ProgressC
 
 			// Clear batch for next iteration
 			batch = batch[:0]
+			batchLines = batchLines[:0]
 		}
 	}
 
 	// Write remaining rows in final batch
 	if len(batch) > 0 {
-		if err := database.InsertBatch(db, input.TableName, headers, batch); err != nil {
+		if err := prepareBatch(); err != nil {
+			return nil, err
+		}
+		if err := insertBatch(); err != nil {
 			return nil, fmt.Errorf("failed to insert final batch: %w", err)
 		}
 		rowsWritten += int64(len(batch))
@@ -351,41 +758,170 @@ func importFileStreaming(db *sql.DB, input FileInput, progressCallback ProgressC
 			writeProgressCallback(input.FilePath, rowsWritten)
 		}
 	}
+	if !tableCreated {
+		if err := createTable(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Columns with values after the sampled rows that do not fit their
+	// inferred type fall back to TEXT
+	alterStart := time.Now()
+	if len(mismatched) > 0 {
+		var columns []string
+		for i := range headers {
+			if mismatched[i] {
+				columns = append(columns, headers[i])
+			}
+		}
+		if err := database.ConvertColumnsToText(db, input.TableName, columns); err != nil {
+			return nil, err
+		}
+	}
+
+	// Drop empty columns before indexing; SQLite cannot drop indexed columns
+	var dropped []string
+	if input.DropEmptyCols {
+		var keep []string
+		for _, entry := range append(append([]string{}, input.IndexColumns...), input.UniqueIndexes...) {
+			keep = append(keep, database.SplitIndexColumns(entry)...)
+		}
+		for _, index := range input.JSONIndexes {
+			keep = append(keep, index.Column)
+		}
+		if dropped, err = database.DropEmptyColumns(db, input.TableName, keep); err != nil {
+			return nil, err
+		}
+	}
+	writeTime += time.Since(alterStart)
 
 	// Create indexes after all data is written
-	if len(input.IndexColumns) > 0 {
+	var indexDuration time.Duration
+	if len(input.IndexColumns) > 0 || len(input.UniqueIndexes) > 0 || len(input.JSONIndexes) > 0 {
+		indexes := append([]string{}, input.IndexColumns...)
+		for _, entry := range input.UniqueIndexes {
+			indexes = append(indexes, "UNIQUE "+entry)
+		}
+		for _, index := range input.JSONIndexes {
+			indexes = append(indexes, index.String())
+		}
 		if progressCallback != nil {
-			progressCallback("index_start", input.FilePath, input.TableName, input.IndexColumns)
+			progressCallback("index_start", input.FilePath, input.TableName, indexes)
 		}
 		indexStart := time.Now()
 
-		if err := database.CreateIndexes(db, input.TableName, input.IndexColumns); err != nil {
+		err := database.CreateIndexes(db, input.TableName, input.IndexColumns)
+		for _, entry := range input.UniqueIndexes {
+			if err != nil {
+				break
+			}
+			err = database.CreateUniqueIndex(db, input.TableName, database.SplitIndexColumns(entry))
+		}
+		for _, index := range input.JSONIndexes {
+			if err != nil {
+				break
+			}
+			err = database.CreateJSONIndex(db, input.TableName, index)
+		}
+		if err != nil {
 			if progressCallback != nil {
 				progressCallback("index_error", input.FilePath, input.TableName, err)
 			}
 			return nil, fmt.Errorf("failed to create indexes: %w", err)
 		}
 
-		indexDuration := time.Since(indexStart)
+		indexDuration = time.Since(indexStart)
 		if progressCallback != nil {
-			progressCallback("index_complete", input.FilePath, input.TableName, len(input.IndexColumns), indexDuration)
+			progressCallback("index_complete", input.FilePath, input.TableName, len(indexes), indexDuration)
 		}
 	}
 
 	return &Result{
-		TableName: input.TableName,
-		RowCount:  rowCount,
+		TableName:      input.TableName,
+		RowCount:       rowCount - min(rowCount, resumeAfter) - skippedRows,
+		VersionedAs:    versionedAs,
+		ResumedAfter:   resumeAfter,
+		DroppedColumns: dropped,
+		Appended:       appended,
+		WriteTime:      writeTime,
+		IndexTime:      indexDuration,
+		ParseTime:      time.Since(start) - writeTime - indexDuration,
+		PaddedRows:     ragged.padded,
+		TruncatedRows:  ragged.truncated,
 	}, nil
 }
 
+// readHeader reads the header row of an input, or for an input without one,
+// its first row, returned with the generated headers col1, col2, ... Either
+// is replaced by input.ColumnNames if they are set.
+func readHeader(reader recordReader, input FileInput) (headers, firstRow []string, err error) {
+	if input.HasHeader {
+		headers, err = reader.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read header: %w", err)
+		}
+	} else {
+		firstRow, err = reader.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read first row: %w", err)
+		}
+		headers = make([]string, len(firstRow))
+		for i := range headers {
+			headers[i] = fmt.Sprintf("col%d", i+1)
+		}
+	}
+
+	if input.ColumnNames != nil {
+		if len(input.ColumnNames) != len(headers) {
+			return nil, nil, fmt.Errorf("%d column names given, but the first row has %d fields", len(input.ColumnNames), len(headers))
+		}
+		headers = input.ColumnNames
+	}
+	return headers, firstRow, nil
+}
+
+// ReadHeaders returns the headers an import of input would create its table
+// with, reading only the first row. A command input is run to read it.
+func ReadHeaders(input FileInput) ([]string, error) {
+	file, err := openInput(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	source, err := sniffInput(file, &input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	headers, _, err := readHeader(newRecordReader(source, input), input)
+	if err != nil {
+		return nil, err
+	}
+	return extraColumnHeaders(normalizeHeaders(headers, input), input)
+}
+
+// normalizeHeaders applies column name options to the headers read from a file
+// and renames repeated columns. The result is used for both table creation and
+// inserts so they always agree.
+func normalizeHeaders(headers []string, input FileInput) []string {
+	if input.ColumnCase == "" {
+		return database.DedupeHeaders(headers)
+	}
+	normalized := make([]string, len(headers))
+	for i, h := range headers {
+		normalized[i] = database.ApplyColumnCase(database.SanitizeColumnName(h), input.ColumnCase)
+	}
+	return database.DedupeHeaders(normalized)
+}
+
 // Import imports a CSV/TSV file into a SQLite table.
-// Returns the number of rows imported.
+// Returns the number of rows imported. Rows are streamed into the table a
+// batch at a time, so memory use does not grow with the size of the file.
 func Import(db *sql.DB, filePath, tableName string, delimiter rune, hasHeader bool) (*Result, error) {
-	parsed := ParseFile(FileInput{
+	return importFileStreaming(db, FileInput{
 		FilePath:  filePath,
 		TableName: tableName,
 		Delimiter: delimiter,
 		HasHeader: hasHeader,
-	}, nil)
-	return WriteToDatabase(db, parsed, nil)
+	}, nil, nil, nil, false, context.Background())
 }
@@ -1,9 +1,26 @@
 package importer
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/text/encoding/unicode"
 
 	"github.com/yatisql/yatisql-go/internal/database"
 )
@@ -20,8 +37,12 @@ func TestDetectDelimiter(t *testing.T) {
 		{"tsv.gz file", "data.tsv.gz", '\t'},
 		{"csv.bz2 file", "data.csv.bz2", ','},
 		{"tsv.bz2 file", "data.tsv.bz2", '\t'},
+		{"tsv.lz4 file", "data.tsv.lz4", '\t'},
+		{"tsv.xz file", "data.tsv.xz", '\t'},
 		{"no extension", "data", ','},
 		{"unknown extension", "data.txt", ','},
+		{"tsv url with query", "https://example.com/data.tsv?dl=1", '\t'},
+		{"tsv.gz url", "http://example.com/export/data.tsv.gz#top", '\t'},
 	}
 
 	for _, tt := range tests {
@@ -311,6 +332,44 @@ func TestImportWithIndexColumns(t *testing.T) {
 	}
 }
 
+func TestImportWithCompositeIndex(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	inputs := []FileInput{{FilePath: csvPath, TableName: "test", Delimiter: ',', HasHeader: true, IndexColumns: []string{"id", "city+age"}}}
+	if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+
+	// One index on id and one on city and age, in that order
+	var indexCount int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='index' AND tbl_name='test'").Scan(&indexCount); err != nil {
+		t.Fatalf("Query index error = %v", err)
+	}
+	if indexCount != 2 {
+		t.Errorf("Expected 2 indexes, got %d", indexCount)
+	}
+	var columns string
+	if err := db.DB.QueryRow("SELECT group_concat(name, ',') FROM (SELECT name FROM pragma_index_info('idx_test_city_age') ORDER BY seqno)").Scan(&columns); err != nil {
+		t.Fatalf("Query index columns error = %v", err)
+	}
+	if columns != "city,age" {
+		t.Errorf("idx_test_city_age columns = %s, want city,age", columns)
+	}
+
+	// Every column of a group must exist
+	inputs[0].IndexColumns = []string{"city+missing"}
+	if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("ImportConcurrent() with a missing composite column error = %v, want it named", err)
+	}
+}
+
 func TestImportWithInvalidIndexColumn(t *testing.T) {
 	testdataPath := findTestdata(t)
 	csvPath := filepath.Join(testdataPath, "sample.csv")
@@ -337,21 +396,1864 @@ func TestImportWithInvalidIndexColumn(t *testing.T) {
 	}
 }
 
-// findTestdata locates the testdata directory relative to the test file.
-func findTestdata(t *testing.T) string {
-	// Try different relative paths
-	paths := []string{
-		"../../testdata",
-		"../../../testdata",
-		"testdata",
+func TestImportConcurrentMixedEncodings(t *testing.T) {
+	tmpDir := t.TempDir()
+	utf8Path := filepath.Join(tmpDir, "utf8.csv")
+	latin1Path := filepath.Join(tmpDir, "latin1.csv")
+
+	if err := os.WriteFile(utf8Path, []byte("id,city\n1,Zürich\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	// "Zürich" with ü encoded as the single latin1 byte 0xFC
+	if err := os.WriteFile(latin1Path, []byte("id,city\n1,Z\xfcrich\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
 	}
 
-	for _, p := range paths {
-		if _, err := os.Stat(p); err == nil {
-			return p
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	inputs := []FileInput{
+		{FilePath: utf8Path, TableName: "a", Delimiter: ',', HasHeader: true, Encoding: "utf-8"},
+		{FilePath: latin1Path, TableName: "b", Delimiter: ',', HasHeader: true, Encoding: "latin1"},
+	}
+
+	if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+
+	for _, table := range []string{"a", "b"} {
+		var city string
+		if err := db.DB.QueryRow("SELECT city FROM " + table).Scan(&city); err != nil {
+			t.Fatalf("Query %s error = %v", table, err)
+		}
+		if city != "Zürich" {
+			t.Errorf("table %s city = %q, want %q", table, city, "Zürich")
 		}
 	}
+}
 
-	t.Skip("testdata directory not found")
-	return ""
+func TestImportUTF16ByteOrderMark(t *testing.T) {
+	tmpDir := t.TempDir()
+	// Excel "Unicode text" exports are tab-separated UTF-16LE with a BOM
+	content := "id\tcity\r\n1\tZürich\r\n2\t東京\r\n"
+	for name, endianness := range map[string]unicode.Endianness{"le": unicode.LittleEndian, "be": unicode.BigEndian} {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := unicode.UTF16(endianness, unicode.UseBOM).NewEncoder().String(content)
+			if err != nil {
+				t.Fatalf("encoding error = %v", err)
+			}
+			path := filepath.Join(tmpDir, name+".tsv")
+			if err := os.WriteFile(path, []byte(encoded), 0o644); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+
+			db, err := database.Open("")
+			if err != nil {
+				t.Fatalf("database.Open() error = %v", err)
+			}
+			defer db.Close()
+
+			// No Encoding: the BOM selects UTF-16
+			input := FileInput{FilePath: path, TableName: "cities", Delimiter: '\t', HasHeader: true}
+			if _, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err != nil {
+				t.Fatalf("ImportConcurrent() error = %v", err)
+			}
+
+			var cities []string
+			rows, err := db.Query("SELECT city FROM cities ORDER BY id")
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var city string
+				rows.Scan(&city)
+				cities = append(cities, city)
+			}
+			if got := strings.Join(cities, ","); got != "Zürich,東京" {
+				t.Errorf("cities = %q, want Zürich,東京", got)
+			}
+		})
+	}
+}
+
+func TestImportUTF8ByteOrderMark(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excel.csv")
+	if err := os.WriteFile(path, []byte("\xEF\xBB\xBFid,city\r\n1,Zürich\r\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	for _, encodingName := range []string{"", "utf-8"} {
+		db, err := database.Open("")
+		if err != nil {
+			t.Fatalf("database.Open() error = %v", err)
+		}
+		defer db.Close()
+
+		input := FileInput{FilePath: path, TableName: "cities", Delimiter: ',', HasHeader: true, Encoding: encodingName}
+		if _, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err != nil {
+			t.Fatalf("ImportConcurrent(encoding %q) error = %v", encodingName, err)
+		}
+		columns, err := database.GetTableColumns(db.DB, "cities")
+		if err != nil {
+			t.Fatalf("GetTableColumns() error = %v", err)
+		}
+		if got := strings.Join(columns, ","); got != "id,city" {
+			t.Errorf("encoding %q: columns = %q, want id,city", encodingName, got)
+		}
+	}
+}
+
+func TestOpenFileWithUnknownEncoding(t *testing.T) {
+	if _, err := OpenFileWithEncoding("data.csv", "klingon"); err == nil {
+		t.Error("Expected error for unknown encoding, got nil")
+	}
+}
+
+func TestImportMultiCharacterDelimiter(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "data.txt")
+	content := "id::name::city\n1::Alice::New York\n2::Bob::Los Angeles\n\n3::Charlie::Chicago\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	inputs := []FileInput{
+		{FilePath: tmpFile, TableName: "test", HasHeader: true, MultiDelimiter: "::"},
+	}
+	results, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if results[0].RowCount != 3 {
+		t.Errorf("RowCount = %d, want 3", results[0].RowCount)
+	}
+
+	var city string
+	if err := db.DB.QueryRow("SELECT city FROM test WHERE name = 'Bob'").Scan(&city); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if city != "Los Angeles" {
+		t.Errorf("city = %q, want %q", city, "Los Angeles")
+	}
+}
+
+func TestImportRecordSeparator(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "data.asv")
+	// ASCII-separated values: fields end at US (0x1f), records at RS (0x1e);
+	// newlines and commas are ordinary characters
+	content := "id\x1fname\x1fnote\x1e1\x1fAlice\x1fline one\nline two\x1e\n2\x1fBob, Jr.\x1f\x1e\x1e3\x1fCharlie\x1f\"quoted\"\x1e\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	inputs := []FileInput{
+		{FilePath: tmpFile, TableName: "test", HasHeader: true, MultiDelimiter: "\x1f", RecordSeparator: "\x1e"},
+	}
+	results, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if results[0].RowCount != 3 {
+		t.Errorf("RowCount = %d, want 3", results[0].RowCount)
+	}
+
+	want := map[string][2]string{
+		"1": {"Alice", "line one\nline two"},
+		"2": {"Bob, Jr.", ""},
+		"3": {"Charlie", `"quoted"`},
+	}
+	for id, fields := range want {
+		var name, note string
+		if err := db.DB.QueryRow("SELECT name, note FROM test WHERE id = ?", id).Scan(&name, &note); err != nil {
+			t.Fatalf("QueryRow(%s) error = %v", id, err)
+		}
+		if name != fields[0] || note != fields[1] {
+			t.Errorf("row %s = (%q, %q), want (%q, %q)", id, name, note, fields[0], fields[1])
+		}
+	}
+}
+
+func TestExplainDelimiter(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "notes.txt")
+	content := "id\tname\tnote\n1\tAlice\thello, world\n2\tBob\ta, b, c\n3\tCarol\tplain\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	scores, err := ExplainDelimiter(FileInput{FilePath: tmpFile}, 100)
+	if err != nil {
+		t.Fatalf("ExplainDelimiter() error = %v", err)
+	}
+	if scores[0].Delimiter != '\t' || scores[0].Fields != 3 || scores[0].Share != 1 || scores[0].Lines != 4 {
+		t.Errorf("best score = %+v, want tab splitting all 4 lines into 3 fields", scores[0])
+	}
+	for _, score := range scores {
+		if score.Delimiter == ',' && score.FieldCounts[1] != 2 {
+			t.Errorf("comma field counts = %v, want 2 lines with 1 field", score.FieldCounts)
+		}
+	}
+
+	// Only the first lines are sampled
+	if scores, err = ExplainDelimiter(FileInput{FilePath: tmpFile}, 2); err != nil || scores[0].Lines != 2 {
+		t.Errorf("ExplainDelimiter() with 2 lines = %+v, %v, want 2 lines sampled", scores, err)
+	}
+}
+
+func TestChooseDelimiter(t *testing.T) {
+	// Commas occur in the notes, but only semicolons split every line evenly
+	tmpFile := filepath.Join(t.TempDir(), "notes.csv")
+	content := "id;name;note\n1;Alice;a,b\n2;Bob;plain\n3;Carol;x,y,z\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	score, err := ChooseDelimiter(FileInput{FilePath: tmpFile}, []rune{',', ';', '|', '\t'}, 100)
+	if err != nil {
+		t.Fatalf("ChooseDelimiter() error = %v", err)
+	}
+	if score.Delimiter != ';' || score.Fields != 3 || score.Share != 1 {
+		t.Errorf("ChooseDelimiter() = %+v, want semicolon splitting every line into 3 fields", score)
+	}
+
+	// Only the candidates are tried
+	if score, err = ChooseDelimiter(FileInput{FilePath: tmpFile}, []rune{'|', ','}, 100); err != nil || score.Delimiter == ';' {
+		t.Errorf("ChooseDelimiter() without semicolon = %+v, %v, want another candidate", score, err)
+	}
+}
+
+func TestSniffDelimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    rune
+	}{
+		{"tab", "id\tname\tnote\n1\tAlice\thello, world\n2\tBob\ta, b, c\n", '\t'},
+		{"semicolon", "id;name;note\n1;Alice;a,b\n2;Bob;plain\n3;Carol;x,y,z\n", ';'},
+		{"pipe", "id|name\n1|Alice\n2|Bob\n", '|'},
+		{"quoted delimiters", "id,note\n1,\"a;b;c\"\n2,\"d;e;f\"\n", ','},
+		{"quoted newline", "id|note\n1|\"two\nlines, with, commas\"\n2|plain\n", '|'},
+		{"single column", "name\nAlice\nBob\n", ','},
+		{"empty", "", ','},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SniffDelimiter(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("SniffDelimiter() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("SniffDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportSniffsDelimiter(t *testing.T) {
+	// An extension that does not imply a delimiter is sniffed from the content
+	tmpFile := filepath.Join(t.TempDir(), "export.txt")
+	content := "id;name;city\n1;Alice;New York\n2;Bob;Los Angeles\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if got := ExtensionDelimiter(tmpFile); got != 0 {
+		t.Fatalf("ExtensionDelimiter(%q) = %q, want 0", tmpFile, got)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	result, err := Import(db.DB, tmpFile, "test", 0, true)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.RowCount != 2 {
+		t.Fatalf("RowCount = %d, want 2", result.RowCount)
+	}
+
+	// The sampled lines are still imported
+	var city string
+	if err := db.QueryRow("SELECT city FROM test WHERE id = '1'").Scan(&city); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if city != "New York" {
+		t.Errorf("city = %q, want %q", city, "New York")
+	}
+}
+
+func TestImportURL(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte("id\tname\n1\tAlice\n2\tBob\n"))
+	gz.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/export/people.tsv.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(gzipped.Bytes())
+	}))
+	defer server.Close()
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// The query string does not hide the .tsv.gz extension
+	url := server.URL + "/export/people.tsv.gz?token=abc"
+	result, err := Import(db.DB, url, "people", DetectDelimiter(url), true)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.RowCount != 2 {
+		t.Errorf("RowCount = %d, want 2", result.RowCount)
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM people WHERE id = '2'").Scan(&name); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if name != "Bob" {
+		t.Errorf("name = %q, want %q", name, "Bob")
+	}
+
+	_, err = Import(db.DB, server.URL+"/missing.csv", "missing", ',', true)
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("Import() of a missing URL error = %v, want the 404 status", err)
+	}
+}
+
+func TestImportBatchSize(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	var written []int64
+	writeProgress := func(_ string, rowsWritten int64) {
+		written = append(written, rowsWritten)
+	}
+	command := `printf 'id\n1\n2\n3\n4\n5\n'`
+	inputs := []FileInput{{FilePath: command, TableName: "numbers", Delimiter: ',', HasHeader: true, Command: command, BatchSize: 2}}
+	results, err := ImportConcurrent(db.DB, inputs, false, nil, nil, writeProgress)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if results[0].RowCount != 5 {
+		t.Errorf("RowCount = %d, want 5", results[0].RowCount)
+	}
+	if fmt.Sprint(written) != "[2 4 5]" {
+		t.Errorf("rows written after each batch = %v, want [2 4 5]", written)
+	}
+}
+
+func TestImportLowercaseColumns(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "data.csv")
+	content := "ID,FirstName,Home City\n1,Alice,New York\n2,Bob,Boston\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	inputs := []FileInput{
+		{FilePath: tmpFile, TableName: "test", Delimiter: ',', HasHeader: true, ColumnCase: "lower"},
+	}
+	if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+
+	columns, err := database.GetTableColumns(db.DB, "test")
+	if err != nil {
+		t.Fatalf("GetTableColumns() error = %v", err)
+	}
+	want := []string{"id", "firstname", "home_city"}
+	for i, col := range want {
+		if i >= len(columns) || columns[i] != col {
+			t.Fatalf("columns = %v, want %v", columns, want)
+		}
+	}
+
+	var name string
+	if err := db.DB.QueryRow("SELECT firstname FROM test WHERE home_city = 'Boston'").Scan(&name); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if name != "Bob" {
+		t.Errorf("firstname = %q, want %q", name, "Bob")
+	}
+}
+
+func TestImportDuplicateColumns(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "data.csv")
+	content := "id,id,Name,name\n1,2,Alice,alice\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	input := FileInput{FilePath: tmpFile, TableName: "test", Delimiter: ',', HasHeader: true}
+	for _, streaming := range []bool{true, false} {
+		var err error
+		if streaming {
+			_, err = ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+		} else if parsed := ParseFile(input, nil); parsed.Error != nil {
+			err = parsed.Error
+		} else {
+			_, err = WriteToDatabase(db.DB, parsed, nil)
+		}
+		if err != nil {
+			t.Fatalf("import (streaming %v) error = %v", streaming, err)
+		}
+
+		columns, err := database.GetTableColumns(db.DB, "test")
+		if err != nil {
+			t.Fatalf("GetTableColumns() error = %v", err)
+		}
+		if got, want := strings.Join(columns, ","), "id,id_2,Name,name_2"; got != want {
+			t.Fatalf("columns = %s, want %s", got, want)
+		}
+
+		var id2, name2 string
+		if err := db.DB.QueryRow("SELECT id_2, name_2 FROM test").Scan(&id2, &name2); err != nil {
+			t.Fatalf("QueryRow() error = %v", err)
+		}
+		if id2 != "2" || name2 != "alice" {
+			t.Errorf("id_2, name_2 = %q, %q, want 2, alice", id2, name2)
+		}
+	}
+}
+
+func TestImportColumnNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte("x,y\n1,Alice\n2,Bob\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		hasHeader bool
+		names     []string
+		wantRows  int
+		wantErr   string
+	}{
+		{"replaces header", true, []string{"id", "name"}, 2, ""},
+		{"without header", false, []string{"id", "name"}, 3, ""},
+		{"count mismatch", true, []string{"id"}, 0, "1 column names given, but the first row has 2 fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.Open("")
+			if err != nil {
+				t.Fatalf("database.Open() error = %v", err)
+			}
+			defer db.Close()
+
+			input := FileInput{FilePath: path, TableName: "test", Delimiter: ',', HasHeader: tt.hasHeader, ColumnNames: tt.names}
+			results, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ImportConcurrent() error = %v, want %q", err, tt.wantErr)
+				}
+				if parsed := ParseFile(input, nil); parsed.Error == nil || !strings.Contains(parsed.Error.Error(), tt.wantErr) {
+					t.Errorf("ParseFile() error = %v, want %q", parsed.Error, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportConcurrent() error = %v", err)
+			}
+			if results[0].RowCount != tt.wantRows {
+				t.Errorf("RowCount = %d, want %d", results[0].RowCount, tt.wantRows)
+			}
+
+			columns, err := database.GetTableColumns(db.DB, "test")
+			if err != nil {
+				t.Fatalf("GetTableColumns() error = %v", err)
+			}
+			if got := strings.Join(columns, ","); got != "id,name" {
+				t.Errorf("columns = %s, want id,name", got)
+			}
+
+			parsed := ParseFile(input, nil)
+			if parsed.Error != nil {
+				t.Fatalf("ParseFile() error = %v", parsed.Error)
+			}
+			if len(parsed.Rows) != tt.wantRows || strings.Join(parsed.Headers, ",") != "id,name" {
+				t.Errorf("ParseFile() = %d rows with headers %v, want %d rows with id,name", len(parsed.Rows), parsed.Headers, tt.wantRows)
+			}
+		})
+	}
+}
+
+// findTestdata locates the testdata directory relative to the test file.
+func findTestdata(t *testing.T) string {
+	// Try different relative paths
+	paths := []string{
+		"../../testdata",
+		"../../../testdata",
+		"testdata",
+	}
+
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+
+	t.Skip("testdata directory not found")
+	return ""
+}
+
+func TestImportWithExternallyOpenedDB(t *testing.T) {
+	testdataPath := findTestdata(t)
+	multiPath := filepath.Join(testdataPath, "multi_file")
+
+	// Open the connection directly with the driver, bypassing database.Open
+	dbPath := filepath.Join(t.TempDir(), "external.db")
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_synchronous=OFF")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	inputs := []FileInput{
+		{FilePath: filepath.Join(multiPath, "users.csv"), TableName: "users", Delimiter: ',', HasHeader: true},
+		{FilePath: filepath.Join(multiPath, "orders.csv"), TableName: "orders", Delimiter: ',', HasHeader: true},
+	}
+	results, err := ImportConcurrent(db, inputs, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if len(results) != len(inputs) {
+		t.Fatalf("Expected %d results, got %d", len(inputs), len(results))
+	}
+
+	if _, err := Import(db, filepath.Join(testdataPath, "sample.csv"), "sample", ',', true); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	parsed := ParseFile(FileInput{FilePath: filepath.Join(testdataPath, "sample.tsv"), TableName: "sample_tsv", Delimiter: '\t', HasHeader: true}, nil)
+	if _, err := WriteToDatabase(db, parsed, nil); err != nil {
+		t.Fatalf("WriteToDatabase() error = %v", err)
+	}
+
+	for _, table := range []string{"users", "orders", "sample", "sample_tsv"} {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		if count == 0 {
+			t.Errorf("Table %s is empty", table)
+		}
+	}
+
+	// The caller's pragmas are left untouched
+	var journalMode string
+	var synchronous int
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		t.Fatalf("Failed to read journal_mode: %v", err)
+	}
+	if err := db.QueryRow("PRAGMA synchronous").Scan(&synchronous); err != nil {
+		t.Fatalf("Failed to read synchronous: %v", err)
+	}
+	if journalMode != "wal" || synchronous != 0 {
+		t.Errorf("journal_mode = %q, synchronous = %d; want wal, 0", journalMode, synchronous)
+	}
+}
+
+func TestImportConcurrentInMemoryDB(t *testing.T) {
+	testdataPath := findTestdata(t)
+	multiPath := filepath.Join(testdataPath, "multi_file")
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	inputs := []FileInput{
+		{FilePath: filepath.Join(multiPath, "users.csv"), TableName: "users", Delimiter: ',', HasHeader: true},
+		{FilePath: filepath.Join(multiPath, "orders.csv"), TableName: "orders", Delimiter: ',', HasHeader: true},
+	}
+	if _, err := ImportConcurrent(db, inputs, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users JOIN orders ON orders.user_id = users.id").Scan(&count); err != nil {
+		t.Fatalf("Join query error = %v", err)
+	}
+	if count == 0 {
+		t.Error("Expected joined rows, got 0")
+	}
+}
+
+func TestImportLZ4AndXZ(t *testing.T) {
+	testdataPath := findTestdata(t)
+	content, err := os.ReadFile(filepath.Join(testdataPath, "sample.tsv"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		ext       string
+		newWriter func(io.Writer) (io.WriteCloser, error)
+	}{
+		{"lz4", ".lz4", func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil }},
+		{"xz", ".xz", func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sample.tsv"+tt.ext)
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			writer, err := tt.newWriter(file)
+			if err != nil {
+				t.Fatalf("Failed to create %s writer: %v", tt.name, err)
+			}
+			if _, err := writer.Write(content); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			file.Close()
+
+			db, err := database.Open("")
+			if err != nil {
+				t.Fatalf("database.Open() error = %v", err)
+			}
+			defer db.Close()
+
+			result, err := Import(db.DB, path, "test", DetectDelimiter(path), true)
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+			if result.RowCount != 10 {
+				t.Errorf("RowCount = %d, want 10", result.RowCount)
+			}
+
+			var name string
+			if err := db.QueryRow("SELECT name FROM test WHERE id = '3'").Scan(&name); err != nil {
+				t.Fatalf("Query error = %v", err)
+			}
+			if name != "Charlie" {
+				t.Errorf("name = %q, want Charlie", name)
+			}
+		})
+	}
+}
+
+func TestImportHeaderOnly(t *testing.T) {
+	testdataPath := findTestdata(t)
+	csvPath := filepath.Join(testdataPath, "sample.csv")
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	inputs := []FileInput{
+		{FilePath: csvPath, TableName: "with_header", Delimiter: ',', HasHeader: true, HeaderOnly: true, IndexColumns: []string{"city"}},
+		{FilePath: csvPath, TableName: "no_header", Delimiter: ',', HasHeader: false, HeaderOnly: true},
+	}
+	results, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	for _, result := range results {
+		if result.RowCount != 0 {
+			t.Errorf("%s RowCount = %d, want 0", result.TableName, result.RowCount)
+		}
+	}
+
+	wantColumns := map[string][]string{
+		"with_header": {"id", "name", "age", "city", "email"},
+		"no_header":   {"col1", "col2", "col3", "col4", "col5"},
+	}
+	for table, want := range wantColumns {
+		columns, err := database.GetTableColumns(db.DB, table)
+		if err != nil {
+			t.Fatalf("GetTableColumns(%s) error = %v", table, err)
+		}
+		if strings.Join(columns, ",") != strings.Join(want, ",") {
+			t.Errorf("%s columns = %v, want %v", table, columns, want)
+		}
+
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatalf("Count query error = %v", err)
+		}
+		if count != 0 {
+			t.Errorf("%s has %d rows, want 0", table, count)
+		}
+	}
+
+	parsed := ParseFile(FileInput{FilePath: csvPath, TableName: "parsed", Delimiter: ',', HasHeader: false, HeaderOnly: true}, nil)
+	if parsed.Error != nil || len(parsed.Rows) != 0 || len(parsed.Headers) != 5 {
+		t.Errorf("ParseFile() header-only = %d headers, %d rows, error %v; want 5, 0, nil", len(parsed.Headers), len(parsed.Rows), parsed.Error)
+	}
+}
+
+func TestImportExtraColumns(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "ragged.csv")
+	content := "id,name\n1,Alice\n2,Bob,extra\n3,Charlie,a,\"b,c\"\n"
+	if err := os.WriteFile(csvPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		policy      string
+		multi       bool
+		strict      bool
+		wantErr     bool
+		wantColumns string
+		wantExtra   []string
+	}{
+		// By default extra fields are dropped, unless columns are strict
+		{policy: "", wantColumns: "id,name"},
+		{policy: "", multi: true, wantColumns: "id,name"},
+		{policy: "", strict: true, wantErr: true},
+		{policy: ExtraColumnsIgnore, strict: true, wantColumns: "id,name"},
+		{policy: ExtraColumnsError, wantErr: true},
+		{policy: ExtraColumnsError, multi: true, wantErr: true},
+		{policy: ExtraColumnsIgnore, wantColumns: "id,name"},
+		{policy: ExtraColumnsIgnore, multi: true, wantColumns: "id,name"},
+		{policy: ExtraColumnsCapture, wantColumns: "id,name,_extra", wantExtra: []string{"", `["extra"]`, `["a","b,c"]`}},
+	}
+
+	for _, tt := range tests {
+		name := tt.policy
+		if name == "" {
+			name = "default"
+		}
+		if tt.multi {
+			name += "_multi"
+		}
+		if tt.strict {
+			name += "_strict"
+		}
+		t.Run(name, func(t *testing.T) {
+			input := FileInput{FilePath: csvPath, TableName: "ragged", Delimiter: ',', HasHeader: true, ExtraColumns: tt.policy, StrictColumns: tt.strict}
+			if tt.multi {
+				input.MultiDelimiter = ","
+			}
+
+			db, err := database.Open("")
+			if err != nil {
+				t.Fatalf("database.Open() error = %v", err)
+			}
+			defer db.Close()
+
+			results, streamErr := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+			parsed := ParseFile(input, nil)
+			if tt.wantErr {
+				if streamErr == nil || parsed.Error == nil {
+					t.Fatalf("import errors = %v, %v; want both to fail", streamErr, parsed.Error)
+				}
+				return
+			}
+			if streamErr != nil || parsed.Error != nil {
+				t.Fatalf("import errors = %v, %v", streamErr, parsed.Error)
+			}
+			if got := strings.Join(parsed.Headers, ","); got != tt.wantColumns {
+				t.Errorf("ParseFile() headers = %s, want %s", got, tt.wantColumns)
+			}
+			if wantTruncated := len(tt.wantExtra) == 0; (results[0].TruncatedRows == 2) != wantTruncated || (parsed.TruncatedRows == 2) != wantTruncated {
+				t.Errorf("truncated rows = %d, %d; want 2 unless captured", results[0].TruncatedRows, parsed.TruncatedRows)
+			}
+
+			columns, err := database.GetTableColumns(db.DB, "ragged")
+			if err != nil {
+				t.Fatalf("GetTableColumns() error = %v", err)
+			}
+			if got := strings.Join(columns, ","); got != tt.wantColumns {
+				t.Fatalf("columns = %s, want %s", got, tt.wantColumns)
+			}
+
+			var names []string
+			rows, err := db.Query("SELECT name FROM ragged ORDER BY id")
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			for rows.Next() {
+				var name string
+				rows.Scan(&name)
+				names = append(names, name)
+			}
+			rows.Close()
+			if strings.Join(names, ",") != "Alice,Bob,Charlie" {
+				t.Errorf("names = %v, want [Alice Bob Charlie]", names)
+			}
+
+			if tt.wantExtra == nil {
+				return
+			}
+			var extras []string
+			rows, err = db.Query("SELECT _extra FROM ragged ORDER BY id")
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var extra string
+				rows.Scan(&extra)
+				extras = append(extras, extra)
+			}
+			if strings.Join(extras, "|") != strings.Join(tt.wantExtra, "|") {
+				t.Errorf("_extra = %q, want %q", extras, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestImportStrictColumns(t *testing.T) {
+	dir := t.TempDir()
+	fixedPath := filepath.Join(dir, "fixed.csv")
+	if err := os.WriteFile(fixedPath, []byte("id,name,city\n1,Alice,Paris\n2,Bob,Rome\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	// Line 3 lost its last field
+	variablePath := filepath.Join(dir, "variable.csv")
+	if err := os.WriteFile(variablePath, []byte("id,name,city\n1,Alice,Paris\n2,Bob\n3,Carol,Oslo\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		strict  bool
+		multi   bool
+		wantErr string
+	}{
+		{name: "fixed", path: fixedPath},
+		{name: "fixed_strict", path: fixedPath, strict: true},
+		{name: "variable", path: variablePath},
+		{name: "variable_multi", path: variablePath, multi: true},
+		{name: "variable_strict", path: variablePath, strict: true, wantErr: "parse error at line 3: 2 fields but the header has 3"},
+		{name: "variable_strict_multi", path: variablePath, strict: true, multi: true, wantErr: "parse error at line 3: 2 fields but the header has 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := FileInput{FilePath: tt.path, TableName: "people", Delimiter: ',', HasHeader: true, StrictColumns: tt.strict}
+			if tt.multi {
+				input.MultiDelimiter = ","
+			}
+
+			db, err := database.Open("")
+			if err != nil {
+				t.Fatalf("database.Open() error = %v", err)
+			}
+			defer db.Close()
+
+			results, streamErr := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+			parsed := ParseFile(input, nil)
+			if tt.wantErr != "" {
+				if streamErr == nil || !strings.Contains(streamErr.Error(), tt.wantErr) {
+					t.Errorf("ImportConcurrent() error = %v, want %q", streamErr, tt.wantErr)
+				}
+				if parsed.Error == nil || !strings.Contains(parsed.Error.Error(), tt.wantErr) {
+					t.Errorf("ParseFile() error = %v, want %q", parsed.Error, tt.wantErr)
+				}
+				return
+			}
+			if streamErr != nil || parsed.Error != nil {
+				t.Fatalf("import errors = %v, %v", streamErr, parsed.Error)
+			}
+
+			// Short rows are padded with empty values, and counted
+			wantPadded := 0
+			if tt.path == variablePath {
+				wantPadded = 1
+			}
+			if results[0].PaddedRows != wantPadded || parsed.PaddedRows != wantPadded {
+				t.Errorf("PaddedRows = %d (streaming), %d (parsed), want %d", results[0].PaddedRows, parsed.PaddedRows, wantPadded)
+			}
+			var cities []string
+			rows, err := db.Query("SELECT city FROM people ORDER BY id")
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var city string
+				rows.Scan(&city)
+				cities = append(cities, city)
+			}
+			want := "Paris,Rome"
+			if tt.path == variablePath {
+				want = "Paris,,Oslo"
+			}
+			if got := strings.Join(cities, ","); got != want {
+				t.Errorf("cities = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    LineRange
+		wantErr bool
+	}{
+		{spec: "1000:2000", want: LineRange{Start: 1000, End: 2000}},
+		{spec: "1000:", want: LineRange{Start: 1000}},
+		{spec: ":2000", want: LineRange{End: 2000}},
+		{spec: "5:5", want: LineRange{Start: 5, End: 5}},
+		{spec: "1000", wantErr: true},
+		{spec: "2000:1000", wantErr: true},
+		{spec: "0:10", wantErr: true},
+		{spec: "a:b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLineRange(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLineRange(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLineRange(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestImportLineRange(t *testing.T) {
+	// Line N holds id N; line 6 starts a quoted field that spans two lines
+	var b strings.Builder
+	b.WriteString("id,note\n")
+	for line := 2; line <= 20; line++ {
+		if line == 6 {
+			b.WriteString("6,\"two\nlines\"\n")
+			line++
+			continue
+		}
+		fmt.Fprintf(&b, "%d,ok\n", line)
+	}
+	path := filepath.Join(t.TempDir(), "lines.csv")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		lines string
+		want  string
+	}{
+		{lines: "5:9", want: "5,6,8,9"},
+		{lines: "7:8", want: "8"},
+		{lines: "18:", want: "18,19,20"},
+		{lines: ":3", want: "2,3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lines, func(t *testing.T) {
+			lineRange, err := ParseLineRange(tt.lines)
+			if err != nil {
+				t.Fatalf("ParseLineRange() error = %v", err)
+			}
+			input := FileInput{FilePath: path, TableName: "lines", Delimiter: ',', HasHeader: true, LineRange: lineRange}
+
+			db, err := database.Open("")
+			if err != nil {
+				t.Fatalf("database.Open() error = %v", err)
+			}
+			defer db.Close()
+			if _, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err != nil {
+				t.Fatalf("ImportConcurrent() error = %v", err)
+			}
+
+			var ids []string
+			rows, err := db.Query("SELECT id FROM lines ORDER BY CAST(id AS INTEGER)")
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var id string
+				rows.Scan(&id)
+				ids = append(ids, id)
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("imported ids = %s, want %s", got, tt.want)
+			}
+
+			parsed := ParseFile(input, nil)
+			if parsed.Error != nil {
+				t.Fatalf("ParseFile() error = %v", parsed.Error)
+			}
+			var parsedIDs []string
+			for _, row := range parsed.Rows {
+				parsedIDs = append(parsedIDs, row[0])
+			}
+			if got := strings.Join(parsedIDs, ","); got != tt.want {
+				t.Errorf("ParseFile() ids = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportSkipLines(t *testing.T) {
+	// Two metadata lines, a comment before the header, and a quoted field
+	// whose second line starts with the comment character
+	content := "Exported 2024-01-01\nsource: crm\n# columns follow\nid,note\n" +
+		"1,\"multi\n# not a comment\"\n  # dropped\n2,plain\n"
+	path := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	input := FileInput{FilePath: path, TableName: "export", Delimiter: ',', HasHeader: true, SkipLines: 2, CommentChar: '#'}
+
+	parsed := ParseFile(input, nil)
+	if parsed.Error != nil {
+		t.Fatalf("ParseFile() error = %v", parsed.Error)
+	}
+	if got := strings.Join(parsed.Headers, ","); got != "id,note" {
+		t.Errorf("ParseFile() headers = %s, want id,note", got)
+	}
+	if len(parsed.Rows) != 2 || parsed.Rows[0][1] != "multi\n# not a comment" || parsed.Rows[1][1] != "plain" {
+		t.Errorf("ParseFile() rows = %q, want the quoted field kept and the comment dropped", parsed.Rows)
+	}
+
+	// Skipped lines still count: the row with id 2 is on line 8
+	input.LineRange = LineRange{Start: 8}
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+	results, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if results[0].RowCount != 1 {
+		t.Errorf("RowCount = %d, want 1", results[0].RowCount)
+	}
+	var note string
+	if err := db.QueryRow("SELECT note FROM export WHERE id = '2'").Scan(&note); err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if note != "plain" {
+		t.Errorf("note = %q, want %q", note, "plain")
+	}
+}
+
+func TestImportResume(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// A malformed row after the first batch interrupts the first run
+	const rows = database.BatchSize*2 + 5000
+	const badRow = database.BatchSize + 5000
+	path := filepath.Join(t.TempDir(), "events.csv")
+	writeEvents := func(broken bool) {
+		var b strings.Builder
+		b.WriteString("id,name\n")
+		for i := 1; i <= rows; i++ {
+			if broken && i == badRow {
+				fmt.Fprintf(&b, "%d,event%d,unexpected\n", i, i)
+				continue
+			}
+			fmt.Fprintf(&b, "%d,event%d\n", i, i)
+		}
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	count := func() int {
+		var n int
+		if err := db.DB.QueryRow("SELECT COUNT(DISTINCT id) FROM events").Scan(&n); err != nil {
+			t.Fatalf("QueryRow() error = %v", err)
+		}
+		return n
+	}
+	// Strict columns fail on the malformed row rather than truncating it
+	input := FileInput{FilePath: path, TableName: "events", Delimiter: ',', HasHeader: true, Resume: true, StrictColumns: true}
+
+	writeEvents(true)
+	if _, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err == nil {
+		t.Fatal("ImportConcurrent() with a malformed row succeeded, want error")
+	}
+	if n := count(); n != database.BatchSize {
+		t.Fatalf("rows after the interrupted run = %d, want the first batch (%d)", n, database.BatchSize)
+	}
+	checkpoint, err := database.LoadCheckpoint(db.DB, "events")
+	if err != nil || checkpoint == nil || checkpoint.Rows != database.BatchSize || checkpoint.Source != path {
+		t.Fatalf("LoadCheckpoint() = %+v, %v, want %d rows of %s", checkpoint, err, database.BatchSize, path)
+	}
+
+	writeEvents(false)
+	results, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() resume error = %v", err)
+	}
+	if results[0].RowCount != rows-database.BatchSize || results[0].ResumedAfter != database.BatchSize {
+		t.Errorf("resumed result = %+v, want %d rows after %d", results[0], rows-database.BatchSize, database.BatchSize)
+	}
+	if n := count(); n != rows {
+		t.Errorf("rows after resuming = %d, want %d, each once", n, rows)
+	}
+
+	// Resuming a finished import adds nothing
+	if results, err = ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err != nil || results[0].RowCount != 0 {
+		t.Errorf("ImportConcurrent() of a finished import = %+v, %v, want 0 new rows", results, err)
+	}
+
+	// Importing without resuming starts over and drops the checkpoint
+	input.Resume = false
+	if _, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() without resume error = %v", err)
+	}
+	if checkpoint, err := database.LoadCheckpoint(db.DB, "events"); err != nil || checkpoint != nil {
+		t.Errorf("LoadCheckpoint() after a full import = %+v, %v, want none", checkpoint, err)
+	}
+	if n := count(); n != rows {
+		t.Errorf("rows after a full import = %d, want %d", n, rows)
+	}
+}
+
+func TestImportDropEmptyColumns(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// The trailing delimiter adds an unnamed column with no values
+	path := filepath.Join(t.TempDir(), "export.csv")
+	content := "id,name,unused,code,notes,\n1,Alice,,,,\n2,Bob,,,see above,\n3,Carol,,,,\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	inputs := []FileInput{{
+		FilePath:        path,
+		TableName:       "export",
+		Delimiter:       ',',
+		HasHeader:       true,
+		IndexColumns:    []string{"code"},
+		PreserveHeaders: true,
+		DropEmptyCols:   true,
+	}}
+	results, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if got := strings.Join(results[0].DroppedColumns, ","); got != "unused,unnamed" {
+		t.Errorf("DroppedColumns = %q, want unused,unnamed", got)
+	}
+
+	// code is empty too, but kept for its index
+	columns, err := database.GetTableColumns(db.DB, "export")
+	if err != nil {
+		t.Fatalf("GetTableColumns() error = %v", err)
+	}
+	if got := strings.Join(columns, ","); got != "id,name,code,notes" {
+		t.Errorf("columns = %q, want id,name,code,notes", got)
+	}
+	headers, err := database.OriginalHeaders(db.DB, "export")
+	if err != nil {
+		t.Fatalf("OriginalHeaders() error = %v", err)
+	}
+	if _, ok := headers["unused"]; ok || len(headers) != 4 {
+		t.Errorf("OriginalHeaders() = %v, want the dropped columns removed", headers)
+	}
+}
+
+func TestImportVersionTables(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	var versionedAs string
+	for i, content := range []string{"id,status\n1,old\n2,old\n", "id,status\n1,new\n"} {
+		path := filepath.Join(dir, fmt.Sprintf("snapshot%d.csv", i))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		input := FileInput{FilePath: path, TableName: "data", Delimiter: ',', HasHeader: true, IndexColumns: []string{"id"}, UniqueIndexes: []string{"id"}, VersionTable: true}
+		results, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("ImportConcurrent() error = %v", err)
+		}
+		if i == 0 && results[0].VersionedAs != "" {
+			t.Errorf("first import VersionedAs = %q, want none", results[0].VersionedAs)
+		}
+		versionedAs = results[0].VersionedAs
+	}
+	if !strings.HasPrefix(versionedAs, "data_") {
+		t.Fatalf("VersionedAs = %q, want data_<timestamp>", versionedAs)
+	}
+
+	// Both versions can be queried side by side
+	var current, previous int
+	if err := db.QueryRow("SELECT COUNT(*) FROM data WHERE status = 'new'").Scan(&current); err != nil {
+		t.Fatalf("Query current error = %v", err)
+	}
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE status = 'old'", versionedAs)).Scan(&previous); err != nil {
+		t.Fatalf("Query previous error = %v", err)
+	}
+	if current != 1 || previous != 2 {
+		t.Errorf("rows = %d current, %d previous; want 1, 2", current, previous)
+	}
+
+	// The new table got its own indexes, and the previous one kept its
+	// under names for its new table name
+	var indexed int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = 'data'").Scan(&indexed); err != nil {
+		t.Fatalf("Query indexes error = %v", err)
+	}
+	if indexed != 2 {
+		t.Errorf("indexes on data = %d, want 2", indexed)
+	}
+	for _, name := range []string{"idx_" + versionedAs + "_id", "uidx_" + versionedAs + "_id"} {
+		var table string
+		if err := db.QueryRow("SELECT tbl_name FROM sqlite_master WHERE type = 'index' AND name = ?", name).Scan(&table); err != nil || table != versionedAs {
+			t.Errorf("index %s is on %q (error %v), want %s", name, table, err, versionedAs)
+		}
+	}
+}
+
+func TestImportBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes and imports a large file")
+	}
+
+	path := filepath.Join(t.TempDir(), "large.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString("id,name,email,notes\n")
+	const rowCount = 300000
+	for i := 0; i < rowCount; i++ {
+		fmt.Fprintf(w, "%d,user%d,user%d@example.com,%s\n", i, i, i, strings.Repeat("x", 64))
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	f.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// Sample the heap while importing; holding the rows in memory would take
+	// several times the size of the file
+	runtime.GC()
+	var base runtime.MemStats
+	runtime.ReadMemStats(&base)
+	var peak uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	result, err := Import(db.DB, path, "large", ',', true)
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.RowCount != rowCount {
+		t.Errorf("RowCount = %d, want %d", result.RowCount, rowCount)
+	}
+
+	growth := int64(peak) - int64(base.HeapAlloc)
+	if budget := info.Size() / 2; growth > budget {
+		t.Errorf("heap grew by %d bytes importing a %d byte file, want at most %d", growth, info.Size(), budget)
+	}
+}
+
+func TestSqueezeSpaces(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "a   b", want: "a b"},
+		{in: "a b c", want: "a b c"},
+		{in: "a\t\t b\n\nc", want: "a b c"},
+		{in: "a\tb", want: "a\tb"},
+		{in: "  lead and trail  ", want: " lead and trail "},
+		{in: "über  straße", want: "über straße"},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := squeezeSpaces(tt.in); got != tt.want {
+			t.Errorf("squeezeSpaces(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestImportSqueezeSpaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.csv")
+	if err := os.WriteFile(path, []byte("level,\"the   message\"\nINFO,\"a   b\"\nWARN,a b\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	input := FileInput{FilePath: path, TableName: "log", Delimiter: ',', HasHeader: true, SqueezeSpaces: true}
+	if _, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+
+	// The header keeps its spaces; sanitizing turns each into an underscore
+	var groups int
+	if err := db.QueryRow("SELECT COUNT(DISTINCT the___message) FROM log").Scan(&groups); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if groups != 1 {
+		t.Errorf("distinct messages = %d, want 1 after squeezing", groups)
+	}
+}
+
+func TestImportConcurrentWithLimit(t *testing.T) {
+	dir := t.TempDir()
+	const fileCount = 20
+	inputs := make([]FileInput, fileCount)
+	for i := range inputs {
+		path := filepath.Join(dir, fmt.Sprintf("part%02d.csv", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("id,part\n1,%d\n2,%d\n", i, i)), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		inputs[i] = FileInput{FilePath: path, TableName: fmt.Sprintf("part%02d", i), Delimiter: ',', HasHeader: true}
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// Track how many files are being imported at once
+	var mu sync.Mutex
+	active, peak := 0, 0
+	progress := func(event, filePath, tableName string, details ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch event {
+		case "parse_start":
+			active++
+			peak = max(peak, active)
+		case "parse_complete", "parse_error":
+			active--
+		}
+	}
+
+	results, err := ImportConcurrentWithLimit(db.DB, inputs, 2, false, progress, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrentWithLimit() error = %v", err)
+	}
+	if len(results) != fileCount {
+		t.Errorf("imported %d files, want %d", len(results), fileCount)
+	}
+	if peak > 2 {
+		t.Errorf("%d files imported at once, want at most 2", peak)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name LIKE 'part%'").Scan(&tables); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if tables != fileCount {
+		t.Errorf("tables = %d, want %d", tables, fileCount)
+	}
+}
+
+func TestImportErrorLineNumbers(t *testing.T) {
+	// Line 4213 has an extra field; quoted newlines before it span two lines each
+	var b strings.Builder
+	b.WriteString("id,note\n")
+	for line := 2; line < 4213; {
+		if line == 100 {
+			b.WriteString("100,\"multi\nline\"\n")
+			line += 2
+			continue
+		}
+		fmt.Fprintf(&b, "%d,ok\n", line)
+		line++
+	}
+	b.WriteString("4213,bad,extra\n4214,ok\n")
+	path := filepath.Join(t.TempDir(), "malformed.csv")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	input := FileInput{FilePath: path, TableName: "malformed", Delimiter: ',', HasHeader: true, StrictColumns: true}
+	_, err = ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "malformed.csv: parse error at line 4213") {
+		t.Errorf("ImportConcurrent() error = %v, want file name and line 4213", err)
+	}
+	if parsed := ParseFile(input, nil); parsed.Error == nil || !strings.Contains(parsed.Error.Error(), "line 4213") {
+		t.Errorf("ParseFile() error = %v, want line 4213", parsed.Error)
+	}
+
+	// The multi-delimiter reader counts lines too
+	multiPath := filepath.Join(t.TempDir(), "malformed.txt")
+	if err := os.WriteFile(multiPath, []byte("id::note\n1::ok\n\n3::bad::extra\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	parsed := ParseFile(FileInput{FilePath: multiPath, TableName: "multi", HasHeader: true, MultiDelimiter: "::", StrictColumns: true}, nil)
+	if parsed.Error == nil || !strings.Contains(parsed.Error.Error(), "line 4:") {
+		t.Errorf("ParseFile() multi-delimiter error = %v, want line 4", parsed.Error)
+	}
+}
+
+func TestImportWideFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// writeWideFile writes a header and two rows with the given number of columns
+	writeWideFile := func(name string, columns int) string {
+		var b strings.Builder
+		for row := 0; row < 3; row++ {
+			for col := 0; col < columns; col++ {
+				if col > 0 {
+					b.WriteByte(',')
+				}
+				if row == 0 {
+					fmt.Fprintf(&b, "c%d", col)
+				} else {
+					fmt.Fprintf(&b, "%d", row*col)
+				}
+			}
+			b.WriteByte('\n')
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return path
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	widePath := writeWideFile("wide.csv", 1500)
+	results, err := ImportConcurrent(db.DB, []FileInput{{FilePath: widePath, TableName: "wide", Delimiter: ',', HasHeader: true}}, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if results[0].RowCount != 2 {
+		t.Errorf("RowCount = %d, want 2", results[0].RowCount)
+	}
+	var last string
+	if err := db.QueryRow("SELECT c1499 FROM wide WHERE c1 = '2'").Scan(&last); err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if last != "2998" {
+		t.Errorf("c1499 = %q, want 2998", last)
+	}
+
+	// Beyond SQLite's column limit the import fails up front with a clear error
+	tooWidePath := writeWideFile("too_wide.csv", 2500)
+	_, err = ImportConcurrent(db.DB, []FileInput{{FilePath: tooWidePath, TableName: "wide", Delimiter: ',', HasHeader: true}}, false, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "2500 columns") {
+		t.Fatalf("ImportConcurrent() error = %v, want a column limit error", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM wide").Scan(&count); err != nil || count != 2 {
+		t.Errorf("existing table after failed import: %d rows, %v; want 2 rows kept", count, err)
+	}
+}
+
+func TestImportPreserveOriginalHeaders(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "labels.csv")
+	content := "User Name (Primary),e-mail,2023 Total\nAlice,alice@example.com,10\n"
+	if err := os.WriteFile(csvPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	input := FileInput{FilePath: csvPath, TableName: "streamed", Delimiter: ',', HasHeader: true, ColumnCase: "upper", PreserveHeaders: true}
+	if _, err := ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	input.TableName = "parsed"
+	if _, err := WriteToDatabase(db.DB, ParseFile(input, nil), nil); err != nil {
+		t.Fatalf("WriteToDatabase() error = %v", err)
+	}
+
+	want := map[string]string{
+		"USER_NAME__PRIMARY_": "User Name (Primary)",
+		"E_MAIL":              "e-mail",
+		"COL_2023_TOTAL":      "2023 Total",
+	}
+	for _, table := range []string{"streamed", "parsed"} {
+		got, err := database.OriginalHeaders(db.DB, table)
+		if err != nil {
+			t.Fatalf("OriginalHeaders(%s) error = %v", table, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("OriginalHeaders(%s) = %v, want %v", table, got, want)
+		}
+		for column, original := range want {
+			if got[column] != original {
+				t.Errorf("OriginalHeaders(%s)[%s] = %q, want %q", table, column, got[column], original)
+			}
+		}
+	}
+
+	// Tables imported without the option have no recorded headers
+	if _, err := Import(db.DB, csvPath, "plain", ',', true); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if got, err := database.OriginalHeaders(db.DB, "plain"); err != nil || len(got) != 0 {
+		t.Errorf("OriginalHeaders(plain) = %v, %v; want empty", got, err)
+	}
+}
+
+func TestImportValueMaps(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "countries.csv")
+	content := "name,Country\nAlice,USA\nBob,U.S.A.\nCharlie,United States\nDiana,Canada\n"
+	if err := os.WriteFile(csvPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	valueMaps := map[string]map[string]string{
+		"country": {"U.S.A.": "USA", "United States": "USA"},
+		"missing": {"a": "b"},
+	}
+	inputs := []FileInput{{FilePath: csvPath, TableName: "streamed", Delimiter: ',', HasHeader: true, ValueMaps: valueMaps}}
+	if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+
+	parsed := ParseFile(FileInput{FilePath: csvPath, TableName: "parsed", Delimiter: ',', HasHeader: true, ValueMaps: valueMaps}, nil)
+	if _, err := WriteToDatabase(db.DB, parsed, nil); err != nil {
+		t.Fatalf("WriteToDatabase() error = %v", err)
+	}
+
+	for _, table := range []string{"streamed", "parsed"} {
+		rows, err := db.Query("SELECT Country FROM " + table + " ORDER BY name")
+		if err != nil {
+			t.Fatalf("Query error = %v", err)
+		}
+		var got []string
+		for rows.Next() {
+			var country string
+			if err := rows.Scan(&country); err != nil {
+				t.Fatalf("Scan error = %v", err)
+			}
+			got = append(got, country)
+		}
+		rows.Close()
+
+		want := "USA,USA,USA,Canada"
+		if strings.Join(got, ",") != want {
+			t.Errorf("%s countries = %v, want %s", table, got, want)
+		}
+	}
+}
+
+func TestImportFromCommand(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	command := `printf 'id,name\n1,Alice\n2,Bob\n'`
+	inputs := []FileInput{{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command}}
+	results, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if len(results) != 1 || results[0].RowCount != 2 {
+		t.Fatalf("Expected 2 rows imported, got %+v", results)
+	}
+
+	var name string
+	if err := db.QueryRow("SELECT name FROM people WHERE id = '2'").Scan(&name); err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if name != "Bob" {
+		t.Errorf("name = %q, want Bob", name)
+	}
+}
+
+func TestImportFromFailingCommand(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	command := `printf 'id,name\n1,Alice\n'; echo "connection refused" >&2; exit 3`
+	inputs := []FileInput{{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command}}
+	_, err = ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	if err == nil {
+		t.Fatal("Expected error for failing command, got nil")
+	}
+	if !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Expected exit status and stderr in error, got: %v", err)
+	}
+}
+
+func TestImportRowTransform(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// Uppercase names and drop everyone under 30
+	transform := func(headers []string, row []string) ([]string, bool) {
+		if age, _ := strconv.Atoi(row[2]); age < 30 {
+			return nil, false
+		}
+		row[1] = strings.ToUpper(row[1])
+		return row, true
+	}
+
+	command := `printf 'id,name,age\n1,Alice,30\n2,Bob,25\n3,Carol,41\n'`
+	inputs := []FileInput{{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command, RowTransform: transform}}
+	results, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	if len(results) != 1 || results[0].RowCount != 2 {
+		t.Fatalf("Expected 2 rows imported, got %+v", results)
+	}
+
+	rows, err := db.Query("SELECT name FROM people ORDER BY id")
+	if err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("Scan error = %v", err)
+		}
+		got = append(got, name)
+	}
+	if strings.Join(got, ",") != "ALICE,CAROL" {
+		t.Errorf("names = %v, want ALICE,CAROL", got)
+	}
+}
+
+func TestImportRowTransformWidth(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// Line 3 is short; the transform sees it padded
+	command := `printf 'id,name\n1,Alice\n2\n3,Carol\n'`
+	var widths []int
+	transform := func(headers []string, row []string) ([]string, bool) {
+		widths = append(widths, len(row))
+		if row[0] == "3" {
+			return append(row, "extra"), true
+		}
+		return row, true
+	}
+	inputs := []FileInput{{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command, RowTransform: transform}}
+	_, err = ImportConcurrent(db.DB, inputs, false, nil, nil, nil)
+	want := "row transform of " + command + " at line 4 returned 3 values, but the table has 2 columns"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("ImportConcurrent() error = %v, want %s", err, want)
+	}
+	if fmt.Sprint(widths) != "[2 2 2]" {
+		t.Errorf("rows given to the transform have %v values, want [2 2 2]", widths)
+	}
+}
+
+func TestImportAppend(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// The second file lists the same columns in another order
+	for _, command := range []string{
+		`printf 'id,name\n1,Alice\n2,Bob\n'`,
+		`printf 'Name,ID\nCarol,3\n'`,
+	} {
+		inputs := []FileInput{{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command, Append: true}}
+		if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err != nil {
+			t.Fatalf("ImportConcurrent() error = %v", err)
+		}
+	}
+
+	var names string
+	if err := db.QueryRow("SELECT group_concat(name, ',') FROM (SELECT name FROM people ORDER BY id)").Scan(&names); err != nil {
+		t.Fatalf("QueryRow error = %v", err)
+	}
+	if names != "Alice,Bob,Carol" {
+		t.Errorf("names = %s, want Alice,Bob,Carol", names)
+	}
+
+	command := `printf 'id,email\n4,dan@example.com\n'`
+	inputs := []FileInput{{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command, Append: true}}
+	if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("ImportConcurrent() with other columns error = %v, want a column mismatch", err)
+	}
+}
+
+func TestInferColumnTypes(t *testing.T) {
+	sample := [][]string{
+		{"1", "1.5", "007", "", "x", "-3", "1e3"},
+		{"20", "2", "8", "", "1", "", "Inf"},
+		{"", "", "9", ""},
+	}
+	got := InferColumnTypes(sample, 7, nil)
+	want := []string{"INTEGER", "REAL", "TEXT", "TEXT", "TEXT", "INTEGER", "TEXT"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("InferColumnTypes() = %v, want %v", got, want)
+	}
+}
+
+func TestImportInferTypes(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// code is numeric in the two sampled rows only, so it ends up TEXT
+	command := `printf 'id,age,score,code\n1,30,1.5,10\n2,,2,20\n3,41,3.25,A7\n'`
+	inputs := []FileInput{{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command, InferTypes: 2}}
+	if _, err := ImportConcurrent(db.DB, inputs, false, nil, nil, nil); err != nil {
+		t.Fatalf("ImportConcurrent() error = %v", err)
+	}
+	parsed := ParseFile(FileInput{FilePath: command, TableName: "parsed", Delimiter: ',', HasHeader: true, Command: command, InferTypes: 2}, nil)
+	if want := "INTEGER,INTEGER,REAL,TEXT"; strings.Join(parsed.ColumnTypes, ",") != want {
+		t.Errorf("ParsedFile.ColumnTypes = %v, want %s", parsed.ColumnTypes, want)
+	}
+	if _, err := WriteToDatabase(db.DB, parsed, nil); err != nil {
+		t.Fatalf("WriteToDatabase() error = %v", err)
+	}
+
+	for _, table := range []string{"people", "parsed"} {
+		var types string
+		if err := db.QueryRow("SELECT group_concat(type, ',') FROM pragma_table_info('" + table + "')").Scan(&types); err != nil {
+			t.Fatalf("Query error = %v", err)
+		}
+		if types != "INTEGER,INTEGER,REAL,TEXT" {
+			t.Errorf("%s column types = %s, want INTEGER,INTEGER,REAL,TEXT", table, types)
+		}
+
+		// Numbers compare as numbers, and the empty age is NULL rather than text
+		var ids, codes string
+		if err := db.QueryRow("SELECT group_concat(id, ','), (SELECT group_concat(code, ',') FROM "+table+") FROM "+table+" WHERE age > 9 AND score > 1.4").Scan(&ids, &codes); err != nil {
+			t.Fatalf("Query error = %v", err)
+		}
+		if ids != "1,3" || codes != "10,20,A7" {
+			t.Errorf("%s: ids with age > 9 = %s, codes = %s; want 1,3 and 10,20,A7", table, ids, codes)
+		}
+	}
+}
+
+func TestImportFailOnTypeMismatch(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	// age is INTEGER in the two sampled rows; line 5 holds the bad value
+	command := `printf 'id,age\n1,30\n2,41\n3,\n4,4O\n5,52\n'`
+	input := FileInput{FilePath: command, TableName: "people", Delimiter: ',', HasHeader: true, Command: command, InferTypes: 2, FailOnTypeMismatch: true}
+	want := `type mismatch at line 5: value "4O" in column age is not INTEGER`
+
+	_, err = ImportConcurrent(db.DB, []FileInput{input}, false, nil, nil, nil)
+	if err == nil || err.Error() != command+": "+want {
+		t.Errorf("ImportConcurrent() error = %v, want %s: %s", err, command, want)
+	}
+	if parsed := ParseFile(input, nil); parsed.Error == nil || parsed.Error.Error() != want {
+		t.Errorf("ParseFile() error = %v, want %s", parsed.Error, want)
+	}
 }
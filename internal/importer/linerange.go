@@ -0,0 +1,53 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LineRange selects the rows to import by their line number in the file,
+// counting the first line, usually the header, as line 1, as in error
+// messages. A row spanning
+// several lines (a quoted field with newlines) is selected by its first line.
+// The zero value selects every row.
+type LineRange struct {
+	Start int // First line to import (0 = from the start)
+	End   int // Last line to import, inclusive (0 = to the end)
+}
+
+// ParseLineRange parses a range such as "1000:2000". Either end may be
+// omitted: "1000:" imports from line 1000 on and ":2000" up to line 2000.
+func ParseLineRange(s string) (LineRange, error) {
+	startText, endText, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return LineRange{}, fmt.Errorf("invalid line range %q: expected start:end", s)
+	}
+
+	var r LineRange
+	var err error
+	if startText != "" {
+		if r.Start, err = strconv.Atoi(startText); err != nil || r.Start < 1 {
+			return LineRange{}, fmt.Errorf("invalid line range %q: start must be a positive line number", s)
+		}
+	}
+	if endText != "" {
+		if r.End, err = strconv.Atoi(endText); err != nil || r.End < 1 {
+			return LineRange{}, fmt.Errorf("invalid line range %q: end must be a positive line number", s)
+		}
+	}
+	if r.End > 0 && r.End < r.Start {
+		return LineRange{}, fmt.Errorf("invalid line range %q: end is before start", s)
+	}
+	return r, nil
+}
+
+// before reports whether line comes before the range.
+func (r LineRange) before(line int) bool {
+	return line < r.Start
+}
+
+// after reports whether line comes after the range, so reading can stop.
+func (r LineRange) after(line int) bool {
+	return r.End > 0 && line > r.End
+}
@@ -1,31 +1,208 @@
 // Package importer provides CSV/TSV file import functionality for yatisql.
+//
+// The import functions accept any *sql.DB using the sqlite3 driver, so callers
+// can open and configure their own connection instead of using database.Open.
+// Concurrent imports write from several pooled connections at once, which
+// needs WAL journal mode and a busy timeout (for example
+// "file:data.db?_journal_mode=WAL&_busy_timeout=5000"); database.Open sets
+// both. An in-memory database is private to each connection, so limit its
+// pool with db.SetMaxOpenConns(1).
 package importer
 
 import (
+	"bufio"
+	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
 )
 
 // OpenFile opens a file, handling compression automatically based on extension.
-// Supports .gz (gzip) and .bz2 (bzip2) compressed files.
+// Supports .gz (gzip), .bz2 (bzip2), .lz4 (LZ4 frame) and .xz compressed files.
 // If filePath is "-" or empty string, returns os.Stdin wrapped in a no-op closer.
+// An http:// or https:// URL is downloaded as it is read; the extension of
+// its path, without the query string, selects the decompression.
 func OpenFile(filePath string) (io.ReadCloser, error) {
+	return OpenFileWithEncoding(filePath, "")
+}
+
+// OpenFileWithEncoding opens a file like OpenFile and transcodes its content
+// from the named character encoding (e.g. "latin1", "windows-1252") to UTF-8.
+// Any UTF-8 alias returns the content unchanged, apart from a leading UTF-8
+// byte order mark, which is dropped. With an empty encoding, content starting
+// with a UTF-16 byte order mark is transcoded from UTF-16, and other content
+// is returned like UTF-8.
+func OpenFileWithEncoding(filePath, encodingName string) (io.ReadCloser, error) {
+	return openDecoded(func() (io.ReadCloser, error) { return openRaw(filePath) }, encodingName)
+}
+
+// openInput opens an input's data source, a command's output or a file,
+// transcoded from the input's encoding.
+func openInput(input FileInput) (io.ReadCloser, error) {
+	var file io.ReadCloser
+	var err error
+	if input.Command != "" {
+		file, err = openDecoded(func() (io.ReadCloser, error) { return OpenCommand(input.Command) }, input.Encoding)
+	} else {
+		file, err = OpenFileWithEncoding(input.FilePath, input.Encoding)
+	}
+	if err != nil || (input.SkipLines <= 0 && input.CommentChar == 0) {
+		return file, err
+	}
+	return &lineSkipper{
+		ReadCloser: file,
+		reader:     bufio.NewReader(file),
+		skip:       input.SkipLines,
+		comment:    input.CommentChar,
+		quotes:     input.MultiDelimiter == "" && input.RecordSeparator == "",
+	}, nil
+}
+
+// lineSkipper blanks the first skip lines of a source and, outside quoted
+// fields, the lines whose first non-space rune is comment. Their newlines are
+// kept, so record readers skip them as empty lines but still count them in
+// line numbers.
+type lineSkipper struct {
+	io.ReadCloser
+	reader  *bufio.Reader
+	skip    int
+	comment rune // 0 = no comment lines
+	quotes  bool // Track quoted fields, whose lines may start with comment
+	quoted  bool // The last line kept ended inside a quoted field
+	pending []byte
+	err     error
+}
+
+func (l *lineSkipper) Read(p []byte) (int, error) {
+	for len(l.pending) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		var line []byte
+		line, l.err = l.reader.ReadBytes('\n')
+		l.pending = l.filter(line)
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// filter returns a line as it is, or only its newline if it is skipped.
+func (l *lineSkipper) filter(line []byte) []byte {
+	skipped := false
+	if l.skip > 0 && len(line) > 0 {
+		l.skip--
+		skipped = true
+	} else if l.comment != 0 && !l.quoted {
+		first, _ := utf8.DecodeRune(bytes.TrimSpace(line))
+		skipped = first == l.comment
+	}
+	if skipped {
+		if bytes.HasSuffix(line, []byte("\n")) {
+			return []byte("\n")
+		}
+		return nil
+	}
+
+	// A doubled quote inside a quoted field leaves it open
+	if l.quotes && bytes.Count(line, []byte{'"'})%2 == 1 {
+		l.quoted = !l.quoted
+	}
+	return line
+}
+
+// openDecoded opens a source and transcodes it from the named encoding to UTF-8.
+// The encoding is checked first so an invalid name does not open the source.
+func openDecoded(open func() (io.ReadCloser, error), encodingName string) (io.ReadCloser, error) {
+	enc, err := LookupEncoding(encodingName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := open()
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return sniffByteOrderMark(file, encodingName == ""), nil
+	}
+	return &decodedFile{ReadCloser: file, reader: enc.NewDecoder().Reader(file)}, nil
+}
+
+// utf8BOM is the byte order mark Excel and other Windows tools write at the
+// start of UTF-8 files. Left in place it would become part of the first header.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// sniffByteOrderMark drops a UTF-8 byte order mark from the start of content
+// and, if utf16 is set, transcodes content that starts with a UTF-16 byte
+// order mark, as written by Excel "Unicode text" exports, to UTF-8. Other
+// content is returned unchanged.
+func sniffByteOrderMark(file io.ReadCloser, utf16 bool) io.ReadCloser {
+	buffered := bufio.NewReader(file)
+	var enc encoding.Encoding
+	// A short or unreadable source leaves the error to the first Read
+	bom, _ := buffered.Peek(len(utf8BOM))
+	switch {
+	case bytes.HasPrefix(bom, utf8BOM):
+		buffered.Discard(len(utf8BOM))
+	case utf16 && bytes.HasPrefix(bom, []byte{0xFF, 0xFE}):
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case utf16 && bytes.HasPrefix(bom, []byte{0xFE, 0xFF}):
+		enc = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+	if enc == nil {
+		return &decodedFile{ReadCloser: file, reader: buffered}
+	}
+	return &decodedFile{ReadCloser: file, reader: enc.NewDecoder().Reader(buffered)}
+}
+
+// LookupEncoding resolves an encoding name to a decoder.
+// Returns nil for an empty name or UTF-8, meaning no transcoding is needed.
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "utf-8", "utf8":
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported encoding: %s", name)
+	}
+	return enc, nil
+}
+
+// openRaw opens a file or stdin and applies decompression, without transcoding.
+func openRaw(filePath string) (io.ReadCloser, error) {
 	// Handle stdin
 	if filePath == "-" || filePath == "" {
 		return &stdinReader{reader: os.Stdin}, nil
 	}
 
-	file, err := os.Open(filePath)
+	var file io.ReadCloser
+	var err error
+	if IsURL(filePath) {
+		file, err = openURL(filePath)
+	} else {
+		file, err = os.Open(filePath)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	ext := strings.ToLower(filepath.Ext(filePath))
+	ext := strings.ToLower(filepath.Ext(urlPath(filePath)))
 	switch ext {
 	case ".gz":
 		gzReader, err := gzip.NewReader(file)
@@ -36,11 +213,75 @@ func OpenFile(filePath string) (io.ReadCloser, error) {
 		return &gzipFile{file: file, reader: gzReader}, nil
 	case ".bz2":
 		return &bzip2File{file: file, reader: bzip2.NewReader(file)}, nil
+	case ".lz4":
+		return &lz4File{file: file, reader: lz4.NewReader(file)}, nil
+	case ".xz":
+		xzReader, err := xz.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create xz reader: %w", err)
+		}
+		return &xzFile{file: file, reader: xzReader}, nil
 	default:
 		return file, nil
 	}
 }
 
+// httpTimeout bounds connecting to a URL input and waiting for the response
+// headers. Reading the body is not limited, so large files can stream.
+const httpTimeout = 30 * time.Second
+
+// httpClient downloads URL inputs.
+var httpClient = &http.Client{Transport: func() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = httpTimeout
+	return transport
+}()}
+
+// IsURL reports whether an input path is an http:// or https:// URL, which
+// is downloaded while it is imported.
+func IsURL(filePath string) bool {
+	lower := strings.ToLower(filePath)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// urlPath returns the path of a URL input, without its query string or
+// fragment, so that its extension can be examined. Other paths are returned
+// as they are.
+func urlPath(filePath string) string {
+	if !IsURL(filePath) {
+		return filePath
+	}
+	u, err := url.Parse(filePath)
+	if err != nil {
+		return filePath
+	}
+	return u.Path
+}
+
+// openURL issues a GET for a URL input and returns the response body.
+func openURL(rawURL string) (io.ReadCloser, error) {
+	resp, err := httpClient.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: server responded %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// decodedFile transcodes an underlying reader to UTF-8 and closes the original.
+type decodedFile struct {
+	io.ReadCloser
+	reader io.Reader
+}
+
+func (d *decodedFile) Read(p []byte) (int, error) {
+	return d.reader.Read(p)
+}
+
 // stdinReader wraps os.Stdin with a no-op Close method.
 type stdinReader struct {
 	reader io.Reader
@@ -57,7 +298,7 @@ func (s *stdinReader) Close() error {
 
 // gzipFile wraps gzip reader and file to close both.
 type gzipFile struct {
-	file   *os.File
+	file   io.Closer
 	reader *gzip.Reader
 }
 
@@ -72,7 +313,7 @@ func (g *gzipFile) Close() error {
 
 // bzip2File wraps bzip2 reader and file to close both.
 type bzip2File struct {
-	file   *os.File
+	file   io.Closer
 	reader io.Reader
 }
 
@@ -84,29 +325,178 @@ func (b *bzip2File) Close() error {
 	return b.file.Close()
 }
 
+// lz4File wraps lz4 reader and file to close both.
+type lz4File struct {
+	file   io.Closer
+	reader *lz4.Reader
+}
+
+func (l *lz4File) Read(p []byte) (int, error) {
+	return l.reader.Read(p)
+}
+
+func (l *lz4File) Close() error {
+	return l.file.Close()
+}
+
+// xzFile wraps xz reader and file to close both.
+type xzFile struct {
+	file   io.Closer
+	reader *xz.Reader
+}
+
+func (x *xzFile) Read(p []byte) (int, error) {
+	return x.reader.Read(p)
+}
+
+func (x *xzFile) Close() error {
+	return x.file.Close()
+}
+
 // DetectDelimiter detects the delimiter based on file extension.
 // Returns ',' for CSV files and '\t' for TSV files.
-// For stdin (filePath is "-" or empty), defaults to comma.
+// For stdin (filePath is "-" or empty) and other files, defaults to comma.
 func DetectDelimiter(filePath string) rune {
-	// Handle stdin - default to comma since we can't detect from filename
+	if delimiter := ExtensionDelimiter(filePath); delimiter != 0 {
+		return delimiter
+	}
+	return ','
+}
+
+// ExtensionDelimiter returns the delimiter a file's extension implies, after
+// stripping compression extensions: ',' for .csv and '\t' for .tsv files. It
+// returns 0 for stdin (filePath "-" or empty) and other extensions, whose
+// delimiter the importer sniffs from the content (see SniffDelimiter).
+func ExtensionDelimiter(filePath string) rune {
 	if filePath == "-" || filePath == "" {
-		return ','
+		return 0
 	}
 
-	// Strip compression extensions first
-	path := filePath
+	// Strip a URL's query string, then compression extensions
+	path := urlPath(filePath)
 	for {
 		ext := strings.ToLower(filepath.Ext(path))
-		if ext == ".gz" || ext == ".bz2" {
+		if ext == ".gz" || ext == ".bz2" || ext == ".lz4" || ext == ".xz" {
 			path = strings.TrimSuffix(path, filepath.Ext(path))
 			continue
 		}
 		break
 	}
 
-	ext := strings.ToLower(filepath.Ext(path))
-	if ext == ".tsv" {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ','
+	case ".tsv":
 		return '\t'
+	default:
+		return 0
 	}
-	return ','
+}
+
+const (
+	// sniffLines is how many records SniffDelimiter samples.
+	sniffLines = 20
+
+	// sniffBytes is the most an input is read ahead to sniff its delimiter.
+	sniffBytes = 64 * 1024
+)
+
+// SniffDelimiter reads the first lines of r and returns the one of
+// DelimiterCandidates that occurs, outside quoted fields, the same number of
+// times on the most lines, preferring the one that occurs most often on
+// ties. It returns ',' if no candidate occurs.
+func SniffDelimiter(r io.Reader) (rune, error) {
+	// Count each candidate on each record; a quoted newline continues it
+	counts := make([][]int, len(DelimiterCandidates))
+	reader := bufio.NewReader(r)
+	quoted := false
+	records := 0
+	record := make([]int, len(DelimiterCandidates))
+	for records < sniffLines {
+		line, err := reader.ReadString('\n')
+		for _, c := range line {
+			if c == '"' {
+				quoted = !quoted
+				continue
+			}
+			for i, candidate := range DelimiterCandidates {
+				if c == candidate && !quoted {
+					record[i]++
+				}
+			}
+		}
+		if !quoted && strings.TrimSpace(line) != "" {
+			for i := range record {
+				counts[i] = append(counts[i], record[i])
+				record[i] = 0
+			}
+			records++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	best, bestLines, bestCount := ',', 0, 0
+	for i, candidate := range DelimiterCandidates {
+		lines := make(map[int]int)
+		for _, count := range counts[i] {
+			if count > 0 {
+				lines[count]++
+			}
+		}
+		for count, n := range lines {
+			if n > bestLines || (n == bestLines && count > bestCount) {
+				best, bestLines, bestCount = candidate, n, count
+			}
+		}
+	}
+	return best, nil
+}
+
+// SniffInputDelimiter returns the delimiter an import of input sniffs from
+// its content when its Delimiter is 0.
+func SniffInputDelimiter(input FileInput) (rune, error) {
+	file, err := openInput(input)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return SniffDelimiter(file)
+}
+
+// sniffInput sets the delimiter of an input left to auto-detection (0) from
+// the first lines of r, and returns a reader that still yields all of r.
+// Inputs split on a literal separator default to comma.
+func sniffInput(r io.Reader, input *FileInput) (io.Reader, error) {
+	if input.Delimiter != 0 {
+		return r, nil
+	}
+	if input.MultiDelimiter != "" || input.RecordSeparator != "" {
+		input.Delimiter = ','
+		return r, nil
+	}
+
+	// Peek leaves the sample in the buffer for the importer to read
+	buffered := bufio.NewReaderSize(r, sniffBytes)
+	sample, err := buffered.Peek(sniffBytes)
+	switch {
+	case err == nil:
+		// The sample fills the buffer, so its last line may be cut short
+		if end := strings.LastIndexByte(string(sample), '\n'); end >= 0 {
+			sample = sample[:end+1]
+		}
+	case err != io.EOF:
+		return nil, err
+	}
+
+	delimiter, err := SniffDelimiter(strings.NewReader(string(sample)))
+	if err != nil {
+		return nil, err
+	}
+	input.Delimiter = delimiter
+	return buffered, nil
 }
@@ -0,0 +1,259 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/yatisql/yatisql-go/internal/database"
+)
+
+// Policies for rows with more fields than the header (FileInput.ExtraColumns).
+const (
+	ExtraColumnsError   = "error"   // Fail the import
+	ExtraColumnsIgnore  = "ignore"  // Drop the overflow fields
+	ExtraColumnsCapture = "capture" // Store the overflow fields in ExtraColumnName
+)
+
+// ExtraColumnName is the TEXT column that holds overflow fields, as a JSON
+// array, under the capture policy.
+const ExtraColumnName = "_extra"
+
+// recordReader reads one record at a time from an input.
+// *csv.Reader satisfies this interface.
+type recordReader interface {
+	Read() ([]string, error)
+	// FieldPos returns the line and column of a field of the last record read.
+	FieldPos(field int) (line, column int)
+}
+
+// readError describes an error from recordReader.Read, with the line it
+// occurred on when known.
+func readError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("parse error at line %d: %w", parseErr.Line, parseErr.Err)
+	}
+	return fmt.Errorf("failed to read row: %w", err)
+}
+
+// newRecordReader creates the record reader for an input's format.
+func newRecordReader(r io.Reader, input FileInput) recordReader {
+	reader := newFormatReader(r, input)
+	if input.SqueezeSpaces {
+		return &squeezeReader{recordReader: reader, skipHeader: input.HasHeader}
+	}
+	return reader
+}
+
+// newFormatReader creates the reader that splits an input into fields.
+func newFormatReader(r io.Reader, input FileInput) recordReader {
+	if input.RecordSeparator != "" {
+		fieldSep := input.MultiDelimiter
+		if fieldSep == "" {
+			fieldSep = string(input.Delimiter)
+		}
+		return newSplitReader(r, fieldSep, input.RecordSeparator)
+	}
+	if input.MultiDelimiter != "" {
+		return newSplitReader(r, input.MultiDelimiter, "\n")
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = input.Delimiter
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	// Rows of any width are read; fitRecord checks them against the header so
+	// that mismatches are reported with their line and field counts
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// extraColumnHeaders returns the headers with the capture column appended
+// when the input captures overflow fields.
+func extraColumnHeaders(headers []string, input FileInput) ([]string, error) {
+	if input.ExtraColumns != ExtraColumnsCapture {
+		return headers, nil
+	}
+	for _, h := range headers {
+		if strings.EqualFold(database.SanitizeColumnName(h), ExtraColumnName) {
+			return nil, fmt.Errorf("cannot capture extra columns: the file already has a column named %s", ExtraColumnName)
+		}
+	}
+	return append(headers[:len(headers):len(headers)], ExtraColumnName), nil
+}
+
+// raggedRows counts the rows fitRecord fitted to the header's width.
+type raggedRows struct {
+	padded    int // Rows with fewer fields, padded with empty values
+	truncated int // Rows with more fields, whose extra fields were dropped
+}
+
+// fitRecord applies the input's column count rules to a record read from a
+// file with width header columns: short rows are padded with empty values
+// unless input.StrictColumns is set, and long rows follow the extra columns
+// policy, which by default truncates them unless input.StrictColumns is set.
+// line is the record's line in the file, used in errors. Padded and
+// truncated rows are counted in ragged.
+func fitRecord(record []string, width, line int, input FileInput, ragged *raggedRows) ([]string, error) {
+	if len(record) < width && input.StrictColumns {
+		return nil, fmt.Errorf("parse error at line %d: %d fields but the header has %d", line, len(record), width)
+	}
+	if len(record) < width {
+		ragged.padded++
+	}
+	if len(record) <= width {
+		return record, nil
+	}
+
+	policy := input.ExtraColumns
+	if policy == "" {
+		policy = ExtraColumnsIgnore
+		if input.StrictColumns {
+			policy = ExtraColumnsError
+		}
+	}
+	switch policy {
+	case ExtraColumnsIgnore:
+		ragged.truncated++
+		return record[:width], nil
+	case ExtraColumnsCapture:
+		extra, err := json.Marshal(record[width:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode extra fields at line %d: %w", line, err)
+		}
+		// The capture column follows the header columns, so pad short rows up to it
+		fitted := make([]string, width+1)
+		copy(fitted, record[:width])
+		fitted[width] = string(extra)
+		return fitted, nil
+	default:
+		return nil, fmt.Errorf("parse error at line %d: %d fields but the header has %d (use --extra-columns ignore or capture to accept them)", line, len(record), width)
+	}
+}
+
+// splitReader splits records on a literal record separator, usually a newline,
+// and their fields on a literal, possibly multi-character, field separator.
+// Quoting is not supported: every occurrence of a separator ends a field or
+// record.
+type splitReader struct {
+	reader    *bufio.Reader
+	sep       string
+	recordSep string
+	line      int // Records read so far, i.e. the line of the last record
+}
+
+func newSplitReader(r io.Reader, sep, recordSep string) *splitReader {
+	return &splitReader{reader: bufio.NewReader(r), sep: sep, recordSep: recordSep}
+}
+
+// Read returns the fields of the next non-empty record.
+func (s *splitReader) Read() ([]string, error) {
+	for {
+		record, err := s.readRecord()
+		if err != nil && (err != io.EOF || record == "") {
+			return nil, err
+		}
+		s.line++
+
+		if s.recordSep == "\n" {
+			record = strings.TrimRight(record, "\r")
+		} else {
+			// Files with other separators often still end, or break records, with a newline
+			record = strings.Trim(record, "\r\n")
+		}
+		if record == "" {
+			// Skip empty records, matching csv.Reader
+			continue
+		}
+		return strings.Split(record, s.sep), nil
+	}
+}
+
+// readRecord reads up to and including the next record separator and returns
+// the text before it. At the end of the input it returns the remaining text
+// with io.EOF.
+func (s *splitReader) readRecord() (string, error) {
+	last := s.recordSep[len(s.recordSep)-1]
+	var record string
+	for {
+		chunk, err := s.reader.ReadString(last)
+		record += chunk
+		if err != nil {
+			return record, err
+		}
+		if strings.HasSuffix(record, s.recordSep) {
+			return strings.TrimSuffix(record, s.recordSep), nil
+		}
+	}
+}
+
+// FieldPos returns the line of the last record read, counting records
+// rather than newlines when the record separator is not a newline.
+// Columns are not tracked.
+func (s *splitReader) FieldPos(int) (line, column int) {
+	return s.line, 0
+}
+
+// squeezeReader collapses runs of whitespace within the fields of the
+// records it reads. The header is left as it is.
+type squeezeReader struct {
+	recordReader
+	skipHeader bool
+}
+
+func (s *squeezeReader) Read() ([]string, error) {
+	record, err := s.recordReader.Read()
+	if err != nil {
+		return record, err
+	}
+	if s.skipHeader {
+		s.skipHeader = false
+		return record, nil
+	}
+	for i, field := range record {
+		record[i] = squeezeSpaces(field)
+	}
+	return record, nil
+}
+
+// squeezeSpaces replaces every run of two or more whitespace characters in s
+// with a single space. Single whitespace characters are kept as they are.
+func squeezeSpaces(s string) string {
+	var b strings.Builder
+	copied := 0    // End of the text written to b so far
+	runStart := -1 // Offset of the current whitespace run (-1 = not in one)
+	runLength := 0 // Characters in the current whitespace run
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if runStart < 0 {
+				runStart = i
+			}
+			runLength++
+			continue
+		}
+		if runLength > 1 {
+			b.WriteString(s[copied:runStart])
+			b.WriteByte(' ')
+			copied = i
+		}
+		runStart, runLength = -1, 0
+	}
+	if runLength > 1 {
+		b.WriteString(s[copied:runStart])
+		b.WriteByte(' ')
+		copied = len(s)
+	}
+
+	// Fields without runs are returned without copying
+	if copied == 0 {
+		return s
+	}
+	b.WriteString(s[copied:])
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yatisql/yatisql-go/internal/database"
+)
+
+// InferColumnTypes returns the type of each of columns columns from sample
+// rows: INTEGER if every non-empty value is an integer, REAL if every one is
+// a number, and TEXT otherwise, including for columns with no values. Values
+// in nullStrings, which are imported as NULL, count as empty.
+func InferColumnTypes(sample [][]string, columns int, nullStrings []string) []string {
+	types := make([]string, columns)
+	for i := range types {
+		seen := false
+		types[i] = database.TypeInteger
+		for _, row := range sample {
+			if i >= len(row) || row[i] == "" || slices.Contains(nullStrings, row[i]) {
+				continue
+			}
+			seen = true
+			for types[i] != database.TypeText && !valueFits(row[i], types[i]) {
+				types[i] = widerType(types[i])
+			}
+			if types[i] == database.TypeText {
+				break
+			}
+		}
+		if !seen {
+			types[i] = database.TypeText
+		}
+	}
+	return types
+}
+
+// widerType returns the type to try after a value did not fit typ.
+func widerType(typ string) string {
+	if typ == database.TypeInteger {
+		return database.TypeReal
+	}
+	return database.TypeText
+}
+
+// valueFits reports whether value can be stored as a number in a column of
+// type typ. Numbers must not start with "+" or a redundant zero, so that
+// codes such as "007" and "+1" are not taken for numbers.
+func valueFits(value, typ string) bool {
+	switch typ {
+	case database.TypeInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && strconv.FormatInt(n, 10) == value
+	case database.TypeReal:
+		// ParseFloat also accepts forms SQLite does not, e.g. "Inf" and hex
+		if strings.Trim(value, "0123456789+-.eE") != "" || value[0] == '+' {
+			return false
+		}
+		digits := strings.TrimPrefix(value, "-")
+		if len(digits) > 1 && digits[0] == '0' && strings.IndexAny(digits[1:2], ".eE") < 0 {
+			return false
+		}
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+// mismatchedColumns adds to mismatched the position of every typed column
+// with a non-empty value in rows, other than one of nullStrings, that does
+// not fit its type.
+func mismatchedColumns(rows [][]string, types, nullStrings []string, mismatched map[int]bool) {
+	for _, row := range rows {
+		for i, typ := range types {
+			if i < len(row) && row[i] != "" && !mismatched[i] && !valueFits(row[i], typ) && !slices.Contains(nullStrings, row[i]) {
+				mismatched[i] = true
+			}
+		}
+	}
+}
+
+// typeMismatch returns an error naming the first non-empty value in rows,
+// other than one of nullStrings, that does not fit the type of its column,
+// or nil if they all fit. lines holds the file line of each row.
+func typeMismatch(rows [][]string, lines []int, headers, types, nullStrings []string) error {
+	for r, row := range rows {
+		for i, typ := range types {
+			if i < len(row) && row[i] != "" && !valueFits(row[i], typ) && !slices.Contains(nullStrings, row[i]) {
+				return fmt.Errorf("type mismatch at line %d: value %q in column %s is not %s", lines[r], row[i], headers[i], typ)
+			}
+		}
+	}
+	return nil
+}
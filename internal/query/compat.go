@@ -0,0 +1,184 @@
+// Package query provides SQL query rewriting for yatisql.
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compatibility dialects accepted by RewriteCompat.
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+)
+
+// functionRewrite describes how a function from another dialect maps to SQLite.
+type functionRewrite struct {
+	call string // Replacement for a call without arguments, e.g. NOW() (empty = rename only)
+	name string // SQLite function name to call instead (empty = only the no-argument form is mapped)
+}
+
+// compatFunctions lists the function rewrites for each dialect, keyed by
+// lowercase function name. Functions SQLite lacks but that cannot be
+// rewritten textually (LEFT, RIGHT) are registered on the connection instead;
+// see database.Options.CompatFunctions.
+var compatFunctions = map[string]map[string]functionRewrite{
+	DialectMySQL: {
+		"now":              {call: "datetime('now')"},
+		"sysdate":          {call: "datetime('now')"},
+		"curdate":          {call: "date('now')"},
+		"curtime":          {call: "time('now')"},
+		"unix_timestamp":   {name: "unixepoch"},
+		"if":               {name: "iif"},
+		"lcase":            {name: "lower"},
+		"ucase":            {name: "upper"},
+		"char_length":      {name: "length"},
+		"character_length": {name: "length"},
+	},
+	DialectPostgres: {
+		"now":              {call: "datetime('now')"},
+		"string_agg":       {name: "group_concat"},
+		"char_length":      {name: "length"},
+		"character_length": {name: "length"},
+	},
+}
+
+// ValidateDialect checks that dialect is empty or a supported compatibility dialect.
+func ValidateDialect(dialect string) error {
+	if dialect == "" {
+		return nil
+	}
+	if _, ok := compatFunctions[dialect]; !ok {
+		return fmt.Errorf("invalid compatibility dialect: %s (use '%s' or '%s')", dialect, DialectMySQL, DialectPostgres)
+	}
+	return nil
+}
+
+// RewriteCompat rewrites calls to known functions of another SQL dialect into
+// their SQLite equivalents, e.g. NOW() to datetime('now') for mysql.
+// String literals, quoted identifiers, comments and qualified names (t.now)
+// are left untouched. An empty or unknown dialect returns the query unchanged.
+func RewriteCompat(sql, dialect string) string {
+	rewrites := compatFunctions[dialect]
+	if len(rewrites) == 0 {
+		return sql
+	}
+
+	var out strings.Builder
+	out.Grow(len(sql))
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(sql, i, c)
+			out.WriteString(sql[i:end])
+			i = end
+		case c == '[':
+			end := skipQuoted(sql, i, ']')
+			out.WriteString(sql[i:end])
+			i = end
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			out.WriteString(sql[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end = i + 2 + end + 2
+			}
+			out.WriteString(sql[i:end])
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(sql) && isIdentPart(sql[end]) {
+				end++
+			}
+			word := sql[i:end]
+
+			rewrite, ok := rewrites[strings.ToLower(word)]
+			if !ok || precededByDot(sql, i) {
+				out.WriteString(word)
+				i = end
+				continue
+			}
+
+			open := skipSpace(sql, end)
+			if open >= len(sql) || sql[open] != '(' {
+				out.WriteString(word)
+				i = end
+				continue
+			}
+
+			if closing := skipSpace(sql, open+1); rewrite.call != "" && closing < len(sql) && sql[closing] == ')' {
+				out.WriteString(rewrite.call)
+				i = closing + 1
+				continue
+			}
+
+			if rewrite.name != "" {
+				out.WriteString(rewrite.name)
+			} else {
+				out.WriteString(word)
+			}
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	return out.String()
+}
+
+// skipQuoted returns the index just past a quoted section starting at start.
+// A doubled closing character is an escaped one.
+func skipQuoted(sql string, start int, closing byte) int {
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != closing {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == closing {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(sql)
+}
+
+// skipSpace returns the index of the first non-whitespace byte at or after i.
+func skipSpace(sql string, i int) int {
+	for i < len(sql) && (sql[i] == ' ' || sql[i] == '\t' || sql[i] == '\n' || sql[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// precededByDot reports whether the identifier at i is qualified, as in t.now.
+func precededByDot(sql string, i int) bool {
+	for i--; i >= 0; i-- {
+		switch sql[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '.':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
@@ -0,0 +1,47 @@
+package query
+
+import "testing"
+
+func TestRewriteCompat(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		input   string
+		want    string
+	}{
+		{"mysql now", DialectMySQL, "SELECT NOW()", "SELECT datetime('now')"},
+		{"postgres now", DialectPostgres, "SELECT now( ) AS ts", "SELECT datetime('now') AS ts"},
+		{"mysql curdate", DialectMySQL, "SELECT CURDATE()", "SELECT date('now')"},
+		{"mysql if", DialectMySQL, "SELECT IF(age > 30, 'old', 'young') FROM data", "SELECT iif(age > 30, 'old', 'young') FROM data"},
+		{"mysql unix_timestamp with argument", DialectMySQL, "SELECT UNIX_TIMESTAMP(created)", "SELECT unixepoch(created)"},
+		{"postgres string_agg", DialectPostgres, "SELECT string_agg(name, ',') FROM data", "SELECT group_concat(name, ',') FROM data"},
+		{"string literal untouched", DialectMySQL, "SELECT 'NOW()' AS s", "SELECT 'NOW()' AS s"},
+		{"escaped quote in literal", DialectMySQL, "SELECT 'it''s NOW()', NOW()", "SELECT 'it''s NOW()', datetime('now')"},
+		{"quoted identifier untouched", DialectMySQL, `SELECT "now"() FROM data`, `SELECT "now"() FROM data`},
+		{"column named now", DialectMySQL, "SELECT now FROM data", "SELECT now FROM data"},
+		{"qualified name untouched", DialectMySQL, "SELECT t.now FROM data t", "SELECT t.now FROM data t"},
+		{"comment untouched", DialectMySQL, "SELECT 1 -- NOW()\n, NOW()", "SELECT 1 -- NOW()\n, datetime('now')"},
+		{"dialect-specific mapping", DialectPostgres, "SELECT IF(1, 2, 3)", "SELECT IF(1, 2, 3)"},
+		{"no dialect", "", "SELECT NOW()", "SELECT NOW()"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RewriteCompat(tt.input, tt.dialect)
+			if got != tt.want {
+				t.Errorf("RewriteCompat(%q, %q) = %q, want %q", tt.input, tt.dialect, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDialect(t *testing.T) {
+	for _, dialect := range []string{"", DialectMySQL, DialectPostgres} {
+		if err := ValidateDialect(dialect); err != nil {
+			t.Errorf("ValidateDialect(%q) error = %v", dialect, err)
+		}
+	}
+	if err := ValidateDialect("oracle"); err == nil {
+		t.Error("ValidateDialect(\"oracle\") expected error, got nil")
+	}
+}
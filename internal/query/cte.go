@@ -0,0 +1,235 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CTE is one common table expression definition, such as
+// "active_users AS (SELECT * FROM users WHERE active = 1)".
+type CTE struct {
+	Name       string // Unquoted name, used to detect redefinitions
+	Definition string // Full definition text, as written
+}
+
+// ParseCTEs parses a library of CTE definitions separated by commas, as
+// they would appear after WITH. A leading WITH keyword and a trailing
+// semicolon are allowed.
+func ParseCTEs(src string) ([]CTE, error) {
+	s := strings.TrimSpace(src)
+	s = strings.TrimSpace(strings.TrimSuffix(s, ";"))
+
+	start := skipSpaceAndComments(s, 0)
+	if end, ok := matchKeyword(s, start, "WITH"); ok {
+		start = end
+	}
+
+	ctes, end, err := parseCTEList(s, start)
+	if err != nil {
+		return nil, err
+	}
+	if len(ctes) == 0 {
+		return nil, fmt.Errorf("no CTE definitions found")
+	}
+	if end < len(s) {
+		return nil, fmt.Errorf("unexpected text after CTE %q at offset %d: expected ','", ctes[len(ctes)-1].Name, end)
+	}
+	return ctes, nil
+}
+
+// PrependCTEs adds the CTE definitions to a query's WITH clause, creating one
+// if needed. CTEs the query defines itself take precedence over library CTEs
+// of the same name. Statements that cannot start with WITH (PRAGMA, CREATE,
+// ...) are returned unchanged.
+func PrependCTEs(sql string, ctes []CTE) string {
+	if len(ctes) == 0 {
+		return sql
+	}
+
+	start := skipSpaceAndComments(sql, 0)
+	keyword := strings.ToUpper(leadingWord(sql, start))
+
+	var defined map[string]bool
+	prefix, rest := "WITH ", " "+sql[start:]
+	switch keyword {
+	case "SELECT", "VALUES", "INSERT", "REPLACE", "UPDATE", "DELETE":
+	case "WITH":
+		listStart, _ := matchKeyword(sql, start, "WITH")
+		if end, ok := matchKeyword(sql, listStart, "RECURSIVE"); ok {
+			prefix = "WITH RECURSIVE "
+			listStart = end
+		}
+		// An unparseable WITH clause is left for SQLite to report
+		own, _, err := parseCTEList(sql, listStart)
+		if err != nil {
+			return sql
+		}
+		defined = make(map[string]bool, len(own))
+		for _, cte := range own {
+			defined[strings.ToLower(cte.Name)] = true
+		}
+		rest = ", " + sql[listStart:]
+	default:
+		return sql
+	}
+
+	definitions := make([]string, 0, len(ctes))
+	for _, cte := range ctes {
+		if !defined[strings.ToLower(cte.Name)] {
+			definitions = append(definitions, cte.Definition)
+		}
+	}
+	if len(definitions) == 0 {
+		return sql
+	}
+	return sql[:start] + prefix + strings.Join(definitions, ", ") + rest
+}
+
+// parseCTEList parses comma-separated CTE definitions starting at i and
+// returns them with the offset just past the last one.
+func parseCTEList(s string, i int) ([]CTE, int, error) {
+	var ctes []CTE
+	for {
+		cte, end, err := parseCTE(s, skipSpaceAndComments(s, i))
+		if err != nil {
+			return nil, i, err
+		}
+		ctes = append(ctes, cte)
+
+		i = skipSpaceAndComments(s, end)
+		if i >= len(s) || s[i] != ',' {
+			return ctes, i, nil
+		}
+		i++
+	}
+}
+
+// parseCTE parses "name [(columns)] AS [NOT] [MATERIALIZED] (select)" at i.
+func parseCTE(s string, i int) (CTE, int, error) {
+	start := i
+	if i >= len(s) {
+		return CTE{}, i, fmt.Errorf("expected CTE name at end of input")
+	}
+
+	var name string
+	switch c := s[i]; {
+	case c == '"' || c == '`':
+		end := skipQuoted(s, i, c)
+		name = strings.ReplaceAll(s[i+1:end-1], string([]byte{c, c}), string(c))
+		i = end
+	case c == '[':
+		end := skipQuoted(s, i, ']')
+		name = s[i+1 : end-1]
+		i = end
+	case isIdentStart(c):
+		end := i + 1
+		for end < len(s) && isIdentPart(s[end]) {
+			end++
+		}
+		name = s[i:end]
+		i = end
+	default:
+		return CTE{}, i, fmt.Errorf("expected CTE name at offset %d", i)
+	}
+
+	i = skipSpaceAndComments(s, i)
+	if i < len(s) && s[i] == '(' {
+		end, err := skipParens(s, i)
+		if err != nil {
+			return CTE{}, i, fmt.Errorf("CTE %q: %w", name, err)
+		}
+		i = skipSpaceAndComments(s, end)
+	}
+
+	end, ok := matchKeyword(s, i, "AS")
+	if !ok {
+		return CTE{}, i, fmt.Errorf("CTE %q: expected AS at offset %d", name, i)
+	}
+	i = end
+	if end, ok := matchKeyword(s, i, "NOT"); ok {
+		i = end
+	}
+	if end, ok := matchKeyword(s, i, "MATERIALIZED"); ok {
+		i = end
+	}
+
+	if i >= len(s) || s[i] != '(' {
+		return CTE{}, i, fmt.Errorf("CTE %q: expected '(' after AS at offset %d", name, i)
+	}
+	end, err := skipParens(s, i)
+	if err != nil {
+		return CTE{}, i, fmt.Errorf("CTE %q: %w", name, err)
+	}
+	return CTE{Name: name, Definition: s[start:end]}, end, nil
+}
+
+// skipParens returns the offset just past the parenthesis that closes the one
+// at i, ignoring parentheses in string literals, quoted identifiers and comments.
+func skipParens(s string, i int) (int, error) {
+	open := i
+	depth := 0
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(s, i, c)
+			continue
+		case c == '[':
+			i = skipQuoted(s, i, ']')
+			continue
+		case c == '-' && strings.HasPrefix(s[i:], "--"), c == '/' && strings.HasPrefix(s[i:], "/*"):
+			i = skipSpaceAndComments(s, i)
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i + 1, nil
+			}
+		}
+		i++
+	}
+	return i, fmt.Errorf("unbalanced '(' at offset %d", open)
+}
+
+// skipSpaceAndComments returns the offset of the first byte at or after i
+// that is neither whitespace nor part of a comment.
+func skipSpaceAndComments(s string, i int) int {
+	for {
+		i = skipSpace(s, i)
+		switch {
+		case strings.HasPrefix(s[i:], "--"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				return len(s)
+			}
+			i += end + 1
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return len(s)
+			}
+			i += 2 + end + 2
+		default:
+			return i
+		}
+	}
+}
+
+// matchKeyword reports whether the keyword starts at offset i (ignoring case)
+// and returns the offset of the next token after it.
+func matchKeyword(s string, i int, keyword string) (int, bool) {
+	if !strings.EqualFold(leadingWord(s, i), keyword) {
+		return i, false
+	}
+	return skipSpaceAndComments(s, i+len(keyword)), true
+}
+
+// leadingWord returns the identifier-like word starting at offset i.
+func leadingWord(s string, i int) string {
+	end := i
+	for end < len(s) && isIdentPart(s[end]) {
+		end++
+	}
+	return s[i:end]
+}
@@ -0,0 +1,69 @@
+package query
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCTEs(t *testing.T) {
+	src := `-- Shared definitions
+WITH adults AS (SELECT * FROM data WHERE CAST(age AS INTEGER) >= 18),
+"big cities"(name) AS MATERIALIZED (
+    SELECT city FROM data WHERE city IN ('New York', 'Los Angeles (LA)')
+);`
+
+	ctes, err := ParseCTEs(src)
+	if err != nil {
+		t.Fatalf("ParseCTEs() error = %v", err)
+	}
+	if len(ctes) != 2 {
+		t.Fatalf("Expected 2 CTEs, got %d: %+v", len(ctes), ctes)
+	}
+	if ctes[0].Name != "adults" || ctes[1].Name != "big cities" {
+		t.Errorf("Names = %q, %q; want adults, big cities", ctes[0].Name, ctes[1].Name)
+	}
+	if !strings.HasSuffix(ctes[1].Definition, "'Los Angeles (LA)')\n)") {
+		t.Errorf("Definition = %q, want it to end at the closing parenthesis", ctes[1].Definition)
+	}
+
+	invalid := []string{
+		"",
+		"SELECT * FROM data",
+		"adults AS SELECT 1",
+		"adults AS (SELECT 1",
+		"adults AS (SELECT 1) SELECT * FROM adults",
+	}
+	for _, src := range invalid {
+		if _, err := ParseCTEs(src); err == nil {
+			t.Errorf("ParseCTEs(%q) expected error, got nil", src)
+		}
+	}
+}
+
+func TestPrependCTEs(t *testing.T) {
+	ctes := []CTE{
+		{Name: "a", Definition: "a AS (SELECT 1 AS x)"},
+		{Name: "b", Definition: "b AS (SELECT 2 AS x)"},
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"select", "SELECT * FROM a", "WITH a AS (SELECT 1 AS x), b AS (SELECT 2 AS x) SELECT * FROM a"},
+		{"existing with", "WITH c AS (SELECT 3) SELECT * FROM c", "WITH a AS (SELECT 1 AS x), b AS (SELECT 2 AS x), c AS (SELECT 3) SELECT * FROM c"},
+		{"recursive", "with recursive n(i) AS (SELECT 1) SELECT * FROM n", "WITH RECURSIVE a AS (SELECT 1 AS x), b AS (SELECT 2 AS x), n(i) AS (SELECT 1) SELECT * FROM n"},
+		{"query overrides library", "WITH B AS (SELECT 9) SELECT * FROM b", "WITH a AS (SELECT 1 AS x), B AS (SELECT 9) SELECT * FROM b"},
+		{"leading comment kept", "-- report\nSELECT 1", "-- report\nWITH a AS (SELECT 1 AS x), b AS (SELECT 2 AS x) SELECT 1"},
+		{"pragma unchanged", "PRAGMA table_info(data)", "PRAGMA table_info(data)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PrependCTEs(tt.input, ctes); got != tt.want {
+				t.Errorf("PrependCTEs(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NULL orderings accepted by ApplyNullsOrder.
+const (
+	NullsFirst = "first"
+	NullsLast  = "last"
+)
+
+// ValidateNullsOrder checks that order is empty or a supported NULL ordering.
+func ValidateNullsOrder(order string) error {
+	switch order {
+	case "", NullsFirst, NullsLast:
+		return nil
+	default:
+		return fmt.Errorf("invalid nulls order: %s (use '%s' or '%s')", order, NullsFirst, NullsLast)
+	}
+}
+
+// ApplyNullsOrder adds NULLS FIRST or NULLS LAST to every ORDER BY term that
+// does not already specify where NULLs sort. SQLite sorts NULLs first for ASC
+// and last for DESC by default. Terms in window definitions and aggregate
+// calls are included. An empty order returns the query unchanged.
+func ApplyNullsOrder(sql, order string) string {
+	if order == "" {
+		return sql
+	}
+
+	var inserts []int
+	for i := 0; i < len(sql); {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(sql, i, c)
+		case c == '[':
+			i = skipQuoted(sql, i, ']')
+		case c == '-' && strings.HasPrefix(sql[i:], "--"), c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipSpaceAndComments(sql, i)
+		case isIdentStart(c):
+			word := leadingWord(sql, i)
+			end := i + len(word)
+			if strings.EqualFold(word, "ORDER") && !precededByDot(sql, i) {
+				if next, ok := matchKeyword(sql, skipSpaceAndComments(sql, end), "BY"); ok {
+					var termEnds []int
+					end, termEnds = orderByTerms(sql, next)
+					inserts = append(inserts, termEnds...)
+				}
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+
+	if len(inserts) == 0 {
+		return sql
+	}
+	keyword := " NULLS " + strings.ToUpper(order)
+	var out strings.Builder
+	out.Grow(len(sql) + len(inserts)*len(keyword))
+	prev := 0
+	for _, at := range inserts {
+		out.WriteString(sql[prev:at])
+		out.WriteString(keyword)
+		prev = at
+	}
+	out.WriteString(sql[prev:])
+	return out.String()
+}
+
+// orderByTerms scans the terms of an ORDER BY clause starting at i. It
+// returns the offset where the clause ends and the end offset of each term
+// that has no NULLS FIRST/LAST.
+func orderByTerms(sql string, i int) (int, []int) {
+	var ends []int
+	termEnd := -1 // End of the current term so far (-1 = no term yet)
+	hasNulls := false
+	finishTerm := func() {
+		if termEnd >= 0 && !hasNulls {
+			ends = append(ends, termEnd)
+		}
+		termEnd, hasNulls = -1, false
+	}
+
+	for i < len(sql) {
+		switch c := sql[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r',
+			c == '-' && strings.HasPrefix(sql[i:], "--"), c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipSpaceAndComments(sql, i)
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(sql, i, c)
+			termEnd = i
+		case c == '[':
+			i = skipQuoted(sql, i, ']')
+			termEnd = i
+		case c == '(':
+			end, err := skipParens(sql, i)
+			if err != nil {
+				// Leave unbalanced SQL for SQLite to report
+				return len(sql), nil
+			}
+			i = end
+			termEnd = i
+		case c == ',':
+			finishTerm()
+			i++
+		case c == ')' || c == ';':
+			finishTerm()
+			return i, ends
+		case isIdentStart(c):
+			word := leadingWord(sql, i)
+			switch strings.ToUpper(word) {
+			case "LIMIT", "OFFSET", "ROWS", "RANGE", "GROUPS":
+				// Only a keyword after an expression ends the clause; at the
+				// start of a term it is a column name
+				if termEnd >= 0 && !precededByDot(sql, i) {
+					finishTerm()
+					return i, ends
+				}
+			case "NULLS":
+				hasNulls = true
+			}
+			i += len(word)
+			termEnd = i
+		default:
+			i++
+			termEnd = i
+		}
+	}
+	finishTerm()
+	return i, ends
+}
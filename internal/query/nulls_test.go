@@ -0,0 +1,96 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yatisql/yatisql-go/internal/database"
+)
+
+func TestApplyNullsOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		order string
+		input string
+		want  string
+	}{
+		{"single term", NullsLast, "SELECT * FROM t ORDER BY a", "SELECT * FROM t ORDER BY a NULLS LAST"},
+		{"nulls first", NullsFirst, "SELECT * FROM t ORDER BY a DESC", "SELECT * FROM t ORDER BY a DESC NULLS FIRST"},
+		{"several terms", NullsLast, "SELECT * FROM t ORDER BY a, b DESC, c COLLATE NOCASE ASC", "SELECT * FROM t ORDER BY a NULLS LAST, b DESC NULLS LAST, c COLLATE NOCASE ASC NULLS LAST"},
+		{"before limit", NullsLast, "SELECT * FROM t ORDER BY a LIMIT 5", "SELECT * FROM t ORDER BY a NULLS LAST LIMIT 5"},
+		{"trailing semicolon", NullsLast, "SELECT * FROM t ORDER BY a;\n", "SELECT * FROM t ORDER BY a NULLS LAST;\n"},
+		{"expression term", NullsLast, "SELECT * FROM t ORDER BY CAST(a AS INTEGER) + 1", "SELECT * FROM t ORDER BY CAST(a AS INTEGER) + 1 NULLS LAST"},
+		{"explicit nulls kept", NullsLast, "SELECT * FROM t ORDER BY a NULLS FIRST, b", "SELECT * FROM t ORDER BY a NULLS FIRST, b NULLS LAST"},
+		{"window", NullsLast, "SELECT rank() OVER (ORDER BY a ROWS UNBOUNDED PRECEDING) FROM t", "SELECT rank() OVER (ORDER BY a NULLS LAST ROWS UNBOUNDED PRECEDING) FROM t"},
+		{"subquery", NullsLast, "SELECT * FROM (SELECT a FROM t ORDER BY a) ORDER BY 1", "SELECT * FROM (SELECT a FROM t ORDER BY a NULLS LAST) ORDER BY 1 NULLS LAST"},
+		{"column named range", NullsLast, "SELECT * FROM t ORDER BY range", "SELECT * FROM t ORDER BY range NULLS LAST"},
+		{"comment after term", NullsLast, "SELECT * FROM t ORDER BY a -- sort\n", "SELECT * FROM t ORDER BY a NULLS LAST -- sort\n"},
+		{"literal untouched", NullsLast, "SELECT 'ORDER BY a' FROM t", "SELECT 'ORDER BY a' FROM t"},
+		{"no order by", NullsLast, "SELECT * FROM t", "SELECT * FROM t"},
+		{"no order", "", "SELECT * FROM t ORDER BY a", "SELECT * FROM t ORDER BY a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplyNullsOrder(tt.input, tt.order)
+			if got != tt.want {
+				t.Errorf("ApplyNullsOrder(%q, %q) = %q, want %q", tt.input, tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyNullsOrderSorting(t *testing.T) {
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatalf("database.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE t (v INTEGER); INSERT INTO t VALUES (2), (NULL), (1)"); err != nil {
+		t.Fatalf("setup error = %v", err)
+	}
+
+	sortedValues := func(query string) string {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", query, err)
+		}
+		defer rows.Close()
+		var values []string
+		for rows.Next() {
+			var v *int
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if v == nil {
+				values = append(values, "NULL")
+			} else {
+				values = append(values, string(rune('0'+*v)))
+			}
+		}
+		return strings.Join(values, ",")
+	}
+
+	query := "SELECT v FROM t ORDER BY v"
+	if got := sortedValues(query); got != "NULL,1,2" {
+		t.Errorf("default order = %s, want NULL,1,2", got)
+	}
+	if got := sortedValues(ApplyNullsOrder(query, NullsLast)); got != "1,2,NULL" {
+		t.Errorf("nulls last order = %s, want 1,2,NULL", got)
+	}
+	if got := sortedValues(ApplyNullsOrder(query+" DESC", NullsFirst)); got != "NULL,2,1" {
+		t.Errorf("nulls first descending order = %s, want NULL,2,1", got)
+	}
+}
+
+func TestValidateNullsOrder(t *testing.T) {
+	for _, order := range []string{"", NullsFirst, NullsLast} {
+		if err := ValidateNullsOrder(order); err != nil {
+			t.Errorf("ValidateNullsOrder(%q) error = %v", order, err)
+		}
+	}
+	if err := ValidateNullsOrder("middle"); err == nil {
+		t.Error("ValidateNullsOrder(middle): expected error, got nil")
+	}
+}
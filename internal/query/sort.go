@@ -0,0 +1,67 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortKey is a result column to sort query output by.
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// ParseSortKeys parses a comma-separated list of sort keys, each a result
+// column optionally followed by ":asc" or ":desc", e.g. "city,age:desc".
+func ParseSortKeys(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(spec, ",") {
+		column, direction, _ := strings.Cut(strings.TrimSpace(part), ":")
+		column = strings.TrimSpace(column)
+		if column == "" {
+			return nil, fmt.Errorf("invalid sort key %q: expected column[:desc]", part)
+		}
+
+		key := SortKey{Column: column}
+		switch strings.ToLower(strings.TrimSpace(direction)) {
+		case "", "asc":
+		case "desc":
+			key.Desc = true
+		default:
+			return nil, fmt.Errorf("invalid sort direction in %q (use 'asc' or 'desc')", part)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Wrappable reports whether a statement returns rows that can be selected
+// from as a subquery, i.e. it is a SELECT, VALUES or WITH statement.
+func Wrappable(sql string) bool {
+	switch strings.ToUpper(leadingWord(sql, skipSpaceAndComments(sql, 0))) {
+	case "SELECT", "VALUES", "WITH":
+		return true
+	default:
+		return false
+	}
+}
+
+// SortOutput wraps a query so that its rows are returned sorted by keys, as
+// SELECT * FROM (query) ORDER BY keys. A LIMIT in the query applies before
+// sorting. Statements that are not Wrappable are returned unchanged.
+func SortOutput(sql string, keys []SortKey) string {
+	if len(keys) == 0 || !Wrappable(sql) {
+		return sql
+	}
+
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = `"` + strings.ReplaceAll(key.Column, `"`, `""`) + `"`
+		if key.Desc {
+			terms[i] += " DESC"
+		}
+	}
+	// Newlines keep a trailing line comment in the query from hiding the ")"
+	inner := strings.TrimRight(strings.TrimSpace(sql), ";")
+	return "SELECT * FROM (\n" + inner + "\n) ORDER BY " + strings.Join(terms, ", ")
+}
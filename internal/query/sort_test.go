@@ -0,0 +1,56 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSortKeys(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []SortKey
+		wantErr bool
+	}{
+		{spec: "age", want: []SortKey{{Column: "age"}}},
+		{spec: "age:desc", want: []SortKey{{Column: "age", Desc: true}}},
+		{spec: "city, age:DESC", want: []SortKey{{Column: "city"}, {Column: "age", Desc: true}}},
+		{spec: "city:asc", want: []SortKey{{Column: "city"}}},
+		{spec: "age:down", wantErr: true},
+		{spec: "city,", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSortKeys(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSortKeys(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSortKeys(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestSortOutput(t *testing.T) {
+	keys := []SortKey{{Column: "city"}, {Column: "age", Desc: true}}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"select", "SELECT * FROM t;", "SELECT * FROM (\nSELECT * FROM t\n) ORDER BY \"city\", \"age\" DESC"},
+		{"trailing comment", "SELECT * FROM t -- all", "SELECT * FROM (\nSELECT * FROM t -- all\n) ORDER BY \"city\", \"age\" DESC"},
+		{"with", "WITH x AS (SELECT 1) SELECT * FROM x", "SELECT * FROM (\nWITH x AS (SELECT 1) SELECT * FROM x\n) ORDER BY \"city\", \"age\" DESC"},
+		{"pragma unchanged", "PRAGMA table_info(t)", "PRAGMA table_info(t)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SortOutput(tt.input, keys); got != tt.want {
+				t.Errorf("SortOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := SortOutput("SELECT 1", nil); got != "SELECT 1" {
+		t.Errorf("SortOutput() without keys = %q, want the query unchanged", got)
+	}
+}
@@ -0,0 +1,156 @@
+// Package yatisql imports CSV/TSV files into SQLite and runs SQL queries
+// over them. It is the library entry point to the functionality of the
+// yatisql command line tool.
+//
+// A Session owns one SQLite database for its lifetime:
+//
+//	session, err := yatisql.Open("")
+//	if err != nil {
+//		return err
+//	}
+//	defer session.Close()
+//
+//	if _, err := session.Import("users.csv", "users"); err != nil {
+//		return err
+//	}
+//	if _, err := session.Export("SELECT * FROM users WHERE active = '1'", "active.csv"); err != nil {
+//		return err
+//	}
+package yatisql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/yatisql/yatisql-go/internal/database"
+	"github.com/yatisql/yatisql-go/internal/exporter"
+	"github.com/yatisql/yatisql-go/internal/importer"
+)
+
+// Session is an open yatisql database. It is safe for concurrent use.
+type Session struct {
+	db *database.DB
+}
+
+// Input describes a file to import.
+type Input struct {
+	Path      string // File path, or "-" for stdin; .gz/.bz2/.lz4/.xz are decompressed
+	Table     string // Table name (default: "data", "data2", ... by position)
+	Delimiter rune   // Field delimiter (0 = detect from the extension or content)
+	NoHeader  bool   // The first row is data; columns are named col1, col2, ...
+	Encoding  string // Character encoding, e.g. "latin1" (default: UTF-8)
+
+	// Transform, if set, is called with the column names and each data row
+	// before it is inserted. It returns the row to insert, with one value
+	// per column, or false to skip the row.
+	Transform func(headers []string, row []string) ([]string, bool)
+}
+
+// ImportResult describes an imported table.
+type ImportResult struct {
+	Table string
+	Rows  int
+}
+
+// ExportResult describes the output of an exported query.
+type ExportResult struct {
+	Rows  int
+	Bytes int64 // Bytes written, after compression
+}
+
+// Open opens or creates the SQLite database at path. An empty path creates
+// a temporary database that is deleted by Close.
+func Open(path string) (*Session, error) {
+	db, err := database.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{db: db}, nil
+}
+
+// DB returns the underlying database for direct queries.
+func (s *Session) DB() *sql.DB {
+	return s.db.DB
+}
+
+// Path returns the database file path.
+func (s *Session) Path() string {
+	return s.db.Path
+}
+
+// Import imports a single CSV/TSV file with a header row into table,
+// detecting the delimiter from the file extension. An existing table of the
+// same name is replaced.
+func (s *Session) Import(path, table string) (*ImportResult, error) {
+	results, err := s.ImportFiles(Input{Path: path, Table: table})
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// ImportFiles imports files concurrently, streaming each one into its table.
+// Results are returned in input order. If any import fails, the error
+// describes every failure and the other tables are still imported.
+func (s *Session) ImportFiles(inputs ...Input) ([]ImportResult, error) {
+	fileInputs := make([]importer.FileInput, len(inputs))
+	for i, input := range inputs {
+		table := input.Table
+		if table == "" {
+			table = "data"
+			if i > 0 {
+				table = fmt.Sprintf("data%d", i+1)
+			}
+		}
+		delimiter := input.Delimiter
+		if delimiter == 0 {
+			delimiter = importer.ExtensionDelimiter(input.Path)
+		}
+		fileInputs[i] = importer.FileInput{
+			FilePath:  input.Path,
+			TableName: table,
+			Delimiter: delimiter,
+			HasHeader: !input.NoHeader,
+			Encoding:  input.Encoding,
+
+			RowTransform: input.Transform,
+		}
+	}
+
+	imported, err := importer.ImportConcurrent(s.db.DB, fileInputs, false, nil, nil, nil)
+
+	// ImportConcurrent returns results in completion order
+	rowsByTable := make(map[string]int, len(imported))
+	for _, result := range imported {
+		rowsByTable[result.TableName] = result.RowCount
+	}
+	results := make([]ImportResult, 0, len(fileInputs))
+	for _, input := range fileInputs {
+		if rows, ok := rowsByTable[input.TableName]; ok {
+			results = append(results, ImportResult{Table: input.TableName, Rows: rows})
+		}
+	}
+	return results, err
+}
+
+// Query runs a SQL query and returns its rows.
+func (s *Session) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.DB.Query(query, args...)
+}
+
+// Export runs a SQL query and writes its results to outputPath, or to stdout
+// if outputPath is empty. The format follows the extension: .json writes a
+// JSON array, .tsv tab-separated values, anything else CSV; a .gz suffix
+// compresses the output.
+func (s *Session) Export(query, outputPath string) (*ExportResult, error) {
+	result, err := exporter.ExecuteWithOptions(s.db.DB, query, outputPath, exporter.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &ExportResult{Rows: result.RowCount, Bytes: result.BytesWritten}, nil
+}
+
+// Close closes the database, deleting it if it is temporary.
+func (s *Session) Close() error {
+	return s.db.Close()
+}